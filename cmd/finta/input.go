@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/chzyer/readline"
+)
+
+// replInput is a line typed at the REPL, or the error readline returned
+type replInput struct {
+	line string
+	err  error
+}
+
+// readInput reads lines with readline in the background until it fails,
+// so that the REPL takes input while a task runs. Ctrl+C
+// (readline.ErrInterrupt) doesn't stop it.
+func readInput(rl *readline.Instance) <-chan replInput {
+	inputs := make(chan replInput)
+	go func() {
+		defer close(inputs)
+		for {
+			line, err := rl.Readline()
+			inputs <- replInput{line: line, err: err}
+			if err != nil && err != readline.ErrInterrupt {
+				return
+			}
+		}
+	}()
+	return inputs
+}
+
+// promptAnswers is the input of confirmation prompts. Readline owns the
+// terminal, so the REPL hands a prompt waiting in Read the next line typed
+// instead of queueing it for the agent.
+type promptAnswers struct {
+	reading sync.Mutex // Serialises prompts of concurrent tool calls
+	mu      sync.Mutex
+	waiting chan string // Set while a prompt waits for a line
+	buf     []byte
+}
+
+func (a *promptAnswers) Read(p []byte) (int, error) {
+	a.reading.Lock()
+	defer a.reading.Unlock()
+
+	if len(a.buf) == 0 {
+		ch := make(chan string, 1)
+		a.mu.Lock()
+		a.waiting = ch
+		a.mu.Unlock()
+		a.buf = []byte(<-ch + "\n")
+	}
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	return n, nil
+}
+
+// answer passes line to a waiting prompt and reports whether one was waiting
+func (a *promptAnswers) answer(line string) bool {
+	a.mu.Lock()
+	ch := a.waiting
+	a.waiting = nil
+	a.mu.Unlock()
+
+	if ch == nil {
+		return false
+	}
+	ch <- line
+	return true
+}
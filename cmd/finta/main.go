@@ -8,15 +8,25 @@ import (
 	"os/signal"
 	"strings"
 	"sync"
+	"time"
 
 	"finta/internal/agent"
+	"finta/internal/checkpoint"
 	"finta/internal/config"
+	"finta/internal/environment"
 	"finta/internal/hook"
 	"finta/internal/hook/handlers"
+	"finta/internal/instructions"
 	"finta/internal/llm"
+	"finta/internal/llm/anthropic"
+	"finta/internal/llm/cassette"
+	"finta/internal/llm/compact"
 	"finta/internal/llm/openai"
+	"finta/internal/llm/retry"
+	"finta/internal/llm/router"
 	"finta/internal/logger"
 	"finta/internal/mcp"
+	"finta/internal/session"
 	"finta/internal/tool"
 	"finta/internal/tool/builtin"
 
@@ -24,18 +34,28 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// defaultContinueTurns is how many more turns the REPL offers when a run
+// reaches its turn limit
+const defaultContinueTurns = 10
+
 var (
-	apiBaseURL  string
-	apiKey      string
-	model       string
-	temperature float32
-	maxTurns    int
-	verbose     bool
-	noColor     bool
-	streaming   bool
-	parallel    bool
-	agentType   string
-	configPath  string
+	provider       string
+	apiBaseURL     string
+	apiKey         string
+	model          string
+	temperature    float32
+	maxTurns       int
+	thinkingBudget int
+	verbose        bool
+	noColor        bool
+	streaming      bool
+	parallel       bool
+	agentType      string
+	configPath     string
+	recordPath     string
+	replayPath     string
+	resumeID       string
+	continueLast   bool
 )
 
 func main() {
@@ -52,19 +72,29 @@ func main() {
 		RunE:  runChat,
 	}
 
-	chatCmd.Flags().StringVar(&apiBaseURL, "api-base-url", os.Getenv("OPENAI_API_BASE_URL"), "OpenAI API base URL")
-	chatCmd.Flags().StringVar(&apiKey, "api-key", os.Getenv("OPENAI_API_KEY"), "OpenAI API key")
-	chatCmd.Flags().StringVar(&model, "model", "gpt-4-turbo", "Model to use")
+	chatCmd.Flags().StringVar(&provider, "provider", "openai", "LLM provider to use (openai, anthropic)")
+	chatCmd.Flags().StringVar(&apiBaseURL, "api-base-url", "", "API base URL (default: $OPENAI_API_BASE_URL or $ANTHROPIC_BASE_URL)")
+	chatCmd.Flags().StringVar(&apiKey, "api-key", "", "API key (default: $OPENAI_API_KEY or $ANTHROPIC_API_KEY)")
+	chatCmd.Flags().StringVar(&model, "model", "", "Model to use (default: gpt-4-turbo for openai, claude-sonnet-4-5 for anthropic)")
 	chatCmd.Flags().Float32Var(&temperature, "temperature", 0.7, "Temperature")
 	chatCmd.Flags().IntVar(&maxTurns, "max-turns", 10, "Maximum conversation turns")
+	chatCmd.Flags().IntVar(&thinkingBudget, "thinking-budget", 0, "Extended thinking token budget (anthropic only, 0 = disabled)")
 	chatCmd.Flags().BoolVar(&verbose, "verbose", false, "Enable verbose output (debug mode)")
 	chatCmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored output")
 	chatCmd.Flags().BoolVar(&streaming, "streaming", false, "Enable streaming output")
 	chatCmd.Flags().BoolVar(&parallel, "parallel", true, "Enable parallel tool execution (default: true)")
-	chatCmd.Flags().StringVar(&agentType, "agent-type", "general", "Agent type to use (general, explore, plan, execute)")
+	chatCmd.Flags().StringVar(&agentType, "agent-type", "general", "Agent type to use (general, explore, plan, execute, or a custom type from .finta/agents)")
 	chatCmd.Flags().StringVar(&configPath, "config", "", "Path to config file (default: auto-detect)")
+	chatCmd.Flags().StringVar(&recordPath, "record", "", "Record LLM interactions to a cassette file")
+	chatCmd.Flags().StringVar(&replayPath, "replay", "", "Replay LLM interactions from a cassette file instead of calling a provider")
+	chatCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	chatCmd.Flags().StringVar(&resumeID, "resume", "", "Resume a saved session by id (or unique id prefix)")
+	chatCmd.Flags().BoolVar(&continueLast, "continue", false, "Continue the most recent session in this directory")
+	chatCmd.MarkFlagsMutuallyExclusive("resume", "continue")
 
 	rootCmd.AddCommand(chatCmd)
+	rootCmd.AddCommand(newSessionsCmd())
+	rootCmd.AddCommand(newRewindCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -73,10 +103,6 @@ func main() {
 }
 
 func runChat(cmd *cobra.Command, _ []string) error {
-	if apiKey == "" {
-		return fmt.Errorf("OpenAI API key required (set OPENAI_API_KEY or use --api-key)")
-	}
-
 	// Create Logger
 	logLevel := logger.LevelInfo
 	if verbose {
@@ -87,24 +113,76 @@ func runChat(cmd *cobra.Command, _ []string) error {
 		log.SetColorMode(false)
 	}
 
+	// Load configuration
+	var cfg *config.Config
+	if configPath != "" {
+		var err error
+		cfg, err = config.Load(configPath)
+		if err != nil {
+			log.Info("Warning: Failed to load config: %v (continuing without MCP servers)", err)
+			cfg = &config.Config{}
+		}
+	} else {
+		var err error
+		cfg, err = config.LoadWithDefaults()
+		if err != nil {
+			log.Debug("No config file found (continuing without MCP servers)")
+			cfg = &config.Config{}
+		}
+	}
+
+	// A configured router replaces the single client selected by flags
+	useRouter := cfg.LLM.Router.Enabled() && replayPath == ""
+	if !useRouter && replayPath == "" {
+		if err := applyProviderDefaults(); err != nil {
+			return err
+		}
+	}
+
 	// Print configuration with masked sensitive data
 	log.Info("Configuration:")
-	log.Info("  Model: %s", model)
+	if replayPath != "" {
+		log.Info("  Provider: replay (%s)", replayPath)
+	} else if useRouter {
+		log.Info("  Provider: router (default chain: %s)", strings.Join(cfg.LLM.Router.Default, " -> "))
+	} else {
+		log.Info("  Provider: %s", provider)
+		log.Info("  Model: %s", model)
+	}
 	log.Info("  Agent Type: %s", agentType)
 	log.Info("  Temperature: %.2f", temperature)
 	log.Info("  Max Turns: %d", maxTurns)
 	log.Info("  Parallel: %v", parallel)
 	log.Info("  Streaming: %v", streaming)
 	log.Info("  Verbose: %v", verbose)
-	log.Info("  API Key: %s", maskAPIKey(apiKey))
-	if apiBaseURL != "" {
-		log.Info("  API Base URL: %s", apiBaseURL)
+	if !useRouter && replayPath == "" {
+		log.Info("  API Key: %s", maskAPIKey(apiKey))
+		if apiBaseURL != "" {
+			log.Info("  API Base URL: %s", apiBaseURL)
+		}
 	}
 	log.Info("")
 
 	// Create LLM client
-	log.Debug("Creating LLM client (model: %s)", model)
-	llmClient := openai.NewClient(apiKey, model, apiBaseURL)
+	var llmClient llm.Client
+	var err error
+	if replayPath != "" {
+		log.Debug("Replaying LLM interactions from %s", replayPath)
+		llmClient, err = cassette.NewReplayer(replayPath)
+	} else if useRouter {
+		log.Debug("Creating LLM router with %d clients", len(cfg.LLM.Clients))
+		llmClient, err = newRouter(cfg, log)
+	} else {
+		log.Debug("Creating %s LLM client (model: %s)", provider, model)
+		llmClient, err = newLLMClient(cfg, log, provider, apiKey, model, apiBaseURL, thinkingBudget)
+	}
+	if err != nil {
+		return err
+	}
+	if recordPath != "" {
+		log.Info("Recording LLM interactions to %s", recordPath)
+		llmClient = cassette.NewRecorder(recordPath, llmClient)
+	}
 
 	// Create tool registry
 	log.Debug("Registering built-in tools")
@@ -118,24 +196,6 @@ func runChat(cmd *cobra.Command, _ []string) error {
 
 	builtinToolCount := 6
 
-	// Load MCP configuration
-	var cfg *config.Config
-	if configPath != "" {
-		var err error
-		cfg, err = config.Load(configPath)
-		if err != nil {
-			log.Info("Warning: Failed to load config: %v (continuing without MCP servers)", err)
-			cfg = &config.Config{}
-		}
-	} else {
-		var err error
-		cfg, err = config.LoadWithDefaults()
-		if err != nil {
-			log.Debug("No config file found (continuing without MCP servers)")
-			cfg = &config.Config{}
-		}
-	}
-
 	// Initialize MCP manager
 	mcpManager := mcp.NewManager(registry)
 	mcpToolCount := 0
@@ -162,63 +222,291 @@ func runChat(cmd *cobra.Command, _ []string) error {
 	// Create agent factory
 	factory := agent.NewDefaultFactory(llmClient, registry)
 
+	// Agents whose config names another model get their own client
+	factory.SetClientProvider(func(modelName string) (llm.Client, error) {
+		if replayPath != "" {
+			// Recorded requests are matched on content, not on the model
+			return llmClient, nil
+		}
+		if cc, ok := cfg.LLM.Clients[modelName]; ok {
+			return newLLMClient(cfg, log, cc.Provider, config.ExpandEnv(cc.APIKey), cc.Model, config.ExpandEnv(cc.BaseURL), cc.ThinkingBudget)
+		}
+		if useRouter {
+			return nil, fmt.Errorf("model %s must name a client under llm.clients when the router is enabled", modelName)
+		}
+		return newLLMClient(cfg, log, provider, apiKey, modelName, apiBaseURL, thinkingBudget)
+	})
+
+	// Describe the environment in system prompts, refreshed at the start of each run
+	envCfg := environment.ConfigFrom(cfg.Environment)
+	envCfg.MCPServers = mcpManager.ListServers
+	if recordPath != "" || replayPath != "" {
+		// The date and directory would keep recorded requests from matching on replay
+		envCfg.Disabled = true
+	}
+	factory.SetSystemContext(environment.New(".", envCfg).Block)
+
+	// Project instructions from FINTA.md files go into every system prompt
+	instructionFiles, err := instructions.Discover(".")
+	if err != nil {
+		return err
+	}
+	for _, f := range instructionFiles {
+		log.Info("Loaded instructions from %s", f.Path)
+	}
+	factory.SetInstructions(instructions.Format(instructionFiles))
+
+	// Custom agent types declared in the project
+	defs, err := config.LoadAgents(config.AgentsDir)
+	if err != nil {
+		return err
+	}
+	for _, def := range defs {
+		if err := factory.RegisterAgent(agent.Definition{
+			Name:          def.Name,
+			Description:   def.Description,
+			Prompt:        def.Prompt,
+			Tools:         def.Tools,
+			Model:         def.Model,
+			Temperature:   def.Temperature,
+			MaxTokens:     def.MaxTokens,
+			MaxTurns:      def.MaxTurns,
+			ExecutionMode: tool.ExecutionMode(def.ExecutionMode),
+		}); err != nil {
+			return fmt.Errorf("%s: %w", def.Path, err)
+		}
+		log.Debug("Loaded custom agent %s from %s", def.Name, def.Path)
+	}
+	if len(defs) > 0 {
+		log.Info("Loaded %d custom agents from %s", len(defs), config.AgentsDir)
+	}
+
+	// Apply per-agent-type overrides from config
+	for name, ac := range cfg.Agents {
+		var toolChoice *llm.ToolChoice
+		if ac.ToolChoice != "" {
+			if toolChoice, err = llm.ParseToolChoice(ac.ToolChoice); err != nil {
+				return fmt.Errorf("agent %s: %w", name, err)
+			}
+		}
+		factory.SetAgentOverride(agent.AgentType(name), agent.ConfigOverride{
+			Model:             ac.Model,
+			Temperature:       ac.Temperature,
+			MaxTokens:         ac.MaxTokens,
+			MaxTurns:          ac.MaxTurns,
+			ToolChoice:        toolChoice,
+			ParallelToolCalls: ac.ParallelToolCalls,
+			TopP:              ac.TopP,
+			Stop:              ac.Stop,
+			Seed:              ac.Seed,
+		})
+		if ac.Model != "" {
+			log.Debug("Agent %s uses model %s", name, ac.Model)
+		}
+	}
+
+	// Keep long conversations within each model's context window
+	factory.SetCompactionConfig(compact.ConfigFrom(cfg.Compaction))
+
+	// Catch agents repeating the same tool calls
+	factory.SetLoopConfig(agent.LoopConfig{
+		Disabled:             cfg.Loop.Disabled,
+		RepeatThreshold:      cfg.Loop.RepeatThreshold,
+		OscillationThreshold: cfg.Loop.OscillationThreshold,
+		MaxNotes:             cfg.Loop.MaxNotes,
+	})
+
+	// Summarise progress when the turn limit stops a run
+	factory.SetSummarizeOnStop(cfg.TurnLimit.Summarize)
+
+	// Limit what each run may spend; sub-agents share the remainder
+	factory.SetBudget(agent.Budget{
+		MaxTotalTokens: cfg.Budget.MaxTokens,
+		MaxCost:        cfg.Budget.MaxCost,
+		MaxDuration:    cfg.Budget.Timeout,
+		MaxToolCalls:   cfg.Budget.MaxToolCalls,
+	})
+
+	// Price table for cost accounting, with config entries overriding list prices
+	prices := llm.DefaultPrices()
+	if len(cfg.Pricing) > 0 {
+		custom := make(llm.PriceTable, len(cfg.Pricing))
+		for name, p := range cfg.Pricing {
+			custom[name] = llm.Price{Input: p.Input, Output: p.Output}
+		}
+		prices = prices.Merge(custom)
+	}
+	factory.SetPriceTable(prices)
+
 	// Register Task tool with factory
 	taskTool := builtin.NewTaskTool(factory)
+	taskTool.SetMaxConcurrency(cfg.Task.MaxConcurrency)
 	registry.Register(taskTool)
 
-	totalTools := builtinToolCount + 1 + mcpToolCount // built-in + task + MCP
+	// Tools to follow up on sub-agents started with run_in_background
+	background := taskTool.Background()
+	registry.Register(builtin.NewTaskStatusTool(background))
+	registry.Register(builtin.NewTaskOutputTool(background))
+	registry.Register(builtin.NewTaskWaitTool(background))
+	registry.Register(builtin.NewTaskCancelTool(taskTool))
+	defer func() {
+		if n := background.Close(); n > 0 {
+			log.Info("Cancelled %d background sub-agent(s)", n)
+		}
+	}()
+
+	// task, task_status, task_output, task_wait and task_cancel
+	taskToolCount := 5
+	totalTools := builtinToolCount + taskToolCount + mcpToolCount // built-in + task + MCP
 	if mcpToolCount > 0 {
-		log.Info("Registered %d tools: %d built-in (read, bash, write, glob, grep, TodoWrite, task) + %d MCP tools", totalTools, builtinToolCount+1, mcpToolCount)
+		log.Info("Registered %d tools: %d built-in (read, bash, write, glob, grep, TodoWrite, task, task_*) + %d MCP tools", totalTools, builtinToolCount+taskToolCount, mcpToolCount)
 	} else {
-		log.Info("Registered %d tools: read, bash, write, glob, grep, TodoWrite, task", builtinToolCount+1)
+		log.Info("Registered %d tools: read, bash, write, glob, grep, TodoWrite, task, task_*", builtinToolCount+taskToolCount)
 	}
 
 	// Create agent based on type
-	var ag agent.Agent
-	var err error
-	ag, err = factory.CreateAgent(agent.AgentType(agentType))
+	ag, err := factory.CreateAgent(agent.AgentType(agentType))
 	if err != nil {
 		log.Error("Failed to create agent: %v", err)
 		return err
 	}
 
-	log.Debug("Created %s agent with max_turns=%d, temperature=%.2f, parallel=%v", agentType, maxTurns, temperature, parallel)
+	if baseAgent, ok := ag.(*agent.BaseAgent); ok {
+		log.Debug("Created %s agent (model: %s) with max_turns=%d, temperature=%.2f, parallel=%v", agentType, baseAgent.Model(), maxTurns, temperature, parallel)
+	}
 
-	// Initialize hook manager based on configuration
+	// Initialize hook manager based on configuration. Confirmation prompts
+	// read their answers from the REPL, which owns the terminal.
 	hookManager := hook.NewManager()
+	answers := &promptAnswers{}
 
 	if cfg.Hooks.BashConfirm {
-		hookManager.Register(handlers.NewBashConfirmHandler())
+		hookManager.Register(handlers.NewBashConfirmHandlerWithIO(answers, os.Stdout))
 		log.Info("Hooks: bash command confirmation enabled")
 	}
 
 	if len(cfg.Hooks.ToolConfirm) > 0 {
-		hookManager.Register(handlers.NewToolConfirmHandler(cfg.Hooks.ToolConfirm...))
+		hookManager.Register(handlers.NewToolConfirmHandlerWithIO(answers, os.Stdout, cfg.Hooks.ToolConfirm...))
 		log.Info("Hooks: tool confirmation enabled for: %v", cfg.Hooks.ToolConfirm)
 	}
 
-	// Set hook manager on agent if it supports it
+	// Set hook manager on agent if it supports it; sub-agents get the
+	// lifecycle and LLM call hooks
 	if baseAgent, ok := ag.(*agent.BaseAgent); ok {
 		baseAgent.SetHookManager(hookManager)
 	}
+	factory.SetHookManager(hookManager)
 
-	// Setup context with signal handling for Ctrl+C
+	// Setup context with signal handling for Ctrl+C. While a task runs,
+	// Ctrl+C interrupts only that task; otherwise it ends the session. At
+	// the prompt readline reads Ctrl+C itself (see the loop below).
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	var taskMu sync.Mutex
+	var interruptTask context.CancelFunc
+
+	// Helper function to interrupt the running task, if any. A pending
+	// confirmation prompt is denied.
+	interruptRunning := func() bool {
+		taskMu.Lock()
+		defer taskMu.Unlock()
+		if interruptTask == nil {
+			return false
+		}
+		fmt.Println("\nInterrupting...")
+		interruptTask()
+		interruptTask = nil
+		answers.answer("")
+		return true
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
 	go func() {
-		<-sigChan
-		fmt.Println("\nExiting...")
-		cancel()
+		for range sigChan {
+			if interruptRunning() {
+				continue
+			}
+			fmt.Println("\nExiting...")
+			cancel()
+			return
+		}
 	}()
 
-	// Message history for continuous conversation
+	// Message history for continuous conversation, saved to a session file
 	var history []llm.Message
 
-	// Helper function to run a single task
-	runTask := func(task string) error {
+	store, err := session.DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	var sess *session.Session
+	if resumeID != "" || continueLast {
+		id := resumeID
+		if continueLast {
+			if id, err = store.Latest(); err != nil {
+				return fmt.Errorf("no session to continue: %w", err)
+			}
+		}
+		if sess, history, err = store.Open(id); err != nil {
+			return err
+		}
+		log.Info("Resumed session %s (%d messages)", sess.ID(), len(history))
+	} else {
+		sess = store.Create(session.Meta{AgentType: agentType, Model: llmClient.Model()})
+	}
+
+	saveSession := func() {
+		if err := sess.Sync(history); err != nil {
+			log.Error("Failed to save session: %v", err)
+		}
+	}
+
+	// Files are snapshotted before tools modify them, so turns can be rewound
+	checkpoints, err := checkpoint.ForSession(sess.ID())
+	if err != nil {
+		return err
+	}
+
+	// Token usage and cost across all tasks in this session
+	var sessionUsage llm.Usage
+	var sessionCost float64
+	var sessionUnpriced bool
+
+	// Messages typed while a task runs, for the agent's next turn
+	queue := agent.NewMessageQueue()
+
+	// Helper function to run a single task. turns overrides the turn limit
+	// if positive. It returns why the run stopped.
+	runTask := func(task string, turns int) (agent.StopReason, error) {
+		// Ctrl+C cancels this context only
+		ctx, interrupt := context.WithCancel(ctx)
+		defer interrupt()
+		taskMu.Lock()
+		interruptTask = interrupt
+		taskMu.Unlock()
+		defer func() {
+			taskMu.Lock()
+			interruptTask = nil
+			taskMu.Unlock()
+		}()
+
+		// Let hooks rewrite or reject the input before it reaches the agent
+		data := hook.NewHookData(hook.OnUserPromptSubmit, "").Set("prompt", task)
+		feedback, err := hookManager.Trigger(ctx, data)
+		if err != nil {
+			return "", fmt.Errorf("prompt hook: %w", err)
+		}
+		if !feedback.Allow {
+			return "", fmt.Errorf("prompt %w: %s", hook.ErrDenied, feedback.Message)
+		}
+		if rewritten, ok := data.Modified().(string); ok {
+			task = rewritten
+		}
+
 		input := &agent.Input{
 			Task:     task,
 			Messages: history,
@@ -234,62 +522,142 @@ func runChat(cmd *cobra.Command, _ []string) error {
 		if cmd.Flags().Changed("max-turns") {
 			input.MaxTurns = maxTurns
 		}
+		if turns > 0 {
+			input.MaxTurns = turns
+		}
+
+		if _, err := checkpoints.BeginTurn(task, len(history)); err != nil {
+			return "", err
+		}
+		ctx = checkpoint.WithStore(ctx, checkpoints)
+
+		// Results of background sub-agents finished since the last turn, and
+		// messages the user typed meanwhile
+		ctx = agent.WithInbox(ctx, background)
+		ctx = agent.WithInbox(ctx, queue)
 
 		var output *agent.Output
-		var err error
 
 		if streaming {
-			streamChan := make(chan string, 100)
-			var streamedContent strings.Builder
-			var lineCount int
-			var mu sync.Mutex
-			var wg sync.WaitGroup
-
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for content := range streamChan {
-					fmt.Print(content)
-					mu.Lock()
-					streamedContent.WriteString(content)
-					lineCount += strings.Count(content, "\n")
-					mu.Unlock()
+			// Print content as it streams; once the LLM call completes, clear
+			// the raw text since the agent logs the rendered response
+			var streamed string
+			onEvent := func(event agent.Event) {
+				if ctx.Err() != nil {
+					return // Interrupted; stop printing what is still buffered
 				}
-			}()
-
-			input.EnableStreaming = true
-			output, err = ag.RunStreaming(ctx, input, streamChan)
-
-			// Wait for streaming goroutine to finish
-			wg.Wait()
-
-			// Clear streamed content and re-render with markdown
-			if err == nil && streamedContent.Len() > 0 {
-				mu.Lock()
-				content := streamedContent.String()
-				lines := lineCount
-				mu.Unlock()
-
-				// Move cursor up and clear (add 1 for the line without newline at end)
-				if lines > 0 || len(content) > 0 {
-					fmt.Printf("\033[%dA", lines+1) // Move up
-					fmt.Print("\033[J")              // Clear to end of screen
+				switch event.Type {
+				case agent.EventContentDelta:
+					fmt.Print(event.Text)
+					streamed += event.Text
+				case agent.EventUsage:
+					if streamed != "" {
+						if lines := strings.Count(streamed, "\n"); lines > 0 {
+							fmt.Printf("\033[%dA", lines) // Move up to the first streamed line
+						}
+						fmt.Print("\r\033[J") // Clear to end of screen
+						streamed = ""
+					}
 				}
-
-				// Re-render with markdown formatting
-				log.AgentResponse(content)
 			}
+
+			input.EnableStreaming = true
+			output, err = ag.RunStreaming(ctx, input, onEvent)
 		} else {
 			output, err = ag.Run(ctx, input)
 		}
 
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		// Update history (filter out system messages as agent adds them automatically)
+		// Accumulate session usage
+		usage, cost := output.Usage.Total()
+		sessionUsage.Add(usage)
+		sessionCost += cost
+		sessionUnpriced = sessionUnpriced || output.Usage.HasUnpriced()
+
+		// Update history (filter out system messages as agent adds them
+		// automatically). An interrupted run is kept up to its marker.
 		history = filterSystemMessages(output.Messages)
-		return nil
+		saveSession()
+		return output.StopReason, nil
+	}
+
+	// Helper function to summarise older history on request (/compact)
+	compactHistory := func() {
+		baseAgent, ok := ag.(*agent.BaseAgent)
+		if !ok {
+			log.Info("Compaction is not supported by this agent")
+			return
+		}
+		if len(history) == 0 {
+			log.Info("Nothing to compact")
+			return
+		}
+
+		compacted, result, err := baseAgent.Compact(ctx, history)
+		if err != nil {
+			log.Error("Compaction failed: %v", err)
+		}
+		history = compacted
+		saveSession()
+		log.Info("Compacted history: ~%d -> ~%d tokens (%d messages summarised, %d tool outputs elided)",
+			result.TokensBefore, result.TokensAfter, result.Summarised, result.Elided)
+	}
+
+	// Helper function to restore files and optionally history to before a turn (/rewind)
+	rewind := func(args []string) {
+		var turnArg string
+		truncate := false
+		for _, arg := range args {
+			if arg == "--history" {
+				truncate = true
+			} else {
+				turnArg = arg
+			}
+		}
+
+		if turnArg == "" {
+			printTurns(checkpoints.Turns())
+			return
+		}
+		turn, err := parseTurn(turnArg)
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+
+		result, err := checkpoints.Rewind(turn)
+		if err != nil {
+			log.Error("Rewind failed: %v", err)
+			return
+		}
+		printRewind(result)
+
+		if truncate {
+			truncated, ok := historyBefore(history, result.Turn)
+			if !ok {
+				log.Error("Turn %d is no longer in the conversation history; history left unchanged", turn)
+				return
+			}
+			history = truncated
+			saveSession()
+			log.Info("Conversation history truncated to %d messages", len(history))
+		}
+	}
+
+	// Helper function to stop one running sub-agent by id (/cancel)
+	cancelSubAgent := func(args []string) {
+		if len(args) != 1 {
+			log.Error("Usage: /cancel <sub-agent id>")
+			return
+		}
+		if !taskTool.Cancel(args[0]) {
+			log.Error("No running sub-agent with id %s", args[0])
+			return
+		}
+		log.Info("Cancelled sub-agent %s", args[0])
 	}
 
 	// Interactive loop with readline support
@@ -305,29 +673,146 @@ func runChat(cmd *cobra.Command, _ []string) error {
 	}
 	defer rl.Close()
 
+	// Lines are read in the background: while a task runs they are queued
+	// for the agent's next turn
+	inputs := readInput(rl)
+
+	// Helper function to run a task while taking input. Lines typed answer
+	// a pending confirmation prompt or are queued for the agent, and Ctrl+C
+	// interrupts the task.
+	runQueued := func(task string, turns int) (agent.StopReason, error) {
+		type result struct {
+			stopped agent.StopReason
+			err     error
+		}
+		done := make(chan result, 1)
+		go func() {
+			stopped, err := runTask(task, turns)
+			done <- result{stopped, err}
+		}()
+
+		rl.SetPrompt("")
+		defer rl.SetPrompt("> ")
+
+		in := inputs
+		for {
+			select {
+			case r := <-done:
+				return r.stopped, r.err
+			case input, ok := <-in:
+				switch {
+				case !ok:
+					in = nil // Input closed; finish the task, the REPL exits after
+				case input.err == readline.ErrInterrupt:
+					interruptRunning()
+				case input.err != nil:
+					// Ctrl+D is handled at the prompt
+				case answers.answer(input.line):
+					// Answered a confirmation prompt
+				default:
+					text := strings.TrimSpace(input.line)
+					if text == "" {
+						continue
+					}
+					if fields := strings.Fields(text); fields[0] == "/cancel" {
+						cancelSubAgent(fields[1:])
+						continue
+					}
+					if strings.HasPrefix(text, "/") {
+						log.Info("Only /cancel can be used while a task is running")
+						continue
+					}
+					queue.Push(text)
+					log.Info("Message queued for the agent's next turn")
+				}
+			}
+		}
+	}
+
+	// More turns offered when a run reaches the turn limit
+	continueTurns := defaultContinueTurns
+	if cfg.TurnLimit.ContinueTurns != 0 {
+		continueTurns = cfg.TurnLimit.ContinueTurns
+	}
+
+	// Helper function to ask whether to continue a run for more turns
+	offerTurns := func(turns int) bool {
+		rl.SetPrompt(fmt.Sprintf("Turn limit reached. Continue for %d more turns? [y/N] ", turns))
+		defer rl.SetPrompt("> ")
+
+		input, ok := <-inputs
+		if !ok || input.err != nil {
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(input.line))
+		return answer == "y" || answer == "yes"
+	}
+
+	// Set when the last task was interrupted or Ctrl+C was pressed at an
+	// empty prompt; another Ctrl+C at an empty prompt then exits
+	interrupted := false
+
 	for {
 		// Check if context was cancelled
 		if ctx.Err() != nil {
 			break
 		}
 
-		line, err := rl.Readline()
-		if err != nil {
-			if err == readline.ErrInterrupt {
-				continue // Ctrl+C clears line, continue
+		// Messages queued after the agent's last turn make the next task
+		var task string
+		if pending := queue.Drain(); len(pending) > 0 {
+			task = strings.Join(pending, "\n\n")
+			log.Info("Running %d queued message(s)", len(pending))
+		} else {
+			input, ok := <-inputs
+			if !ok {
+				break
 			}
-			if err == io.EOF {
-				break // Ctrl+D exits
+			if input.err != nil {
+				if input.err == readline.ErrInterrupt {
+					if input.line != "" {
+						continue // Ctrl+C clears line, continue
+					}
+					if interrupted {
+						break
+					}
+					interrupted = true
+					fmt.Println("(Press Ctrl+C again to exit)")
+					continue
+				}
+				if input.err == io.EOF {
+					break // Ctrl+D exits
+				}
+				break
 			}
-			break
+			task = strings.TrimSpace(input.line)
 		}
-
-		task := strings.TrimSpace(line)
 		if task == "" {
 			continue
 		}
+		interrupted = false
+
+		if task == "/compact" {
+			compactHistory()
+			continue
+		}
 
-		if err := runTask(task); err != nil {
+		if fields := strings.Fields(task); fields[0] == "/rewind" {
+			rewind(fields[1:])
+			continue
+		}
+
+		if fields := strings.Fields(task); fields[0] == "/cancel" {
+			cancelSubAgent(fields[1:])
+			continue
+		}
+
+		stopped, err := runQueued(task, 0)
+		for err == nil && stopped == agent.StopMaxTurns && continueTurns > 0 && offerTurns(continueTurns) {
+			stopped, err = runQueued("Continue working on the task from where you stopped.", continueTurns)
+		}
+		interrupted = stopped == agent.StopInterrupted
+		if err != nil {
 			if ctx.Err() != nil {
 				break // Graceful exit on Ctrl+C
 			}
@@ -336,10 +821,100 @@ func runChat(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
+	if sessionUsage.TotalTokens > 0 {
+		log.Info("Session usage: %s", logger.TokenUsage{
+			PromptTokens:     sessionUsage.PromptTokens,
+			CompletionTokens: sessionUsage.CompletionTokens,
+			Cost:             sessionCost,
+			Unpriced:         sessionUnpriced,
+		})
+	}
+
+	if sess.Saved() {
+		log.Info("Session saved: %s (resume with: finta chat --resume %s)", sess.ID(), sess.ID())
+	}
+
 	log.Debug("Session ended")
 	return nil
 }
 
+// applyProviderDefaults validates --provider and fills in the API key, base URL
+// and model from provider-specific environment variables and defaults
+func applyProviderDefaults() error {
+	var keyEnv, baseURLEnv, defaultModel string
+
+	switch provider {
+	case "openai":
+		keyEnv, baseURLEnv, defaultModel = "OPENAI_API_KEY", "OPENAI_API_BASE_URL", "gpt-4-turbo"
+	case "anthropic":
+		keyEnv, baseURLEnv, defaultModel = "ANTHROPIC_API_KEY", "ANTHROPIC_BASE_URL", "claude-sonnet-4-5"
+	default:
+		return fmt.Errorf("unknown provider: %s (supported: openai, anthropic)", provider)
+	}
+
+	if apiKey == "" {
+		apiKey = os.Getenv(keyEnv)
+	}
+	if apiBaseURL == "" {
+		apiBaseURL = os.Getenv(baseURLEnv)
+	}
+	if model == "" {
+		model = defaultModel
+	}
+
+	if apiKey == "" {
+		return fmt.Errorf("%s API key required (set %s or use --api-key)", provider, keyEnv)
+	}
+	return nil
+}
+
+// newLLMClient creates the LLM client for a provider, wrapped with the
+// provider's retry settings for rate limits and transient failures
+func newLLMClient(cfg *config.Config, log *logger.Logger, providerName, key, modelName, baseURL string, thinking int) (llm.Client, error) {
+	var base llm.Client
+	switch providerName {
+	case "openai":
+		base = openai.NewClient(key, modelName, baseURL)
+	case "anthropic":
+		client := anthropic.NewClient(key, modelName, baseURL)
+		client.SetThinkingBudget(thinking)
+		base = client
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", providerName)
+	}
+
+	retryCfg := retry.ConfigFrom(cfg.LLM.Providers[providerName].Retry)
+	retryClient := retry.NewClient(base, retryCfg)
+	retryClient.SetOnRetry(func(attempt int, delay time.Duration, err error) {
+		log.Info("LLM call to %s failed (attempt %d/%d): %v - retrying in %s",
+			modelName, attempt, retryCfg.MaxAttempts, err, delay.Round(time.Millisecond))
+	})
+
+	return retryClient, nil
+}
+
+// newRouter builds every named client from config and routes between them
+func newRouter(cfg *config.Config, log *logger.Logger) (llm.Client, error) {
+	clients := make(map[string]llm.Client, len(cfg.LLM.Clients))
+	for name, cc := range cfg.LLM.Clients {
+		client, err := newLLMClient(cfg, log, cc.Provider, config.ExpandEnv(cc.APIKey), cc.Model, config.ExpandEnv(cc.BaseURL), cc.ThinkingBudget)
+		if err != nil {
+			return nil, fmt.Errorf("llm client %s: %w", name, err)
+		}
+		clients[name] = client
+	}
+
+	r, err := router.NewFromConfig(cfg.LLM.Router, clients)
+	if err != nil {
+		return nil, err
+	}
+	r.SetOnFallback(func(from string, err error, to string) {
+		log.Info("LLM client %s failed: %v - falling back to %s", from, err, to)
+	})
+
+	return r, nil
+}
+
 // filterSystemMessages removes system messages from history
 // since the agent automatically adds system prompt
 func filterSystemMessages(messages []llm.Message) []llm.Message {
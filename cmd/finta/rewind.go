@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"finta/internal/checkpoint"
+	"finta/internal/llm"
+	"finta/internal/session"
+
+	"github.com/spf13/cobra"
+)
+
+// newRewindCmd creates the "rewind" command for restoring files changed by a session
+func newRewindCmd() *cobra.Command {
+	var sessionID string
+	var truncate bool
+
+	rewindCmd := &cobra.Command{
+		Use:   "rewind [turn]",
+		Short: "Restore files to their state before a turn of a session",
+		Long: `Restore every file the agent modified to its state before the given turn
+of a session. Without a turn, list the session's checkpointed turns.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRewind(sessionID, args, truncate)
+		},
+	}
+
+	rewindCmd.Flags().StringVar(&sessionID, "session", "", "Session id or unique id prefix (default: most recent session)")
+	rewindCmd.Flags().BoolVar(&truncate, "history", false, "Also truncate the conversation history to before the turn")
+
+	return rewindCmd
+}
+
+func runRewind(sessionID string, args []string, truncate bool) error {
+	store, err := session.DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	if sessionID == "" {
+		if sessionID, err = store.Latest(); err != nil {
+			return fmt.Errorf("no session to rewind: %w", err)
+		}
+	}
+	sess, history, err := store.Open(sessionID)
+	if err != nil {
+		return err
+	}
+
+	cps, err := checkpoint.ForSession(sess.ID())
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		fmt.Printf("Session %s\n", sess.ID())
+		printTurns(cps.Turns())
+		return nil
+	}
+
+	turn, err := parseTurn(args[0])
+	if err != nil {
+		return err
+	}
+	result, err := cps.Rewind(turn)
+	if err != nil {
+		return err
+	}
+	printRewind(result)
+
+	if truncate {
+		truncated, ok := historyBefore(history, result.Turn)
+		if !ok {
+			return fmt.Errorf("turn %d is no longer in the conversation history (was it compacted?)", turn)
+		}
+		if err := sess.Sync(truncated); err != nil {
+			return err
+		}
+		fmt.Printf("Conversation history truncated to %d messages\n", len(truncated))
+	}
+	return nil
+}
+
+// parseTurn parses a turn number argument
+func parseTurn(s string) (int, error) {
+	turn, err := strconv.Atoi(s)
+	if err != nil || turn < 1 {
+		return 0, fmt.Errorf("invalid turn %q: expected a positive number", s)
+	}
+	return turn, nil
+}
+
+// printTurns lists checkpointed turns with the files they modified
+func printTurns(turns []checkpoint.Turn) {
+	if len(turns) == 0 {
+		fmt.Println("No checkpoints yet")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TURN\tTIME\tFILES\tPROMPT")
+	for _, t := range turns {
+		prompt, _, _ := strings.Cut(strings.TrimSpace(t.Prompt), "\n")
+		if runes := []rune(prompt); len(runes) > 60 {
+			prompt = string(runes[:57]) + "..."
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", t.Number, t.Time.Local().Format(time.DateTime), len(t.Files), prompt)
+	}
+	w.Flush()
+}
+
+// printRewind reports the files a rewind restored or removed
+func printRewind(result *checkpoint.RewindResult) {
+	for _, path := range result.Restored {
+		fmt.Printf("  restored %s\n", path)
+	}
+	for _, path := range result.Removed {
+		fmt.Printf("  removed  %s\n", path)
+	}
+	fmt.Printf("Rewound to before turn %d (%d files restored, %d removed)\n",
+		result.Turn.Number, len(result.Restored), len(result.Removed))
+}
+
+// historyBefore returns the conversation history as it was before a turn's
+// prompt. It reports false if the prompt can no longer be found, e.g. because
+// the history was compacted since.
+func historyBefore(history []llm.Message, turn checkpoint.Turn) ([]llm.Message, bool) {
+	isPrompt := func(i int) bool {
+		return history[i].Role == llm.RoleUser && history[i].Content == turn.Prompt
+	}
+
+	if turn.HistoryLen < len(history) && isPrompt(turn.HistoryLen) {
+		return history[:turn.HistoryLen:turn.HistoryLen], true
+	}
+
+	// The history was rewritten since the turn; look for its prompt instead
+	for i := len(history) - 1; i >= 0; i-- {
+		if isPrompt(i) {
+			return history[:i:i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"finta/internal/checkpoint"
+	"finta/internal/llm"
+	"finta/internal/session"
+
+	"github.com/spf13/cobra"
+)
+
+// newSessionsCmd creates the "sessions" command for managing saved chats
+func newSessionsCmd() *cobra.Command {
+	sessionsCmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage saved chat sessions of the current directory",
+	}
+
+	sessionsCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List saved sessions, most recent first",
+		Args:  cobra.NoArgs,
+		RunE:  runSessionsList,
+	})
+	sessionsCmd.AddCommand(&cobra.Command{
+		Use:   "show <id>",
+		Short: "Print the conversation of a session",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsShow,
+	})
+	sessionsCmd.AddCommand(&cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a session",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSessionsDelete,
+	})
+
+	return sessionsCmd
+}
+
+func runSessionsList(cmd *cobra.Command, _ []string) error {
+	store, err := session.DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		fmt.Println("No saved sessions for this directory")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUPDATED\tMESSAGES\tAGENT\tTITLE")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			info.ID, info.Updated.Local().Format(time.DateTime), info.Messages, info.AgentType, info.Title)
+	}
+	return w.Flush()
+}
+
+func runSessionsShow(cmd *cobra.Command, args []string) error {
+	store, err := session.DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	id, err := store.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	info, history, err := store.Load(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Session %s\n", info.ID)
+	fmt.Printf("Created: %s  Agent: %s  Model: %s\n\n", info.Created.Local().Format(time.DateTime), info.AgentType, info.Model)
+
+	for _, msg := range history {
+		printMessage(msg)
+	}
+	return nil
+}
+
+func runSessionsDelete(cmd *cobra.Command, args []string) error {
+	store, err := session.DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	id, err := store.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(id); err != nil {
+		return err
+	}
+
+	// File snapshots can't be rewound without their session
+	checkpoints, err := checkpoint.ForSession(id)
+	if err != nil {
+		return err
+	}
+	if err := checkpoints.Delete(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted session %s\n", id)
+	return nil
+}
+
+// printMessage prints a history message as a plain-text transcript entry
+func printMessage(msg llm.Message) {
+	switch msg.Role {
+	case llm.RoleTool:
+		fmt.Printf("[tool result: %s]\n%s\n\n", msg.Name, indent(msg.Content))
+	case llm.RoleAssistant:
+		if msg.Reason != "" {
+			fmt.Printf("[assistant reasoning]\n%s\n\n", indent(msg.Reason))
+		}
+		if msg.Content != "" {
+			fmt.Printf("[assistant]\n%s\n\n", indent(msg.Content))
+		}
+		for _, tc := range msg.ToolCalls {
+			if tc.Function != nil {
+				fmt.Printf("[tool call: %s]\n  %s\n\n", tc.Function.Name, tc.Function.Arguments)
+			}
+		}
+	default:
+		fmt.Printf("[%s]\n%s\n\n", msg.Role, indent(msg.Content))
+	}
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n  ")
+}
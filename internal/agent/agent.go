@@ -2,15 +2,20 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+
 	"finta/internal/llm"
 	"finta/internal/logger"
 	"finta/internal/tool"
 )
 
+// Agent runs tasks. A run whose context is cancelled returns its partial
+// Output with StopInterrupted and a nil error, so callers that must tell
+// it apart from a finished run check Output.StopReason.
 type Agent interface {
 	Name() string
 	Run(ctx context.Context, input *Input) (*Output, error)
-	RunStreaming(ctx context.Context, input *Input, streamChan chan<- string) (*Output, error)
+	RunStreaming(ctx context.Context, input *Input, onEvent EventHandler) (*Output, error)
 }
 
 type Input struct {
@@ -20,14 +25,42 @@ type Input struct {
 	Temperature     float32
 	Logger          *logger.Logger
 	EnableStreaming bool
+
+	// Budget limits the run's tokens, cost, time and tool calls, on top of
+	// Config.Budget
+	Budget Budget
+
+	// ResponseFormat requests a final answer in JSON conforming to a schema;
+	// the validated answer is returned in Output.Structured
+	ResponseFormat *llm.ResponseFormat
 }
 
 type Output struct {
-	Messages  []llm.Message
-	Result    string
-	ToolCalls []*tool.CallResult
+	Messages   []llm.Message
+	Result     string
+	ToolCalls  []*tool.CallResult
+	Usage      *Usage          // Token usage and cost, including sub-agents
+	Structured json.RawMessage // Validated JSON answer when Input.ResponseFormat is set
+	StopReason StopReason      // Why the run ended; anything but StopCompleted means a partial result
+	StopDetail string          // For StopBudget, the limit reached and whether it was exceeded
+	Turns      int             // LLM calls the agent made, not counting sub-agents
 }
 
+// StopReason tells why a run ended
+type StopReason string
+
+const (
+	StopCompleted   StopReason = "completed"   // The agent gave its final answer
+	StopLength      StopReason = "length"      // The final answer was cut off at the token limit
+	StopMaxTurns    StopReason = "max_turns"   // The turn limit was reached before a final answer
+	StopBudget      StopReason = "budget"      // A limit of the run's Budget was reached
+	StopLoop        StopReason = "loop"        // The agent kept repeating the same tool calls (ErrToolLoop)
+	StopInterrupted StopReason = "interrupted" // The run's context was cancelled
+)
+
+// InterruptedMarker ends the conversation of an interrupted run
+const InterruptedMarker = "[interrupted]"
+
 type Config struct {
 	Model               string
 	Temperature         float32
@@ -35,4 +68,21 @@ type Config struct {
 	MaxTurns            int
 	EnableParallelTools bool
 	ToolExecutionMode   tool.ExecutionMode
+
+	// Optional request controls; zero values use the provider default
+	ToolChoice        *llm.ToolChoice // Applies until the run's first tool call
+	ParallelToolCalls *bool           // Whether the model may request several tools per turn
+	TopP              float32
+	Stop              []string
+	Seed              *int
+
+	// Loop detection of tool calls repeated across turns
+	Loop LoopConfig
+
+	// SummarizeOnStop makes one final LLM call without tools when a run
+	// stops before a final answer, asking the model to summarise its progress
+	SummarizeOnStop bool
+
+	// Budget limits the tokens, cost, time and tool calls of every run
+	Budget Budget
 }
@@ -2,11 +2,14 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"finta/internal/hook"
 	"finta/internal/llm"
+	"finta/internal/llm/compact"
 	"finta/internal/tool"
 )
 
@@ -16,13 +19,22 @@ type BaseAgent struct {
 	llmClient    llm.Client
 	toolRegistry *tool.Registry
 	toolExecutor *tool.Executor
+	compactor    *compact.Compactor
+	prices       llm.PriceTable
 	config       *Config
+	hooks        *hook.Manager // Agent lifecycle and LLM call hooks
+
+	systemContext SystemContext // Appended to the system prompt at the start of each run
 }
 
+// SystemContext generates text added to an agent's system prompt at the
+// start of every run, e.g. a description of the current environment
+type SystemContext func() string
+
 func NewBaseAgent(name, systemPrompt string, client llm.Client, registry *tool.Registry, cfg *Config) *BaseAgent {
 	if cfg == nil {
 		cfg = &Config{
-			Model:               "gpt-4-turbo",
+			Model:               client.Model(),
 			Temperature:         0.7,
 			MaxTokens:           4096,
 			MaxTurns:            20,
@@ -42,6 +54,8 @@ func NewBaseAgent(name, systemPrompt string, client llm.Client, registry *tool.R
 		llmClient:    client,
 		toolRegistry: registry,
 		toolExecutor: executor,
+		compactor:    compact.New(client, compact.DefaultConfig()),
+		prices:       llm.DefaultPrices(),
 		config:       cfg,
 	}
 }
@@ -50,29 +64,288 @@ func (a *BaseAgent) Name() string {
 	return a.name
 }
 
-// SetHookManager sets the hook manager for tool execution
+// Model returns the model this agent's LLM client calls
+func (a *BaseAgent) Model() string {
+	return a.llmClient.Model()
+}
+
+// temperature returns the input temperature, falling back to the agent config
+func (a *BaseAgent) temperature(input *Input) float32 {
+	if input.Temperature != 0 {
+		return input.Temperature
+	}
+	return a.config.Temperature
+}
+
+// chatRequest builds the LLM request for a turn. A configured tool choice
+// only applies until the run's first tool call, so that forcing a tool
+// cannot keep the model from ever answering.
+func (a *BaseAgent) chatRequest(messages []llm.Message, tools []*llm.ToolDefinition, input *Input, calledTools bool) *llm.ChatRequest {
+	req := &llm.ChatRequest{
+		Messages:          messages,
+		Tools:             tools,
+		Temperature:       a.temperature(input),
+		MaxTokens:         a.config.MaxTokens,
+		ParallelToolCalls: a.config.ParallelToolCalls,
+		TopP:              a.config.TopP,
+		Stop:              a.config.Stop,
+		Seed:              a.config.Seed,
+		ResponseFormat:    input.ResponseFormat,
+	}
+	if !calledTools {
+		req.ToolChoice = a.config.ToolChoice
+	}
+	return req
+}
+
+// SetHookManager sets the hook manager for tool execution, agent lifecycle
+// and LLM calls
 func (a *BaseAgent) SetHookManager(manager *hook.Manager) {
+	a.hooks = manager
 	a.toolExecutor.SetHookManager(manager)
 }
 
+// hookData creates hook data describing this agent's run
+func (a *BaseAgent) hookData(ctx context.Context, point hook.HookPoint) *hook.HookData {
+	return hook.NewHookData(point, "").
+		Set("agent", a.name).
+		Set("depth", GetNestingDepth(ctx))
+}
+
+// beforeLLMCall triggers the BeforeLLMCall hook. Handlers may replace the
+// request messages or veto the call.
+func (a *BaseAgent) beforeLLMCall(ctx context.Context, req *llm.ChatRequest, turn int) error {
+	if a.hooks == nil {
+		return nil
+	}
+
+	data := a.hookData(ctx, hook.BeforeLLMCall).
+		Set("turn", turn).
+		Set("request", req).
+		Set("messages", req.Messages)
+
+	feedback, err := a.hooks.Trigger(ctx, data)
+	if err != nil {
+		return fmt.Errorf("before LLM call hook: %w", err)
+	}
+	if !feedback.Allow {
+		return fmt.Errorf("LLM call %w: %s", hook.ErrDenied, feedback.Message)
+	}
+	if messages, ok := data.Modified().([]llm.Message); ok {
+		req.Messages = messages
+	}
+	return nil
+}
+
+// reportLoop logs a detected tool call loop and triggers the
+// OnLoopDetected hook
+func (a *BaseAgent) reportLoop(ctx context.Context, execCtx *ExecutionContext, d *loopDetection) {
+	action := "note"
+	if d.stop {
+		action = "stop"
+		execCtx.Logger.Error("Loop detected: agent %s, stopping", d)
+	} else {
+		execCtx.Logger.Error("Loop detected: agent %s, asking it to change approach", d)
+	}
+
+	if a.hooks == nil {
+		return
+	}
+	data := a.hookData(ctx, hook.OnLoopDetected).
+		Set("turn", execCtx.CurrentTurn).
+		Set("kind", string(d.kind)).
+		Set("turns", d.turns).
+		Set("tools", d.tools).
+		Set("action", action)
+	_, _ = a.hooks.Trigger(ctx, data)
+}
+
+// afterLLMCall triggers the AfterLLMCall hook
+func (a *BaseAgent) afterLLMCall(ctx context.Context, req *llm.ChatRequest, resp *llm.ChatResponse, turn int, duration time.Duration) {
+	if a.hooks == nil {
+		return
+	}
+
+	data := a.hookData(ctx, hook.AfterLLMCall).
+		Set("turn", turn).
+		Set("request", req).
+		Set("response", resp).
+		Set("duration", duration)
+
+	// After hooks don't block, just trigger
+	_, _ = a.hooks.Trigger(ctx, data)
+}
+
+// SetCompactionConfig replaces the settings used to keep history within
+// the model's context window
+func (a *BaseAgent) SetCompactionConfig(cfg compact.Config) {
+	a.compactor = compact.New(a.llmClient, cfg)
+}
+
+// SetPriceTable sets the model prices used for cost accounting
+func (a *BaseAgent) SetPriceTable(prices llm.PriceTable) {
+	a.prices = prices
+}
+
+// SetSystemContext sets a generator for text added to the system prompt at
+// the start of each run
+func (a *BaseAgent) SetSystemContext(generate SystemContext) {
+	a.systemContext = generate
+}
+
+// buildSystemPrompt returns the system prompt for a new run
+func (a *BaseAgent) buildSystemPrompt() string {
+	if a.systemContext == nil {
+		return a.systemPrompt
+	}
+	extra := a.systemContext()
+	if extra == "" {
+		return a.systemPrompt
+	}
+	if a.systemPrompt == "" {
+		return extra
+	}
+	return a.systemPrompt + "\n\n" + extra
+}
+
+// startUsage creates the usage record of a run, registers it with the
+// calling agent (if any) and makes it the parent of this run's sub-agents
+func (a *BaseAgent) startUsage(ctx context.Context, execCtx *ExecutionContext) context.Context {
+	execCtx.Usage = NewUsage(a.name)
+	if parent := GetUsageFromContext(ctx); parent != nil {
+		parent.AddSubAgent(execCtx.Usage)
+	}
+	return WithUsage(ctx, execCtx.Usage)
+}
+
+// recordUsage accounts the usage of one LLM call, priced for the model that
+// served it (with a router, not necessarily the client's default model)
+func (a *BaseAgent) recordUsage(execCtx *ExecutionContext, resp *llm.ChatResponse) {
+	model, usage := resp.Model, resp.Usage
+	if model == "" {
+		model = a.llmClient.Model()
+	}
+	execCtx.Usage.AddTurn(execCtx.CurrentTurn, model, usage, a.prices)
+	execCtx.Logger.Debug("Turn %d usage (%s): %d prompt + %d completion tokens",
+		execCtx.CurrentTurn, model, usage.PromptTokens, usage.CompletionTokens)
+}
+
+// Compact summarises older messages regardless of their size.
+// It backs the REPL's /compact command.
+func (a *BaseAgent) Compact(ctx context.Context, messages []llm.Message) ([]llm.Message, *compact.Result, error) {
+	ctx = llm.WithAgentName(ctx, a.name)
+	return a.compactor.Compact(ctx, messages, 0, true)
+}
+
+// compactMessages compacts messages before an LLM call when they no longer
+// fit the context window alongside the tool definitions and the response.
+// Failures are logged and the best available messages are returned.
+func (a *BaseAgent) compactMessages(ctx context.Context, messages []llm.Message, tools []*llm.ToolDefinition, execCtx *ExecutionContext) []llm.Message {
+	reserved := llm.EstimateToolTokens(a.llmClient.Model(), tools) + a.config.MaxTokens
+	if !a.compactor.NeedsCompaction(messages, reserved) {
+		return messages
+	}
+
+	execCtx.Logger.Info("Context nearly full, compacting history...")
+	compacted, result, err := a.compactor.Compact(ctx, messages, reserved, false)
+	if err != nil {
+		execCtx.Logger.Error("Compaction incomplete: %v", err)
+	}
+	execCtx.Logger.Info("Compacted history: ~%d -> ~%d tokens (%d messages summarised, %d tool outputs elided)",
+		result.TokensBefore, result.TokensAfter, result.Summarised, result.Elided)
+
+	return compacted
+}
+
+// Run runs the agent to completion using plain LLM calls
 func (a *BaseAgent) Run(ctx context.Context, input *Input) (*Output, error) {
+	return a.run(ctx, input, false, nil)
+}
+
+// RunStreaming runs the agent using streaming LLM calls, passing loop
+// events to onEvent as they happen. onEvent may be nil.
+func (a *BaseAgent) RunStreaming(ctx context.Context, input *Input, onEvent EventHandler) (*Output, error) {
+	return a.run(ctx, input, true, onEvent)
+}
+
+// run is the agent loop behind Run and RunStreaming. Each turn calls the
+// LLM, then either returns the final answer or executes the requested
+// tools and continues with their results.
+func (a *BaseAgent) run(ctx context.Context, input *Input, stream bool, onEvent EventHandler) (output *Output, err error) {
 	// Create execution context
 	execCtx := NewExecutionContext(input.Logger)
 
+	emit := func(event Event) {
+		if onEvent != nil {
+			event.Agent = a.name
+			event.Turn = execCtx.CurrentTurn
+			onEvent(event)
+		}
+	}
+	defer func() {
+		emit(Event{Type: EventDone, Output: output, Err: err})
+	}()
+
 	// Add logger to context for sub-agents
 	ctx = WithLogger(ctx, input.Logger)
 
+	// Tag LLM calls with the agent name for routing
+	ctx = llm.WithAgentName(ctx, a.name)
+
+	// Account token usage under the calling agent, if any
+	ctx = a.startUsage(ctx, execCtx)
+
+	// Identify this agent to tools, e.g. as the owner of background sub-agents
+	ctx = WithAgent(ctx, a)
+
+	// Enforce the run's budget; sub-agents get a share of what remains.
+	// Summaries after the deadline use baseCtx, which is not bound to it.
+	budget := newRunBudget(a.config.Budget, input.Budget, execCtx.Usage)
+	ctx = withRunBudget(ctx, budget)
+	baseCtx := ctx
+	if !budget.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, budget.Deadline)
+		defer cancel()
+	}
+	deadlineHit := func() bool {
+		return errors.Is(ctx.Err(), context.DeadlineExceeded) && baseCtx.Err() == nil
+	}
+	interrupted := func() bool {
+		return errors.Is(ctx.Err(), context.Canceled)
+	}
+
+	if a.hooks != nil {
+		feedback, err := a.hooks.Trigger(ctx, a.hookData(ctx, hook.OnAgentStart).Set("task", input.Task))
+		if err != nil {
+			return nil, fmt.Errorf("agent start hook: %w", err)
+		}
+		if !feedback.Allow {
+			return nil, fmt.Errorf("agent run %w: %s", hook.ErrDenied, feedback.Message)
+		}
+
+		defer func() {
+			data := a.hookData(baseCtx, hook.OnAgentEnd).
+				Set("task", input.Task).
+				Set("output", output).
+				Set("error", err)
+
+			// End hooks don't block, just trigger
+			_, _ = a.hooks.Trigger(baseCtx, data)
+		}()
+	}
+
 	// Log session start
 	execCtx.Logger.SessionStart(input.Task)
 
 	// Initialize message list
 	messages := make([]llm.Message, 0, len(input.Messages)+1)
 
-	// Add system prompt
-	if a.systemPrompt != "" {
+	// Add system prompt, with context refreshed for this run
+	if systemPrompt := a.buildSystemPrompt(); systemPrompt != "" {
 		messages = append(messages, llm.Message{
 			Role:    llm.RoleSystem,
-			Content: a.systemPrompt,
+			Content: systemPrompt,
 		})
 	}
 
@@ -88,6 +361,11 @@ func (a *BaseAgent) Run(ctx context.Context, input *Input) (*Output, error) {
 		})
 	}
 
+	structured, err := newStructuredOutput(input.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+
 	maxTurns := input.MaxTurns
 	if maxTurns == 0 {
 		maxTurns = a.config.MaxTurns
@@ -95,24 +373,66 @@ func (a *BaseAgent) Run(ctx context.Context, input *Input) (*Output, error) {
 	execCtx.TotalTurns = maxTurns
 
 	allToolCalls := make([]*tool.CallResult, 0)
+	loops := newLoopDetector(a.config.Loop)
 
 	// Agent run loop
 	for turn := 0; turn < maxTurns; turn++ {
+		if interrupted() {
+			return a.interrupt(messages, allToolCalls, execCtx), nil
+		}
 		execCtx.CurrentTurn = turn + 1
 
-		execCtx.Logger.Info("Turn %d: Calling LLM...", turn+1)
+		if stream {
+			execCtx.Logger.Info("Turn %d: Calling LLM (streaming)...", turn+1)
+		} else {
+			execCtx.Logger.Info("Turn %d: Calling LLM...", turn+1)
+		}
+		emit(Event{Type: EventTurnStart})
+
+		// Add messages that arrived since the last turn, e.g. results of
+		// background sub-agents
+		if pending := collectInbox(ctx); len(pending) > 0 {
+			execCtx.Logger.Info("Delivering %d pending message(s)", len(pending))
+			messages = append(messages, pending...)
+		}
+
+		if exhausted := budget.exhausted(); exhausted != "" {
+			execCtx.Logger.Error("Budget exhausted: %s", exhausted)
+			output := a.stopEarly(baseCtx, messages, allToolCalls, input, StopBudget, "You have used up the budget for this task: "+exhausted+".", execCtx, stream, emit)
+			output.StopDetail = exhausted
+			return output, nil
+		}
+
+		// Keep history within the context window
+		tools := a.toolRegistry.GetToolDefinitions()
+		messages = a.compactMessages(ctx, messages, tools, execCtx)
+
+		req := a.chatRequest(messages, tools, input, len(allToolCalls) > 0)
+		if err := a.beforeLLMCall(ctx, req, execCtx.CurrentTurn); err != nil {
+			execCtx.Logger.Error("%v", err)
+			return nil, err
+		}
 
 		// Call LLM
-		resp, err := a.llmClient.Chat(ctx, &llm.ChatRequest{
-			Messages:    messages,
-			Tools:       a.toolRegistry.GetToolDefinitions(),
-			Temperature: input.Temperature,
-			MaxTokens:   a.config.MaxTokens,
-		})
+		callStart := time.Now()
+		resp, err := a.callLLM(ctx, req, stream, emit)
+		if err != nil && deadlineHit() {
+			execCtx.Logger.Error("Budget exhausted: time budget used up during the LLM call")
+			output := a.stopEarly(baseCtx, messages, allToolCalls, input, StopBudget, "You have used up the time budget for this task.", execCtx, stream, emit)
+			output.StopDetail = "time budget used up during the LLM call"
+			return output, nil
+		}
+		if err != nil && interrupted() {
+			return a.interrupt(messages, allToolCalls, execCtx), nil
+		}
 		if err != nil {
-			execCtx.Logger.Error("LLM call failed: %v", err)
-			return nil, fmt.Errorf("LLM call failed: %w", err)
+			execCtx.Logger.Error("%v", err)
+			return nil, err
 		}
+		a.afterLLMCall(ctx, req, resp, execCtx.CurrentTurn, time.Since(callStart))
+
+		a.recordUsage(execCtx, resp)
+		emit(Event{Type: EventUsage, Usage: &resp.Usage})
 
 		// Add assistant message
 		messages = append(messages, resp.Message)
@@ -129,14 +449,26 @@ func (a *BaseAgent) Run(ctx context.Context, input *Input) (*Output, error) {
 
 		// Check if done
 		if resp.StopReason == llm.StopReasonStop {
-			execCtx.Logger.SessionEnd(
-				time.Since(execCtx.StartTime),
-				execCtx.ToolCallCount,
-			)
+			result, correction, err := structured.check(resp.Message.Content)
+			if err != nil {
+				execCtx.Logger.Error("Structured output invalid: %v", err)
+				return nil, err
+			}
+			if correction != nil {
+				execCtx.Logger.Info("Answer does not match the response schema, asking for a correction...")
+				messages = append(messages, *correction)
+				continue
+			}
+
+			execCtx.LogSessionEnd()
 			return &Output{
-				Messages:  messages,
-				Result:    resp.Message.Content,
-				ToolCalls: allToolCalls,
+				Messages:   messages,
+				Result:     resp.Message.Content,
+				ToolCalls:  allToolCalls,
+				Usage:      execCtx.Usage,
+				Turns:      len(execCtx.Usage.Turns),
+				Structured: result,
+				StopReason: StopCompleted,
 			}, nil
 		}
 
@@ -144,222 +476,273 @@ func (a *BaseAgent) Run(ctx context.Context, input *Input) (*Output, error) {
 		if resp.StopReason == llm.StopReasonToolCalls {
 			execCtx.Logger.Info("Executing %d tool call(s)...", len(resp.Message.ToolCalls))
 
-			toolResults, err := a.executeToolsWithLogging(ctx, resp.Message.ToolCalls, execCtx)
+			// Calls over the tool call budget are answered without running
+			calls, over := budget.allowToolCalls(resp.Message.ToolCalls)
+			if len(over) > 0 {
+				execCtx.Logger.Error("Budget exhausted: tool call budget of %d calls allows %d of %d call(s) this turn", budget.MaxToolCalls, len(calls), len(resp.Message.ToolCalls))
+			}
+
+			toolResults, err := a.executeToolsWithLogging(ctx, calls, execCtx)
+			if err != nil && interrupted() {
+				return a.interrupt(messages, allToolCalls, execCtx), nil
+			}
 			if err != nil {
 				execCtx.Logger.Error("Tool execution failed: %v", err)
 				return nil, fmt.Errorf("tool execution failed: %w", err)
 			}
 
 			allToolCalls = append(allToolCalls, toolResults...)
+			budget.toolCalls = len(allToolCalls)
+			for _, tc := range over {
+				toolResults = append(toolResults, budget.refusedResult(tc))
+			}
 
 			// Add tool result messages
 			for _, tr := range toolResults {
+				emit(Event{Type: EventToolResult, ToolResult: tr})
 				messages = append(messages, llm.Message{
 					Role:       llm.RoleTool,
 					ToolCallID: tr.CallID,
 					Content:    tr.Result.Output,
+					Parts:      tr.Result.Parts,
 					Name:       tr.ToolName,
 					Timestamp:  tr.EndTime,
 				})
 			}
 
+			// Keep the agent from burning its turns on the same calls
+			if d := loops.check(resp.Message.ToolCalls); d != nil {
+				a.reportLoop(ctx, execCtx, d)
+				if d.stop {
+					why := fmt.Sprintf("Your run was stopped: %v (you %s).", ErrToolLoop, d)
+					return a.stopEarly(baseCtx, messages, allToolCalls, input, StopLoop, why, execCtx, stream, emit), nil
+				}
+				messages = append(messages, d.note())
+			}
+
 			continue
 		}
 
 		// If stopped due to length limit
 		if resp.StopReason == llm.StopReasonLength {
-			execCtx.Logger.SessionEnd(
-				time.Since(execCtx.StartTime),
-				execCtx.ToolCallCount,
-			)
+			// Tool calls cut off mid-arguments are never run, so drop them
+			// to keep the history valid for a follow-up turn
+			messages[len(messages)-1].ToolCalls = nil
+
+			// A truncated answer rarely is valid JSON; never pass it off as
+			// the required structured result
+			var result json.RawMessage
+			if structured != nil {
+				if result, err = structured.validate(resp.Message.Content); err != nil {
+					execCtx.Logger.Error("Structured output cut off at the length limit: %v", err)
+					return nil, fmt.Errorf("%w: answer cut off at the length limit: %v", ErrInvalidStructuredOutput, err)
+				}
+			}
+
+			execCtx.LogSessionEnd()
 			return &Output{
-				Messages:  messages,
-				Result:    resp.Message.Content + "\n[Response truncated due to length limit]",
-				ToolCalls: allToolCalls,
+				Messages:   messages,
+				Result:     resp.Message.Content + "\n[Response truncated due to length limit]",
+				ToolCalls:  allToolCalls,
+				Usage:      execCtx.Usage,
+				Turns:      len(execCtx.Usage.Turns),
+				Structured: result,
+				StopReason: StopLength,
 			}, nil
 		}
 	}
 
-	execCtx.Logger.Error("Max turns exceeded")
-	return nil, fmt.Errorf("max turns (%d) exceeded", maxTurns)
+	execCtx.Logger.Error("Max turns (%d) reached before a final answer", maxTurns)
+	return a.stopEarly(baseCtx, messages, allToolCalls, input, StopMaxTurns, "You have reached the maximum number of turns for this task.", execCtx, stream, emit), nil
 }
 
-// executeToolsWithLogging executes tool calls with comprehensive logging
-// Uses the executor for parallel or sequential execution based on config
-func (a *BaseAgent) executeToolsWithLogging(
-	ctx context.Context,
-	toolCalls []*llm.ToolCall,
-	execCtx *ExecutionContext,
-) ([]*tool.CallResult, error) {
-	// Log all tool calls first
-	for _, tc := range toolCalls {
-		execCtx.LogToolCall(tc.Function.Name, tc.Function.Arguments)
+// interrupt ends a run whose context was cancelled, keeping the
+// conversation so far. Tool calls left without a result are answered with
+// InterruptedMarker, and the marker closes the conversation so that the
+// model knows on the next run that it was stopped.
+func (a *BaseAgent) interrupt(messages []llm.Message, toolCalls []*tool.CallResult, execCtx *ExecutionContext) *Output {
+	execCtx.Logger.Info("Interrupted")
+
+	answered := make(map[string]bool)
+	for _, msg := range messages {
+		if msg.Role == llm.RoleTool {
+			answered[msg.ToolCallID] = true
+		}
 	}
-
-	// Execute tools using executor (handles parallel/sequential/mixed execution)
-	results, err := a.toolExecutor.Execute(ctx, toolCalls)
-	if err != nil {
-		return nil, err
+	if len(messages) > 0 && messages[len(messages)-1].Role == llm.RoleAssistant {
+		for _, tc := range messages[len(messages)-1].ToolCalls {
+			if !answered[tc.ID] {
+				messages = append(messages, llm.Message{
+					Role:       llm.RoleTool,
+					ToolCallID: tc.ID,
+					Content:    InterruptedMarker,
+					Name:       tc.Function.Name,
+					Timestamp:  time.Now(),
+				})
+			}
+		}
 	}
-
-	// Log all results
-	for _, result := range results {
-		duration := result.EndTime.Sub(result.StartTime)
-		execCtx.LogToolResult(result.ToolName, result.Result.Success, result.Result.Output, duration)
+	messages = append(messages, llm.Message{Role: llm.RoleAssistant, Content: InterruptedMarker, Timestamp: time.Now()})
+
+	execCtx.LogSessionEnd()
+	return &Output{
+		Messages:   messages,
+		Result:     InterruptedMarker,
+		ToolCalls:  toolCalls,
+		Usage:      execCtx.Usage,
+		StopReason: StopInterrupted,
+		Turns:      len(execCtx.Usage.Turns),
 	}
-
-	return results, nil
 }
 
-// RunStreaming runs the agent with streaming output
-func (a *BaseAgent) RunStreaming(ctx context.Context, input *Input, streamChan chan<- string) (*Output, error) {
-	// Create execution context
-	execCtx := NewExecutionContext(input.Logger)
-
-	// Add logger to context for sub-agents
-	ctx = WithLogger(ctx, input.Logger)
-
-	// Log session start
-	execCtx.Logger.SessionStart(input.Task)
-
-	// Initialize message list
-	messages := make([]llm.Message, 0, len(input.Messages)+1)
-
-	// Add system prompt
-	if a.systemPrompt != "" {
-		messages = append(messages, llm.Message{
-			Role:    llm.RoleSystem,
-			Content: a.systemPrompt,
-		})
+// stopEarly ends a run that stopped before a final answer, returning the
+// work so far. why tells the model the reason. When the budget is used up,
+// or with Config.SummarizeOnStop, one more LLM call without tools asks the
+// model to summarise its progress for the result; otherwise the result is
+// the last thing the agent said.
+func (a *BaseAgent) stopEarly(ctx context.Context, messages []llm.Message, toolCalls []*tool.CallResult, input *Input, reason StopReason, why string, execCtx *ExecutionContext, stream bool, emit func(Event)) *Output {
+	output := &Output{
+		Messages:   messages,
+		ToolCalls:  toolCalls,
+		Usage:      execCtx.Usage,
+		StopReason: reason,
+		Turns:      len(execCtx.Usage.Turns),
 	}
 
-	// Add history messages
-	messages = append(messages, input.Messages...)
-
-	// Add user task
-	if input.Task != "" {
-		messages = append(messages, llm.Message{
-			Role:      llm.RoleUser,
-			Content:   input.Task,
-			Timestamp: time.Now(),
-		})
+	if a.config.SummarizeOnStop || reason == StopBudget {
+		if summary, ok := a.summarizeProgress(ctx, messages, input, why, execCtx, stream, emit); ok {
+			output.Messages = summary
+			output.Result = summary[len(summary)-1].Content
+			output.Turns = len(execCtx.Usage.Turns)
+			execCtx.LogSessionEnd()
+			return output
+		}
 	}
 
-	maxTurns := input.MaxTurns
-	if maxTurns == 0 {
-		maxTurns = a.config.MaxTurns
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == llm.RoleAssistant && messages[i].Content != "" {
+			output.Result = messages[i].Content
+			break
+		}
 	}
-	execCtx.TotalTurns = maxTurns
+	execCtx.LogSessionEnd()
+	return output
+}
 
-	allToolCalls := make([]*tool.CallResult, 0)
+// summarizeProgress makes a final LLM call without tools asking for a
+// summary of the run's progress. It returns the messages including the
+// summary, or false if the call failed.
+func (a *BaseAgent) summarizeProgress(ctx context.Context, messages []llm.Message, input *Input, why string, execCtx *ExecutionContext, stream bool, emit func(Event)) ([]llm.Message, bool) {
+	execCtx.CurrentTurn++
+	execCtx.Logger.Info("Turn %d: Asking for a summary of progress...", execCtx.CurrentTurn)
+	emit(Event{Type: EventTurnStart})
+
+	// The instruction goes last as a user message: system messages may be
+	// lifted into the system prompt by the provider
+	messages = append(messages, llm.Message{
+		Role: llm.RoleUser,
+		Content: why + " You cannot call tools anymore. " +
+			"Summarise your progress for the user: what you did, what you found, and what remains to be done.",
+		Timestamp: time.Now(),
+	})
+
+	// The tools stay defined since the history refers to them (Anthropic
+	// rejects tool_use blocks without tools), but may not be called
+	req := a.chatRequest(messages, a.toolRegistry.GetToolDefinitions(), input, true)
+	req.ToolChoice = &llm.ToolChoice{Mode: llm.ToolChoiceNone}
+	req.ResponseFormat = nil // The summary is for the user, not a schema-conforming answer
+	if err := a.beforeLLMCall(ctx, req, execCtx.CurrentTurn); err != nil {
+		execCtx.Logger.Error("Summary skipped: %v", err)
+		return nil, false
+	}
+	callStart := time.Now()
+	resp, err := a.callLLM(ctx, req, stream, emit)
+	if err != nil {
+		execCtx.Logger.Error("Summary failed: %v", err)
+		return nil, false
+	}
+	a.afterLLMCall(ctx, req, resp, execCtx.CurrentTurn, time.Since(callStart))
 
-	// Agent run loop
-	for turn := 0; turn < maxTurns; turn++ {
-		execCtx.CurrentTurn = turn + 1
+	a.recordUsage(execCtx, resp)
+	emit(Event{Type: EventUsage, Usage: &resp.Usage})
 
-		execCtx.Logger.Info("Turn %d: Calling LLM (streaming)...", turn+1)
+	if resp.Message.Content == "" {
+		return nil, false
+	}
+	execCtx.LogResponse(resp.Message.Content)
+	resp.Message.ToolCalls = nil // Never executed, so they must not stay in the history
+	return append(messages, resp.Message), true
+}
 
-		// Call LLM with streaming
-		reader, err := a.llmClient.ChatStream(ctx, &llm.ChatRequest{
-			Messages:    messages,
-			Tools:       a.toolRegistry.GetToolDefinitions(),
-			Temperature: input.Temperature,
-			MaxTokens:   a.config.MaxTokens,
-		})
+// callLLM makes the LLM call of a turn and returns the complete response.
+// Streaming calls emit reasoning, content and tool call events as deltas
+// arrive; plain calls emit the same events once the response is complete.
+func (a *BaseAgent) callLLM(ctx context.Context, req *llm.ChatRequest, stream bool, emit func(Event)) (*llm.ChatResponse, error) {
+	if !stream {
+		resp, err := a.llmClient.Chat(ctx, req)
 		if err != nil {
-			execCtx.Logger.Error("LLM streaming call failed: %v", err)
-			return nil, fmt.Errorf("LLM streaming call failed: %w", err)
+			return nil, fmt.Errorf("LLM call failed: %w", err)
 		}
 
-		// Stream content and accumulate message
-		accumulatedMsg := llm.Message{
-			Role:      llm.RoleAssistant,
-			Reason:    "",
-			Content:   "",
-			ToolCalls: nil,
+		if resp.Message.Reason != "" {
+			emit(Event{Type: EventReasoningDelta, Text: resp.Message.Reason})
 		}
-
-		for {
-			delta, err := reader.Recv()
-			if err != nil {
-				reader.Close()
-				execCtx.Logger.Error("Stream recv failed: %v", err)
-				return nil, fmt.Errorf("stream recv failed: %w", err)
-			}
-
-			if delta.Done {
-				break
-			}
-
-			// Accumulate and send reasoning to stream channel
-			if delta.Reason != "" {
-				accumulatedMsg.Reason += delta.Reason
-			}
-
-			// Send content to stream channel
-			if delta.Content != "" {
-				accumulatedMsg.Content += delta.Content
-				select {
-				case streamChan <- delta.Content:
-				case <-ctx.Done():
-					reader.Close()
-					return nil, ctx.Err()
-				}
-			}
-
-			// Accumulate tool calls
-			if len(delta.ToolCalls) > 0 {
-				accumulatedMsg.ToolCalls = delta.ToolCalls
-			}
+		if resp.Message.Content != "" {
+			emit(Event{Type: EventContentDelta, Text: resp.Message.Content})
+		}
+		for _, tc := range resp.Message.ToolCalls {
+			emit(Event{Type: EventToolCallStart, ToolCall: tc})
 		}
+		return resp, nil
+	}
 
-		reader.Close()
+	reader, err := a.llmClient.ChatStream(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("LLM streaming call failed: %w", err)
+	}
+	defer reader.Close()
 
-		// Add assistant message
-		messages = append(messages, accumulatedMsg)
+	acc := newStreamAccumulator()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		// Log reasoning if present
-		if accumulatedMsg.Reason != "" {
-			execCtx.LogReasoning(accumulatedMsg.Reason)
+		delta, err := reader.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("stream recv failed: %w", err)
 		}
 
-		// Check if done
-		if len(accumulatedMsg.ToolCalls) == 0 {
-			// No tool calls, we're done
-			execCtx.Logger.SessionEnd(
-				time.Since(execCtx.StartTime),
-				execCtx.ToolCallCount,
-			)
-			return &Output{
-				Messages:  messages,
-				Result:    accumulatedMsg.Content,
-				ToolCalls: allToolCalls,
-			}, nil
+		acc.add(delta, emit)
+		if delta.Done {
+			return acc.response(), nil
 		}
+	}
+}
 
-		// Handle tool calls
-		execCtx.Logger.Info("Executing %d tool call(s)...", len(accumulatedMsg.ToolCalls))
+// executeToolsWithLogging executes tool calls with comprehensive logging
+// Uses the executor for parallel or sequential execution based on config
+func (a *BaseAgent) executeToolsWithLogging(
+	ctx context.Context,
+	toolCalls []*llm.ToolCall,
+	execCtx *ExecutionContext,
+) ([]*tool.CallResult, error) {
+	// Log all tool calls first
+	for _, tc := range toolCalls {
+		execCtx.LogToolCall(tc.Function.Name, tc.Function.Arguments)
+	}
 
-		toolResults, err := a.executeToolsWithLogging(ctx, accumulatedMsg.ToolCalls, execCtx)
-		if err != nil {
-			execCtx.Logger.Error("Tool execution failed: %v", err)
-			return nil, fmt.Errorf("tool execution failed: %w", err)
-		}
+	// Execute tools using executor (handles parallel/sequential/mixed execution)
+	results, err := a.toolExecutor.Execute(ctx, toolCalls)
+	if err != nil {
+		return nil, err
+	}
 
-		allToolCalls = append(allToolCalls, toolResults...)
-
-		// Add tool result messages
-		for _, tr := range toolResults {
-			messages = append(messages, llm.Message{
-				Role:       llm.RoleTool,
-				ToolCallID: tr.CallID,
-				Content:    tr.Result.Output,
-				Name:       tr.ToolName,
-				Timestamp:  tr.EndTime,
-			})
-		}
+	// Log all results
+	for _, result := range results {
+		duration := result.EndTime.Sub(result.StartTime)
+		execCtx.LogToolResult(result.ToolName, result.Result.Success, result.Result.Output, duration)
 	}
 
-	execCtx.Logger.Error("Max turns exceeded")
-	return nil, fmt.Errorf("max turns (%d) exceeded", maxTurns)
+	return results, nil
 }
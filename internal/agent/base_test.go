@@ -0,0 +1,633 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"finta/internal/hook"
+	"finta/internal/llm"
+	"finta/internal/llm/anthropic"
+	"finta/internal/llm/cassette"
+	"finta/internal/logger"
+	"finta/internal/tool"
+)
+
+// globTool returns a fixed file listing
+type globTool struct{}
+
+func (t *globTool) Name() string          { return "glob" }
+func (t *globTool) Description() string   { return "Find files matching a pattern" }
+func (t *globTool) BestPractices() string { return "" }
+func (t *globTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"pattern": map[string]any{"type": "string"},
+		},
+		"required": []string{"pattern"},
+	}
+}
+func (t *globTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	return &tool.Result{Success: true, Output: "cmd/finta/main.go\ninternal/agent/base.go"}, nil
+}
+
+func TestRun_ReplaysRecordedToolLoop(t *testing.T) {
+	client, err := cassette.NewReplayer("testdata/glob_then_answer.json")
+	if err != nil {
+		t.Fatalf("Failed to load cassette: %v", err)
+	}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+
+	ag := NewBaseAgent("explore", "You explore codebases.", client, registry, nil)
+	out, err := ag.Run(context.Background(), &Input{
+		Task:   "Which Go files are there?",
+		Logger: logger.NewLogger(io.Discard, logger.LevelError),
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if out.Result != "There are two Go files: cmd/finta/main.go and internal/agent/base.go." {
+		t.Errorf("Unexpected result: %q", out.Result)
+	}
+	if len(out.ToolCalls) != 1 || out.ToolCalls[0].ToolName != "glob" {
+		t.Errorf("Expected one glob call, got %+v", out.ToolCalls)
+	}
+	if len(out.Usage.Turns) != 2 {
+		t.Errorf("Expected usage for 2 turns, got %d", len(out.Usage.Turns))
+	}
+}
+
+func TestRun_ToolChoiceAppliesUntilFirstToolCall(t *testing.T) {
+	client := &scriptedClient{model: "gpt-4o", responses: []*llm.ChatResponse{
+		{
+			Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: []*llm.ToolCall{
+				{ID: "call_1", Type: "function", Function: &llm.FunctionCall{Name: "glob", Arguments: `{"pattern":"*.go"}`}},
+			}},
+			StopReason: llm.StopReasonToolCalls,
+		},
+		stopResponse("done", 1, 1),
+	}}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+
+	parallel := false
+	ag := NewBaseAgent("explore", "", client, registry, &Config{
+		MaxTurns:          5,
+		ToolChoice:        &llm.ToolChoice{Mode: llm.ToolChoiceFunction, Name: "glob"},
+		ParallelToolCalls: &parallel,
+		TopP:              0.9,
+		Stop:              []string{"END"},
+	})
+	if _, err := ag.Run(context.Background(), &Input{
+		Task:   "find files",
+		Logger: logger.NewLogger(io.Discard, logger.LevelError),
+	}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(client.requests) != 2 {
+		t.Fatalf("Expected 2 LLM calls, got %d", len(client.requests))
+	}
+	first, second := client.requests[0], client.requests[1]
+	if first.ToolChoice == nil || first.ToolChoice.Name != "glob" {
+		t.Errorf("Expected first request to force glob, got %+v", first.ToolChoice)
+	}
+	if second.ToolChoice != nil {
+		t.Errorf("Expected tool choice to reset after the tool call, got %+v", second.ToolChoice)
+	}
+	for i, req := range client.requests {
+		if req.ParallelToolCalls == nil || *req.ParallelToolCalls || req.TopP != 0.9 || len(req.Stop) != 1 {
+			t.Errorf("Request %d missing sampling controls: %+v", i+1, req)
+		}
+	}
+}
+
+// streamClient streams queued delta sequences, one per call
+type streamClient struct {
+	streams [][]*llm.Delta
+}
+
+func (c *streamClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	return nil, io.EOF
+}
+
+func (c *streamClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	deltas := c.streams[0]
+	c.streams = c.streams[1:]
+	return &sliceStream{deltas: deltas}, nil
+}
+
+func (c *streamClient) Provider() string { return "test" }
+func (c *streamClient) Model() string    { return "gpt-4o" }
+
+type sliceStream struct {
+	deltas []*llm.Delta
+}
+
+func (s *sliceStream) Recv() (*llm.Delta, error) {
+	delta := s.deltas[0]
+	s.deltas = s.deltas[1:]
+	return delta, nil
+}
+
+func (s *sliceStream) Close() error { return nil }
+
+func TestRunStreaming_LengthStopMatchesRun(t *testing.T) {
+	client := &streamClient{streams: [][]*llm.Delta{{
+		{Content: "partial answer"},
+		{Done: true, StopReason: llm.StopReasonLength, Usage: &llm.Usage{PromptTokens: 10, CompletionTokens: 4, TotalTokens: 14}},
+	}}}
+	ag := NewBaseAgent("general", "", client, tool.NewRegistry(), nil)
+
+	out, err := ag.RunStreaming(context.Background(), &Input{
+		Task:   "answer",
+		Logger: logger.NewLogger(io.Discard, logger.LevelError),
+	}, nil)
+	if err != nil {
+		t.Fatalf("RunStreaming failed: %v", err)
+	}
+
+	if out.Result != "partial answer\n[Response truncated due to length limit]" {
+		t.Errorf("Expected truncation marker, got %q", out.Result)
+	}
+	if total, _ := out.Usage.Total(); total.TotalTokens != 14 {
+		t.Errorf("Expected usage from the final delta, got %+v", total)
+	}
+}
+
+func TestRunStreaming_KeepsThinkingBlocks(t *testing.T) {
+	thinking := []llm.ThinkingBlock{{Thinking: "hm", Signature: "sig"}, {Redacted: "opaque"}}
+	client := &streamClient{streams: [][]*llm.Delta{{
+		{Reason: "hm"},
+		{Content: "done"},
+		{Done: true, StopReason: llm.StopReasonStop, Thinking: thinking},
+	}}}
+	ag := NewBaseAgent("general", "", client, tool.NewRegistry(), nil)
+
+	out, err := ag.RunStreaming(context.Background(), &Input{
+		Task:   "answer",
+		Logger: logger.NewLogger(io.Discard, logger.LevelError),
+	}, nil)
+	if err != nil {
+		t.Fatalf("RunStreaming failed: %v", err)
+	}
+	if last := out.Messages[len(out.Messages)-1]; !reflect.DeepEqual(last.Thinking, thinking) {
+		t.Errorf("Expected the thinking blocks kept for replay, got %+v", last.Thinking)
+	}
+}
+
+func TestRun_LengthStopDropsTruncatedToolCalls(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{{
+		Message:    llm.Message{Role: llm.RoleAssistant, ToolCalls: globCall(1, `{"pat`)},
+		StopReason: llm.StopReasonLength,
+	}}}
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("general", "", client, registry, nil)
+
+	out, err := ag.Run(context.Background(), &Input{Task: "find Go files", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.StopReason != StopLength || len(out.ToolCalls) != 0 {
+		t.Fatalf("Expected a length stop without running tools, got %+v", out)
+	}
+	if last := out.Messages[len(out.Messages)-1]; len(last.ToolCalls) != 0 {
+		t.Errorf("Expected truncated tool calls dropped from the history, got %+v", last.ToolCalls)
+	}
+}
+
+func TestRunStreaming_EmitsEvents(t *testing.T) {
+	// The second call is streamed as separate chunks per tool call, the way
+	// OpenAI interleaves parallel calls
+	glob1 := &llm.ToolCall{ID: "call_1", Type: "function", Function: &llm.FunctionCall{Name: "glob", Arguments: `{"pattern":`}}
+	glob2 := &llm.ToolCall{ID: "call_2", Type: "function", Function: &llm.FunctionCall{Name: "glob", Arguments: `{"pattern":"*.md"}`}}
+	client := &streamClient{streams: [][]*llm.Delta{
+		{
+			{Reason: "look for files"},
+			{ToolCalls: []*llm.ToolCall{glob1}},
+			{ToolCalls: []*llm.ToolCall{glob2}},
+			{ToolCalls: []*llm.ToolCall{{ID: "call_1", Type: "function", Function: &llm.FunctionCall{Name: "glob", Arguments: `{"pattern":"*.go"}`}}}},
+			{Done: true, StopReason: llm.StopReasonToolCalls, Usage: &llm.Usage{TotalTokens: 5}},
+		},
+		{
+			{Content: "Found "},
+			{Content: "them."},
+			{Done: true, StopReason: llm.StopReasonStop, Usage: &llm.Usage{TotalTokens: 7}},
+		},
+	}}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("explore", "", client, registry, nil)
+
+	var events []Event
+	out, err := ag.RunStreaming(context.Background(), &Input{
+		Task:   "find files",
+		Logger: logger.NewLogger(io.Discard, logger.LevelError),
+	}, func(e Event) { events = append(events, e) })
+	if err != nil {
+		t.Fatalf("RunStreaming failed: %v", err)
+	}
+
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []EventType{
+		EventTurnStart, EventReasoningDelta,
+		EventToolCallStart, EventToolCallDelta, EventToolCallStart, EventToolCallDelta, EventToolCallDelta,
+		EventUsage, EventToolResult, EventToolResult,
+		EventTurnStart, EventContentDelta, EventContentDelta, EventUsage,
+		EventDone,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("Expected events %v, got %v", want, types)
+		}
+	}
+
+	if events[6].Text != `"*.go"}` || events[6].ToolCall.Function.Arguments != `{"pattern":"*.go"}` {
+		t.Errorf("Expected argument delta of the first call, got %+v", events[6])
+	}
+	if len(out.ToolCalls) != 2 {
+		t.Errorf("Expected both interleaved tool calls to run, got %d", len(out.ToolCalls))
+	}
+	if done := events[len(events)-1]; done.Output != out || done.Turn != 2 || done.Agent != "explore" {
+		t.Errorf("Unexpected done event: %+v", done)
+	}
+}
+
+func TestRun_RefreshesSystemContextEachRun(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		stopResponse("one", 1, 1),
+		stopResponse("two", 1, 1),
+	}}
+	ag := NewBaseAgent("general", "You help.", client, tool.NewRegistry(), nil)
+
+	runs := 0
+	ag.SetSystemContext(func() string {
+		runs++
+		return fmt.Sprintf("# Environment\n\nRun %d", runs)
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := ag.Run(context.Background(), &Input{Task: "hi", Logger: logger.NewLogger(io.Discard, logger.LevelError)}); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	}
+
+	for i, req := range client.requests {
+		want := fmt.Sprintf("You help.\n\n# Environment\n\nRun %d", i+1)
+		if got := req.Messages[0].Content; req.Messages[0].Role != llm.RoleSystem || got != want {
+			t.Errorf("Run %d: expected system prompt %q, got %q", i+1, want, got)
+		}
+	}
+}
+
+// ownerInbox delivers one message to a specific agent
+type ownerInbox struct {
+	owner   Agent
+	pending []llm.Message
+}
+
+func (i *ownerInbox) Collect(ctx context.Context) []llm.Message {
+	if GetAgentFromContext(ctx) != i.owner {
+		return nil
+	}
+	msgs := i.pending
+	i.pending = nil
+	return msgs
+}
+
+func TestRun_DeliversInboxMessagesAtTurnStart(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		stopResponse("done", 1, 1),
+	}}
+	ag := NewBaseAgent("general", "", client, tool.NewRegistry(), nil)
+
+	inbox := &ownerInbox{owner: ag, pending: []llm.Message{{Role: llm.RoleUser, Content: "[Background sub-agent explore-1 completed]"}}}
+	ctx := WithInbox(context.Background(), inbox)
+
+	output, err := ag.Run(ctx, &Input{Task: "hi", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	msgs := client.requests[0].Messages
+	if len(msgs) != 2 || msgs[1].Content != "[Background sub-agent explore-1 completed]" {
+		t.Fatalf("Expected the inbox message after the task, got %+v", msgs)
+	}
+	if len(output.Messages) != 3 {
+		t.Errorf("Expected the delivered message kept in the conversation, got %d messages", len(output.Messages))
+	}
+}
+
+func TestRun_DeliversQueuedUserMessagesAfterToolResults(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		{
+			Message:    llm.Message{Role: llm.RoleAssistant, ToolCalls: globCall(1, `{"pattern":"*.go"}`)},
+			StopReason: llm.StopReasonToolCalls,
+		},
+		stopResponse("Looking in pkg/foo instead.", 1, 1),
+	}}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("general", "", client, registry, nil)
+
+	// The user types while the first turn is in progress
+	queue := NewMessageQueue()
+	manager := hook.NewManager()
+	manager.Register(&funcHandler{
+		points: []hook.HookPoint{hook.AfterLLMCall},
+		handle: func(data *hook.HookData) *hook.Feedback {
+			if data.Get("turn") == 1 {
+				queue.Push("stop, look in pkg/foo instead")
+			}
+			return hook.AllowFeedback()
+		},
+	})
+	ag.SetHookManager(manager)
+
+	if _, err := ag.Run(WithInbox(context.Background(), queue), &Input{Task: "find it", Logger: logger.NewLogger(io.Discard, logger.LevelError)}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	msgs := client.requests[1].Messages
+	if len(msgs) != 4 || msgs[2].Role != llm.RoleTool {
+		t.Fatalf("Expected the queued message after the tool result, got %+v", msgs)
+	}
+	if last := msgs[3]; last.Role != llm.RoleUser || !strings.HasSuffix(last.Content, "stop, look in pkg/foo instead") {
+		t.Errorf("Expected the queued user message, got %+v", last)
+	}
+
+	// Sub-agents leave queued messages to the top-level agent
+	queue.Push("later")
+	if msgs := queue.Collect(WithNestingDepth(context.Background(), 1)); len(msgs) != 0 {
+		t.Errorf("Expected nothing for a sub-agent, got %+v", msgs)
+	}
+}
+
+// funcHandler handles hook points with a function
+type funcHandler struct {
+	points []hook.HookPoint
+	handle func(data *hook.HookData) *hook.Feedback
+}
+
+func (h *funcHandler) Name() string             { return "func" }
+func (h *funcHandler) Points() []hook.HookPoint { return h.points }
+func (h *funcHandler) Priority() int            { return 0 }
+func (h *funcHandler) Handle(ctx context.Context, data *hook.HookData) (*hook.Feedback, error) {
+	return h.handle(data), nil
+}
+
+func TestRun_TriggersLifecycleAndLLMHooks(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		stopResponse("done", 1, 1),
+	}}
+	ag := NewBaseAgent("explore", "", client, tool.NewRegistry(), nil)
+
+	var fired []string
+	var endOutput *Output
+	manager := hook.NewManager()
+	manager.Register(&funcHandler{
+		points: []hook.HookPoint{hook.OnAgentStart, hook.OnAgentEnd, hook.BeforeLLMCall, hook.AfterLLMCall},
+		handle: func(data *hook.HookData) *hook.Feedback {
+			fired = append(fired, fmt.Sprintf("%s %s@%d", data.Point, data.GetString("agent"), data.Get("depth")))
+			switch data.Point {
+			case hook.BeforeLLMCall:
+				// Redact the task before it is sent
+				messages := data.Get("messages").([]llm.Message)
+				redacted := append([]llm.Message(nil), messages...)
+				redacted[len(redacted)-1].Content = "[redacted]"
+				return &hook.Feedback{Allow: true, Modified: redacted}
+			case hook.OnAgentEnd:
+				endOutput, _ = data.Get("output").(*Output)
+			}
+			return hook.AllowFeedback()
+		},
+	})
+	ag.SetHookManager(manager)
+
+	ctx := WithNestingDepth(context.Background(), 1)
+	output, err := ag.Run(ctx, &Input{Task: "secret task", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := "on_agent_start explore@1,before_llm_call explore@1,after_llm_call explore@1,on_agent_end explore@1"
+	if got := strings.Join(fired, ","); got != want {
+		t.Errorf("Expected hooks %s, got %s", want, got)
+	}
+	if got := client.requests[0].Messages[0].Content; got != "[redacted]" {
+		t.Errorf("Expected the modified messages sent, got %q", got)
+	}
+	if output.Messages[0].Content != "secret task" {
+		t.Errorf("Expected the conversation unchanged, got %q", output.Messages[0].Content)
+	}
+	if endOutput != output {
+		t.Errorf("Expected OnAgentEnd to receive the output")
+	}
+}
+
+func TestRun_BeforeLLMCallCanVeto(t *testing.T) {
+	client := &scriptedClient{model: "m"}
+	ag := NewBaseAgent("general", "", client, tool.NewRegistry(), nil)
+
+	manager := hook.NewManager()
+	manager.Register(&funcHandler{
+		points: []hook.HookPoint{hook.BeforeLLMCall},
+		handle: func(data *hook.HookData) *hook.Feedback { return hook.DenyFeedback("over budget") },
+	})
+	ag.SetHookManager(manager)
+
+	_, err := ag.Run(context.Background(), &Input{Task: "hi", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if !errors.Is(err, hook.ErrDenied) || !strings.Contains(err.Error(), "over budget") {
+		t.Fatalf("Expected a denied error, got %v", err)
+	}
+	if len(client.requests) != 0 {
+		t.Errorf("Expected no LLM call, got %d", len(client.requests))
+	}
+}
+
+// toolsDisabled reports whether a request keeps its tools but forbids calling them
+func toolsDisabled(req *llm.ChatRequest) bool {
+	return len(req.Tools) > 0 && req.ToolChoice != nil && req.ToolChoice.Mode == llm.ToolChoiceNone
+}
+
+func TestRun_MaxTurnsReturnsPartialOutput(t *testing.T) {
+	for _, summarize := range []bool{false, true} {
+		t.Run(fmt.Sprintf("summarize=%v", summarize), func(t *testing.T) {
+			client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+				{
+					Message: llm.Message{Role: llm.RoleAssistant, Content: "Looking for Go files.",
+						ToolCalls: globCall(1, `{"pattern":"*.go"}`)},
+					StopReason: llm.StopReasonToolCalls,
+				},
+				stopResponse("Found main.go; still need to read it.", 1, 1),
+			}}
+
+			registry := tool.NewRegistry()
+			registry.Register(&globTool{})
+			cfg := &Config{MaxTurns: 1, SummarizeOnStop: summarize}
+			ag := NewBaseAgent("general", "", client, registry, cfg)
+
+			output, err := ag.Run(context.Background(), &Input{Task: "read the Go files", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if output.StopReason != StopMaxTurns || len(output.ToolCalls) != 1 {
+				t.Fatalf("Expected a partial output stopped at max turns, got %+v", output)
+			}
+			if output.Turns != len(client.requests) {
+				t.Errorf("Expected %d turns, got %d", len(client.requests), output.Turns)
+			}
+
+			if !summarize {
+				if len(client.requests) != 1 || output.Result != "Looking for Go files." || len(output.Messages) != 3 {
+					t.Errorf("Expected the last assistant text without a summary call, got %q (%d calls)", output.Result, len(client.requests))
+				}
+				return
+			}
+
+			if len(client.requests) != 2 || !toolsDisabled(client.requests[1]) {
+				t.Fatalf("Expected a tool-less summary call, got %d calls", len(client.requests))
+			}
+			if output.Result != "Found main.go; still need to read it." {
+				t.Errorf("Expected the summary as result, got %q", output.Result)
+			}
+			if last := output.Messages[len(output.Messages)-1]; last.Role != llm.RoleAssistant {
+				t.Errorf("Expected the summary kept in the conversation, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestRun_SummaryTurnIsValidForAnthropic(t *testing.T) {
+	var bodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			fmt.Fprint(w, `{"id":"msg_1","role":"assistant","stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5},
+				"content":[{"type":"tool_use","id":"tu_1","name":"glob","input":{"pattern":"*.go"}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"msg_2","role":"assistant","stop_reason":"end_turn","usage":{"input_tokens":20,"output_tokens":5},
+			"content":[{"type":"text","text":"Found main.go; still need to read it."}]}`)
+	}))
+	defer server.Close()
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	cfg := &Config{MaxTurns: 1, SummarizeOnStop: true}
+	ag := NewBaseAgent("general", "Be brief.", anthropic.NewClient("key", "claude-test", server.URL), registry, cfg)
+
+	output, err := ag.Run(context.Background(), &Input{Task: "read the Go files", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if output.Result != "Found main.go; still need to read it." || len(bodies) != 2 {
+		t.Fatalf("Expected the summary as result after 2 calls, got %q after %d", output.Result, len(bodies))
+	}
+
+	// The history has tool_use blocks, so the tools must still be defined
+	summary := bodies[1]
+	if tools, _ := summary["tools"].([]any); len(tools) != 1 {
+		t.Errorf("Expected the tools kept in the summary request, got %v", summary["tools"])
+	}
+	if choice, _ := summary["tool_choice"].(map[string]any); choice["type"] != "none" {
+		t.Errorf("Expected tool_choice none, got %v", summary["tool_choice"])
+	}
+	if system, _ := summary["system"].(string); strings.Contains(system, "Summarise") {
+		t.Errorf("Expected the instruction to stay out of the system prompt, got %q", system)
+	}
+
+	// The instruction comes last, after the tool result
+	msgs := summary["messages"].([]any)
+	last := msgs[len(msgs)-1].(map[string]any)
+	blocks := last["content"].([]any)
+	first, final := blocks[0].(map[string]any), blocks[len(blocks)-1].(map[string]any)
+	if last["role"] != "user" || first["type"] != "tool_result" || !strings.Contains(fmt.Sprint(final["text"]), "Summarise your progress") {
+		t.Errorf("Expected the tool result followed by the instruction, got %v", last)
+	}
+}
+
+func TestRun_InterruptKeepsConversationWithMarker(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		{
+			Message:    llm.Message{Role: llm.RoleAssistant, ToolCalls: globCall(1, `{"pattern":"*.go"}`)},
+			StopReason: llm.StopReasonToolCalls,
+		},
+		stopResponse("never reached", 1, 1),
+	}}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("general", "", client, registry, nil)
+
+	// Interrupt while the first turn's tools run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := hook.NewManager()
+	manager.Register(&funcHandler{
+		points: []hook.HookPoint{hook.AfterLLMCall},
+		handle: func(data *hook.HookData) *hook.Feedback {
+			cancel()
+			return hook.AllowFeedback()
+		},
+	})
+	ag.SetHookManager(manager)
+
+	output, err := ag.Run(ctx, &Input{Task: "find Go files", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if output.StopReason != StopInterrupted || len(client.requests) != 1 {
+		t.Fatalf("Expected an interrupted run after one call, got %s after %d", output.StopReason, len(client.requests))
+	}
+
+	roles := make([]string, len(output.Messages))
+	for i, msg := range output.Messages {
+		roles[i] = string(msg.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,assistant,tool,assistant" {
+		t.Fatalf("Expected the tool result kept, got %s", got)
+	}
+	if last := output.Messages[len(output.Messages)-1]; last.Content != InterruptedMarker {
+		t.Errorf("Expected the interrupted marker, got %q", last.Content)
+	}
+}
+
+func TestRun_InterruptBeforeFirstTurnWithoutMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ag := NewBaseAgent("general", "", &scriptedClient{model: "m"}, tool.NewRegistry(), nil)
+	output, err := ag.Run(ctx, &Input{Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if output.StopReason != StopInterrupted || len(output.Messages) != 1 || output.Messages[0].Content != InterruptedMarker {
+		t.Errorf("Expected only the interrupted marker, got %+v", output.Messages)
+	}
+}
@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"finta/internal/llm"
+	"finta/internal/tool"
+)
+
+// BudgetContextKey is the context key for the budget of the running agent,
+// from which sub-agents get their share
+const BudgetContextKey ContextKey = "budget"
+
+// SubAgentBudgetShare is the fraction of the remaining budget that the
+// sub-agents started together by one tool call share
+const SubAgentBudgetShare = 0.5
+
+// Budget limits the resources of a run. Zero fields are unlimited. When a
+// limit is reached the run ends with a summary of its progress and
+// StopBudget. Tokens and cost are checked between LLM calls, so a run may
+// overshoot them by its last turn; tool calls over the limit are not run.
+type Budget struct {
+	MaxTotalTokens int           // Tokens of all LLM calls, including sub-agents
+	MaxCost        float64       // Cost in USD, including sub-agents
+	MaxDuration    time.Duration // Wall-clock time from the start of the run
+	Deadline       time.Time     // Time by which the run must end
+	MaxToolCalls   int           // Tool calls of the agent itself
+}
+
+// IsZero reports whether the budget has no limits
+func (b Budget) IsZero() bool {
+	return b == Budget{}
+}
+
+// tighter returns the stricter of each limit of b and o
+func (b Budget) tighter(o Budget) Budget {
+	minPositive := func(x, y int) int {
+		if x <= 0 || (y > 0 && y < x) {
+			return y
+		}
+		return x
+	}
+	if o.MaxCost > 0 && (b.MaxCost <= 0 || o.MaxCost < b.MaxCost) {
+		b.MaxCost = o.MaxCost
+	}
+	if o.MaxDuration > 0 && (b.MaxDuration <= 0 || o.MaxDuration < b.MaxDuration) {
+		b.MaxDuration = o.MaxDuration
+	}
+	if !o.Deadline.IsZero() && (b.Deadline.IsZero() || o.Deadline.Before(b.Deadline)) {
+		b.Deadline = o.Deadline
+	}
+	b.MaxTotalTokens = minPositive(b.MaxTotalTokens, o.MaxTotalTokens)
+	b.MaxToolCalls = minPositive(b.MaxToolCalls, o.MaxToolCalls)
+	return b
+}
+
+// runBudget tracks a run's consumption of its budget
+type runBudget struct {
+	Budget    // MaxDuration is resolved into Deadline
+	usage     *Usage
+	toolCalls int
+	refused   int // Tool calls not run since they were over the limit
+}
+
+// newRunBudget resolves the budget of a run starting now, combining the
+// agent's configured budget with the one of the input
+func newRunBudget(configured, input Budget, usage *Usage) *runBudget {
+	b := configured.tighter(input)
+	if b.MaxDuration > 0 {
+		b = b.tighter(Budget{Deadline: time.Now().Add(b.MaxDuration)})
+		b.MaxDuration = 0
+	}
+	return &runBudget{Budget: b, usage: usage}
+}
+
+// exhausted describes the first limit the run has reached, saying whether
+// it was exceeded or hit exactly, or returns ""
+func (r *runBudget) exhausted() string {
+	tokens, cost := r.usage.Total()
+	switch {
+	case r.MaxTotalTokens > 0 && tokens.TotalTokens > r.MaxTotalTokens:
+		return fmt.Sprintf("token budget of %d tokens exceeded (%d used)", r.MaxTotalTokens, tokens.TotalTokens)
+	case r.MaxTotalTokens > 0 && tokens.TotalTokens == r.MaxTotalTokens:
+		return fmt.Sprintf("token budget of %d tokens used up", r.MaxTotalTokens)
+	case r.MaxCost > 0 && cost > r.MaxCost:
+		return fmt.Sprintf("cost budget of $%.4f exceeded ($%.4f spent)", r.MaxCost, cost)
+	case r.MaxCost > 0 && cost == r.MaxCost:
+		return fmt.Sprintf("cost budget of $%.4f used up", r.MaxCost)
+	case !r.Deadline.IsZero() && !time.Now().Before(r.Deadline):
+		return fmt.Sprintf("time budget used up (deadline %s)", r.Deadline.Format(time.TimeOnly))
+	case r.MaxToolCalls > 0 && r.refused > 0:
+		return fmt.Sprintf("tool call budget of %d calls exceeded (%d more requested and not run)", r.MaxToolCalls, r.refused)
+	case r.MaxToolCalls > 0 && r.toolCalls >= r.MaxToolCalls:
+		return fmt.Sprintf("tool call budget of %d calls used up", r.MaxToolCalls)
+	}
+	return ""
+}
+
+// allowToolCalls splits a turn's tool calls into those the tool call
+// budget still allows and those over it, which are not run
+func (r *runBudget) allowToolCalls(calls []*llm.ToolCall) (allowed, over []*llm.ToolCall) {
+	if r.MaxToolCalls <= 0 {
+		return calls, nil
+	}
+	left := max(r.MaxToolCalls-r.toolCalls, 0)
+	if len(calls) <= left {
+		return calls, nil
+	}
+	r.refused += len(calls) - left
+	return calls[:left], calls[left:]
+}
+
+// refusedResult is the result given for a tool call over the budget
+func (r *runBudget) refusedResult(tc *llm.ToolCall) *tool.CallResult {
+	msg := fmt.Sprintf("Not run: the tool call budget of %d calls for this task is used up.", r.MaxToolCalls)
+	now := time.Now()
+	return &tool.CallResult{
+		ToolName:  tc.Function.Name,
+		CallID:    tc.ID,
+		Params:    []byte(tc.Function.Arguments),
+		Result:    &tool.Result{Success: false, Output: msg, Error: msg},
+		StartTime: now,
+		EndTime:   now,
+	}
+}
+
+// remaining returns what is left of the budget. Used-up limits are kept
+// at a minimal positive amount, since zero would mean unlimited.
+func (r *runBudget) remaining() Budget {
+	tokens, cost := r.usage.Total()
+	left := Budget{Deadline: r.Deadline}
+	if r.MaxTotalTokens > 0 {
+		left.MaxTotalTokens = max(r.MaxTotalTokens-tokens.TotalTokens, 1)
+	}
+	if r.MaxCost > 0 {
+		left.MaxCost = math.Max(r.MaxCost-cost, math.SmallestNonzeroFloat64)
+	}
+	if r.MaxToolCalls > 0 {
+		left.MaxToolCalls = max(r.MaxToolCalls-r.toolCalls, 1)
+	}
+	return left
+}
+
+// withRunBudget adds a run's budget to the context
+func withRunBudget(ctx context.Context, budget *runBudget) context.Context {
+	return context.WithValue(ctx, BudgetContextKey, budget)
+}
+
+// SubAgentBudget returns the budget for one of n sub-agents started
+// together by the agent running under ctx: an even split of
+// SubAgentBudgetShare of its remaining budget, with the same deadline.
+// It is zero when the running agent has no budget.
+func SubAgentBudget(ctx context.Context, n int) Budget {
+	r, ok := ctx.Value(BudgetContextKey).(*runBudget)
+	if !ok || r.IsZero() {
+		return Budget{}
+	}
+
+	left := r.remaining()
+	share := SubAgentBudgetShare / float64(max(n, 1))
+
+	b := Budget{Deadline: left.Deadline}
+	if left.MaxTotalTokens > 0 {
+		b.MaxTotalTokens = max(int(float64(left.MaxTotalTokens)*share), 1)
+	}
+	if left.MaxCost > 0 {
+		b.MaxCost = math.Max(left.MaxCost*share, math.SmallestNonzeroFloat64)
+	}
+	if left.MaxToolCalls > 0 {
+		b.MaxToolCalls = max(int(float64(left.MaxToolCalls)*share), 1)
+	}
+	return b
+}
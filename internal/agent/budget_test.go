@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"finta/internal/llm"
+	"finta/internal/logger"
+	"finta/internal/tool"
+)
+
+func TestRun_TokenBudgetStopsWithSummary(t *testing.T) {
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		{
+			Message:    llm.Message{Role: llm.RoleAssistant, ToolCalls: globCall(1, `{"pattern":"*.go"}`)},
+			StopReason: llm.StopReasonToolCalls,
+			Usage:      llm.Usage{PromptTokens: 900, CompletionTokens: 200, TotalTokens: 1100},
+		},
+		stopResponse("Found main.go; ran out of budget before reading it.", 1, 1),
+	}}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("general", "", client, registry, &Config{MaxTurns: 5, Budget: Budget{MaxTotalTokens: 1000}})
+
+	output, err := ag.Run(context.Background(), &Input{Task: "read the Go files", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if output.StopReason != StopBudget || output.Result != "Found main.go; ran out of budget before reading it." {
+		t.Fatalf("Expected a summary stopped by the budget, got %+v", output)
+	}
+	if output.StopDetail != "token budget of 1000 tokens exceeded (1100 used)" {
+		t.Errorf("Expected the overshoot in the stop detail, got %q", output.StopDetail)
+	}
+	if len(client.requests) != 2 || !toolsDisabled(client.requests[1]) {
+		t.Fatalf("Expected a tool-less summary call, got %d calls", len(client.requests))
+	}
+	msgs := client.requests[1].Messages
+	if note := msgs[len(msgs)-1]; note.Role != llm.RoleUser || !strings.Contains(note.Content, "token budget of 1000 tokens exceeded (1100 used)") {
+		t.Errorf("Expected the exhausted limit in the summary note, got %+v", note)
+	}
+}
+
+func TestRun_ToolCallBudgetCheckedPerCall(t *testing.T) {
+	calls := append(globCall(1, `{"pattern":"*.go"}`), globCall(2, `{"pattern":"*.md"}`)...)
+	calls = append(calls, globCall(3, `{"pattern":"*.yaml"}`)...)
+	client := &scriptedClient{model: "m", responses: []*llm.ChatResponse{
+		{
+			Message:    llm.Message{Role: llm.RoleAssistant, ToolCalls: calls},
+			StopReason: llm.StopReasonToolCalls,
+		},
+		stopResponse("Found the Go and Markdown files.", 1, 1),
+	}}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("general", "", client, registry, &Config{MaxTurns: 5, Budget: Budget{MaxToolCalls: 2}})
+
+	output, err := ag.Run(context.Background(), &Input{Task: "list the files", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if output.StopReason != StopBudget || len(output.ToolCalls) != 2 {
+		t.Fatalf("Expected a stop by the budget after 2 tool calls, got %s with %d", output.StopReason, len(output.ToolCalls))
+	}
+	if output.StopDetail != "tool call budget of 2 calls exceeded (1 more requested and not run)" {
+		t.Errorf("Expected the overshoot in the stop detail, got %q", output.StopDetail)
+	}
+
+	// The call over the budget is answered without running
+	msgs := client.requests[1].Messages
+	refused := msgs[len(msgs)-2]
+	if refused.Role != llm.RoleTool || refused.ToolCallID != "call_3" || !strings.HasPrefix(refused.Content, "Not run") {
+		t.Errorf("Expected call_3 refused, got %+v", refused)
+	}
+}
+
+func TestSubAgentBudget_SharesRemainder(t *testing.T) {
+	if b := SubAgentBudget(context.Background(), 2); !b.IsZero() {
+		t.Errorf("Expected no budget without a running agent, got %+v", b)
+	}
+
+	usage := NewUsage("general")
+	usage.AddTurn(1, "m", llm.Usage{TotalTokens: 2000}, nil)
+	deadline := time.Now().Add(time.Minute)
+	r := newRunBudget(Budget{MaxTotalTokens: 10000, MaxToolCalls: 50}, Budget{MaxToolCalls: 20, Deadline: deadline}, usage)
+	r.toolCalls = 4
+
+	b := SubAgentBudget(withRunBudget(context.Background(), r), 2)
+	want := Budget{MaxTotalTokens: 2000, MaxToolCalls: 4, Deadline: deadline}
+	if b != want {
+		t.Errorf("Expected %+v, got %+v", want, b)
+	}
+}
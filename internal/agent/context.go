@@ -16,6 +16,8 @@ const (
 	LoggerContextKey ContextKey = "logger"
 	// NestingDepthKey is the context key for tracking sub-agent nesting depth
 	NestingDepthKey ContextKey = "nesting_depth"
+	// AgentContextKey is the context key for the agent whose run is in progress
+	AgentContextKey ContextKey = "agent"
 )
 
 // ExecutionContext tracks the execution state of an agent and provides logging utilities
@@ -25,6 +27,7 @@ type ExecutionContext struct {
 	CurrentTurn   int
 	TotalTurns    int
 	ToolCallCount int
+	Usage         *Usage
 }
 
 // NewExecutionContext creates a new execution context with the given logger
@@ -56,6 +59,22 @@ func (ctx *ExecutionContext) LogResponse(content string) {
 	ctx.Logger.AgentResponse(content)
 }
 
+// LogSessionEnd logs the completion of the session with its duration,
+// tool call count and token usage (including sub-agents)
+func (ctx *ExecutionContext) LogSessionEnd() {
+	var usage logger.TokenUsage
+	if ctx.Usage != nil {
+		total, cost := ctx.Usage.Total()
+		usage = logger.TokenUsage{
+			PromptTokens:     total.PromptTokens,
+			CompletionTokens: total.CompletionTokens,
+			Cost:             cost,
+			Unpriced:         ctx.Usage.HasUnpriced(),
+		}
+	}
+	ctx.Logger.SessionEnd(time.Since(ctx.StartTime), ctx.ToolCallCount, usage)
+}
+
 // LogProgress logs the current progress (turn X of Y)
 func (ctx *ExecutionContext) LogProgress() {
 	ctx.Logger.Progress(ctx.CurrentTurn, ctx.TotalTurns,
@@ -87,3 +106,16 @@ func GetNestingDepth(ctx context.Context) int {
 func WithNestingDepth(ctx context.Context, depth int) context.Context {
 	return context.WithValue(ctx, NestingDepthKey, depth)
 }
+
+// GetAgentFromContext retrieves the agent whose run is in progress
+func GetAgentFromContext(ctx context.Context) Agent {
+	if a, ok := ctx.Value(AgentContextKey).(Agent); ok {
+		return a
+	}
+	return nil
+}
+
+// WithAgent adds the agent whose run is in progress to the context
+func WithAgent(ctx context.Context, a Agent) context.Context {
+	return context.WithValue(ctx, AgentContextKey, a)
+}
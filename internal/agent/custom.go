@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"finta/internal/tool"
+)
+
+// Definition declares a custom agent type, e.g. loaded from .finta/agents
+type Definition struct {
+	Name        string
+	Description string // Shown to the model when choosing a Task sub-agent
+	Prompt      string // System prompt
+
+	// Tools lists the tool names or glob patterns (e.g. "mcp_github_*")
+	// the agent may use; empty allows all tools
+	Tools []string
+
+	Model         string // Empty uses the factory's default client
+	Temperature   *float32
+	MaxTokens     int
+	MaxTurns      int
+	ExecutionMode tool.ExecutionMode // Empty uses mixed mode
+}
+
+// AgentTypeInfo describes an agent type a factory can create
+type AgentTypeInfo struct {
+	Type        AgentType
+	Description string
+}
+
+// builtinTypes are the agent types with built-in prompts, in display order
+var builtinTypes = []AgentTypeInfo{
+	{AgentTypeGeneral, "All-purpose agent with all tools"},
+	{AgentTypeExplore, "Code exploration and search with read-only tools"},
+	{AgentTypePlan, "Implementation planning with read and glob"},
+	{AgentTypeExecute, "Task execution with all tools"},
+}
+
+// RegisterAgent adds a custom agent type. Its name must not clash with a
+// built-in or previously registered type.
+func (f *DefaultFactory) RegisterAgent(def Definition) error {
+	if def.Name == "" {
+		return fmt.Errorf("custom agent name cannot be empty")
+	}
+	if def.Prompt == "" {
+		return fmt.Errorf("custom agent %s: prompt cannot be empty", def.Name)
+	}
+	for _, info := range builtinTypes {
+		if AgentType(def.Name) == info.Type {
+			return fmt.Errorf("custom agent %s: name is taken by a built-in agent type", def.Name)
+		}
+	}
+	for _, pattern := range def.Tools {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("custom agent %s: invalid tool pattern %q: %w", def.Name, pattern, err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.custom[AgentType(def.Name)]; ok {
+		return fmt.Errorf("custom agent %s is already registered", def.Name)
+	}
+	f.custom[AgentType(def.Name)] = def
+	return nil
+}
+
+// AgentTypes returns the built-in agent types followed by custom ones in
+// name order
+func (f *DefaultFactory) AgentTypes() []AgentTypeInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	types := append([]AgentTypeInfo(nil), builtinTypes...)
+
+	custom := make([]AgentTypeInfo, 0, len(f.custom))
+	for name, def := range f.custom {
+		custom = append(custom, AgentTypeInfo{Type: name, Description: def.Description})
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Type < custom[j].Type })
+
+	return append(types, custom...)
+}
+
+// customDefinition returns the definition of a custom agent type
+func (f *DefaultFactory) customDefinition(agentType AgentType) (Definition, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	def, ok := f.custom[agentType]
+	return def, ok
+}
+
+// createCustomAgent creates an agent from a custom definition
+func (f *DefaultFactory) createCustomAgent(def Definition) (Agent, error) {
+	registry := f.toolRegistry
+	if len(def.Tools) > 0 {
+		var err error
+		if registry, err = f.filterTools(def.Name, def.Tools); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{
+		Model:               def.Model,
+		Temperature:         0.7,
+		MaxTokens:           4096,
+		MaxTurns:            20,
+		EnableParallelTools: def.ExecutionMode != tool.ExecutionModeSequential,
+		ToolExecutionMode:   tool.ExecutionModeMixed,
+	}
+	if def.Temperature != nil {
+		cfg.Temperature = *def.Temperature
+	}
+	if def.MaxTokens > 0 {
+		cfg.MaxTokens = def.MaxTokens
+	}
+	if def.MaxTurns > 0 {
+		cfg.MaxTurns = def.MaxTurns
+	}
+	if def.ExecutionMode != "" {
+		cfg.ToolExecutionMode = def.ExecutionMode
+	}
+
+	// Best practices only cover the tools the agent can use
+	systemPrompt := f.buildSystemPromptFor(def.Prompt, registry)
+
+	return f.newAgent(AgentType(def.Name), systemPrompt, registry, cfg)
+}
+
+// filterTools returns a registry with the tools matching the given names or
+// glob patterns. Plain names must match a registered tool.
+func (f *DefaultFactory) filterTools(agentName string, patterns []string) (*tool.Registry, error) {
+	registry := tool.NewRegistry()
+	tools := f.toolRegistry.List()
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			t, err := f.toolRegistry.Get(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s agent requires tool '%s' but it's not registered: %w", agentName, pattern, err)
+			}
+			registry.Register(t) // Duplicates from overlapping patterns are ignored
+			continue
+		}
+
+		for _, t := range tools {
+			if ok, _ := path.Match(pattern, t.Name()); ok {
+				registry.Register(t)
+			}
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"finta/internal/llm"
+	"finta/internal/tool"
+)
+
+// EventType identifies an agent loop event
+type EventType string
+
+const (
+	EventTurnStart      EventType = "turn_start"      // An LLM call is about to be made
+	EventReasoningDelta EventType = "reasoning_delta" // Reasoning text from the model
+	EventContentDelta   EventType = "content_delta"   // Answer text from the model
+	EventToolCallStart  EventType = "tool_call_start" // The model began a tool call
+	EventToolCallDelta  EventType = "tool_call_delta" // The model extended a tool call's arguments
+	EventToolResult     EventType = "tool_result"     // A tool call finished
+	EventUsage          EventType = "usage"           // The turn's LLM call completed
+	EventDone           EventType = "done"            // The run finished
+)
+
+// Event is emitted by the agent loop as a run progresses.
+// Which fields are set depends on Type.
+type Event struct {
+	Type  EventType
+	Agent string
+	Turn  int
+
+	Text       string           // Reasoning or content delta, or a tool call's argument delta
+	ToolCall   *llm.ToolCall    // Tool call with the arguments received so far
+	ToolResult *tool.CallResult // Result of a finished tool call
+	Usage      *llm.Usage       // Usage of the turn's LLM call
+	Output     *Output          // Final output of a successful run
+	Err        error            // Error of a failed run
+}
+
+// EventHandler receives agent loop events. It is called synchronously
+// from the loop and should return quickly.
+type EventHandler func(Event)
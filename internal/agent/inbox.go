@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"finta/internal/llm"
+)
+
+// InboxContextKey is the context key for the inboxes agents collect
+// messages from
+const InboxContextKey ContextKey = "inbox"
+
+// Inbox supplies messages that are added to an agent's conversation at the
+// start of its next turn, e.g. results of background sub-agents that
+// finished in the meantime
+type Inbox interface {
+	// Collect returns and removes the messages pending for the agent
+	// running under ctx (see GetAgentFromContext)
+	Collect(ctx context.Context) []llm.Message
+}
+
+// WithInbox adds an inbox to the context. Agents running under the
+// context, including sub-agents, collect from all inboxes added.
+func WithInbox(ctx context.Context, inbox Inbox) context.Context {
+	existing, _ := ctx.Value(InboxContextKey).([]Inbox)
+	inboxes := append(append([]Inbox(nil), existing...), inbox)
+	return context.WithValue(ctx, InboxContextKey, inboxes)
+}
+
+// collectInbox returns the messages pending in all inboxes of the context
+func collectInbox(ctx context.Context) []llm.Message {
+	inboxes, _ := ctx.Value(InboxContextKey).([]Inbox)
+
+	var messages []llm.Message
+	for _, inbox := range inboxes {
+		messages = append(messages, inbox.Collect(ctx)...)
+	}
+	return messages
+}
+
+// MessageQueue holds messages the user sent while an agent was running. As
+// an inbox it delivers them to the top-level agent at its next turn, after
+// the tool results of the previous one, so the model can change course.
+// Sub-agents don't see them. Safe for concurrent use.
+type MessageQueue struct {
+	mu      sync.Mutex
+	pending []string
+}
+
+// NewMessageQueue creates an empty message queue
+func NewMessageQueue() *MessageQueue {
+	return &MessageQueue{}
+}
+
+// Push queues a message for the next turn
+func (q *MessageQueue) Push(text string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, text)
+}
+
+// Drain returns and removes the queued messages, e.g. those that arrived
+// after the agent's final answer
+func (q *MessageQueue) Drain() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// Collect implements Inbox for the top-level agent
+func (q *MessageQueue) Collect(ctx context.Context) []llm.Message {
+	if GetNestingDepth(ctx) > 0 {
+		return nil
+	}
+
+	var messages []llm.Message
+	for _, text := range q.Drain() {
+		messages = append(messages, llm.Message{
+			Role:      llm.RoleUser,
+			Content:   "[Message from the user while you were working]\n\n" + text,
+			Timestamp: time.Now(),
+		})
+	}
+	return messages
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"finta/internal/llm"
+)
+
+// ErrToolLoop is why a run ends with StopLoop: the agent kept repeating the
+// same tool calls after being told to change its approach
+var ErrToolLoop = errors.New("agent is stuck repeating the same tool calls")
+
+// Loop detection defaults
+const (
+	DefaultRepeatThreshold      = 3 // Turns with identical tool calls in a row
+	DefaultOscillationThreshold = 4 // Turns alternating between two sets of tool calls, e.g. A B A B
+	DefaultMaxLoopNotes         = 1 // Corrective notes before the run stops
+)
+
+// LoopConfig sets when BaseAgent treats tool calls repeated across turns as
+// a loop. On detection it adds a corrective system note to the
+// conversation; once MaxNotes notes did not help, the run stops early with
+// StopLoop, keeping its work so far. Zero values use the defaults.
+type LoopConfig struct {
+	Disabled             bool
+	RepeatThreshold      int
+	OscillationThreshold int
+	MaxNotes             int // -1 stops at the first detection
+}
+
+// LoopKind describes the pattern of a detected loop
+type LoopKind string
+
+const (
+	LoopRepeat      LoopKind = "repeat"      // The same tool calls turn after turn
+	LoopOscillation LoopKind = "oscillation" // Alternating between two sets of tool calls
+)
+
+// loopDetection describes a detected loop
+type loopDetection struct {
+	kind  LoopKind
+	turns int      // Turns the pattern lasted
+	tools []string // Tool names of the repeated calls
+	stop  bool     // No corrective notes remain
+}
+
+func (d *loopDetection) String() string {
+	tools := strings.Join(d.tools, ", ")
+	if d.kind == LoopOscillation {
+		return fmt.Sprintf("alternated between the same two sets of tool calls (%s) for %d turns", tools, d.turns)
+	}
+	return fmt.Sprintf("made the same tool calls (%s) with identical arguments %d turns in a row", tools, d.turns)
+}
+
+// note returns the corrective note for the detection. It is a user message:
+// system messages may be lifted into the system prompt by the provider and
+// are left out of saved sessions.
+func (d *loopDetection) note() llm.Message {
+	return llm.Message{
+		Role:      llm.RoleUser,
+		Timestamp: time.Now(),
+		Content: fmt.Sprintf("Note: you have %s without making progress. "+
+			"Repeating them will not give a different result. Stop and reconsider: "+
+			"check the previous results and errors, try a different tool, different arguments or a different approach, "+
+			"or answer with what you know so far and explain what is blocking you.", d),
+	}
+}
+
+// loopDetector tracks the tool calls of a run's turns
+type loopDetector struct {
+	cfg        LoopConfig
+	signatures []string   // Tool calls of each turn since the last detection
+	names      [][]string // Tool names of each turn
+	notes      int        // Corrective notes given
+}
+
+func newLoopDetector(cfg LoopConfig) *loopDetector {
+	if cfg.RepeatThreshold <= 0 {
+		cfg.RepeatThreshold = DefaultRepeatThreshold
+	}
+	if cfg.OscillationThreshold <= 0 {
+		cfg.OscillationThreshold = DefaultOscillationThreshold
+	}
+	if cfg.MaxNotes == 0 {
+		cfg.MaxNotes = DefaultMaxLoopNotes
+	}
+	return &loopDetector{cfg: cfg}
+}
+
+// check records the tool calls of a turn and reports a loop if the recent
+// turns repeat themselves
+func (l *loopDetector) check(calls []*llm.ToolCall) *loopDetection {
+	if l.cfg.Disabled || len(calls) == 0 {
+		return nil
+	}
+
+	signature, names := callSignature(calls)
+	l.signatures = append(l.signatures, signature)
+	l.names = append(l.names, names)
+
+	var d *loopDetection
+	if n := l.trailingRepeats(); n >= l.cfg.RepeatThreshold {
+		d = &loopDetection{kind: LoopRepeat, turns: n, tools: names}
+	} else if n := l.trailingAlternation(); n >= l.cfg.OscillationThreshold {
+		d = &loopDetection{kind: LoopOscillation, turns: n, tools: uniqueNames(names, l.names[len(l.names)-2])}
+	}
+	if d == nil {
+		return nil
+	}
+
+	// Give the model a fresh start after a note
+	l.signatures, l.names = nil, nil
+	if l.cfg.MaxNotes < 0 || l.notes >= l.cfg.MaxNotes {
+		d.stop = true
+	}
+	l.notes++
+	return d
+}
+
+// trailingRepeats counts the most recent turns with identical tool calls
+func (l *loopDetector) trailingRepeats() int {
+	last := len(l.signatures) - 1
+	n := 1
+	for i := last - 1; i >= 0 && l.signatures[i] == l.signatures[last]; i-- {
+		n++
+	}
+	return n
+}
+
+// trailingAlternation counts the most recent turns alternating between two
+// different sets of tool calls
+func (l *loopDetector) trailingAlternation() int {
+	last := len(l.signatures) - 1
+	if last < 1 || l.signatures[last] == l.signatures[last-1] {
+		return 0
+	}
+	n := 2
+	for i := last - 2; i >= 0 && l.signatures[i] == l.signatures[i+2]; i-- {
+		n++
+	}
+	return n
+}
+
+// callSignature identifies the tool calls of a turn regardless of their
+// order and of formatting differences in the arguments
+func callSignature(calls []*llm.ToolCall) (string, []string) {
+	parts := make([]string, len(calls))
+	var names []string
+	for i, tc := range calls {
+		args := tc.Function.Arguments
+		var v any
+		if err := json.Unmarshal([]byte(args), &v); err == nil {
+			if normalized, err := json.Marshal(v); err == nil { // Sorts object keys
+				args = string(normalized)
+			}
+		}
+		parts[i] = tc.Function.Name + " " + args
+		names = append(names, tc.Function.Name)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\n"), uniqueNames(names)
+}
+
+// uniqueNames returns the distinct names of the given lists, sorted
+func uniqueNames(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, list := range lists {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
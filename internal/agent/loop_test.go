@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"finta/internal/hook"
+	"finta/internal/llm"
+	"finta/internal/logger"
+	"finta/internal/tool"
+)
+
+// globCall returns a glob tool call with the given arguments
+func globCall(id int, args string) []*llm.ToolCall {
+	return []*llm.ToolCall{{ID: fmt.Sprintf("call_%d", id), Type: "function", Function: &llm.FunctionCall{Name: "glob", Arguments: args}}}
+}
+
+func TestLoopDetector_RepeatAndOscillation(t *testing.T) {
+	l := newLoopDetector(LoopConfig{})
+	if l.check(globCall(1, `{"pattern": "*.go"}`)) != nil || l.check(globCall(2, `{"pattern":"*.go"}`)) != nil {
+		t.Fatal("Expected no loop before the repeat threshold")
+	}
+	d := l.check(globCall(3, `{ "pattern" : "*.go" }`))
+	if d == nil || d.kind != LoopRepeat || d.turns != 3 || d.stop {
+		t.Fatalf("Expected a repeat detection with a note, got %+v", d)
+	}
+
+	// A B A B, after the note, exhausts the notes
+	for i, pattern := range []string{"a", "b", "a"} {
+		if d := l.check(globCall(i, `{"pattern":"`+pattern+`"}`)); d != nil {
+			t.Fatalf("Expected no loop yet, got %+v", d)
+		}
+	}
+	d = l.check(globCall(4, `{"pattern":"b"}`))
+	if d == nil || d.kind != LoopOscillation || d.turns != 4 || !d.stop {
+		t.Fatalf("Expected an oscillation detection that stops, got %+v", d)
+	}
+
+	if d := newLoopDetector(LoopConfig{Disabled: true}).check(globCall(1, `{}`)); d != nil {
+		t.Errorf("Expected disabled detection to report nothing")
+	}
+}
+
+func TestRun_RepeatedToolCallsGetNoteThenStop(t *testing.T) {
+	var responses []*llm.ChatResponse
+	for i := 0; i < 6; i++ {
+		responses = append(responses, &llm.ChatResponse{
+			Message:    llm.Message{Role: llm.RoleAssistant, ToolCalls: globCall(i, `{"pattern":"missing/*.go"}`)},
+			StopReason: llm.StopReasonToolCalls,
+		})
+	}
+	client := &scriptedClient{model: "m", responses: responses}
+
+	registry := tool.NewRegistry()
+	registry.Register(&globTool{})
+	ag := NewBaseAgent("general", "", client, registry, nil)
+
+	var actions []string
+	manager := hook.NewManager()
+	manager.Register(&funcHandler{
+		points: []hook.HookPoint{hook.OnLoopDetected},
+		handle: func(data *hook.HookData) *hook.Feedback {
+			actions = append(actions, data.GetString("action"))
+			return hook.AllowFeedback()
+		},
+	})
+	ag.SetHookManager(manager)
+
+	output, err := ag.Run(context.Background(), &Input{Task: "find it", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if output.StopReason != StopLoop || len(output.ToolCalls) != 6 {
+		t.Fatalf("Expected a partial output stopped by the loop, got %s with %d tool calls", output.StopReason, len(output.ToolCalls))
+	}
+	if got := strings.Join(actions, ","); got != "note,stop" {
+		t.Errorf("Expected a note then a stop, got %s", got)
+	}
+	if len(client.requests) != 6 {
+		t.Fatalf("Expected the run to stop after 6 turns, got %d", len(client.requests))
+	}
+	if last := output.Messages[len(output.Messages)-1]; last.Role != llm.RoleTool {
+		t.Errorf("Expected the run's tool results kept, got %+v", last)
+	}
+
+	// The fourth call sees the corrective note as a user message right
+	// after the third turn's tool results
+	msgs := client.requests[3].Messages
+	if note := msgs[len(msgs)-1]; note.Role != llm.RoleUser || !strings.Contains(note.Content, "3 turns in a row") {
+		t.Errorf("Expected a corrective user note last, got %+v", note)
+	}
+	if result := msgs[len(msgs)-2]; result.Role != llm.RoleTool || result.ToolCallID != "call_2" {
+		t.Errorf("Expected the note to follow the tool result of call_2, got %+v", result)
+	}
+	if want := len(client.requests[2].Messages) + 3; len(msgs) != want {
+		t.Errorf("Expected the third turn's call, its result and the note, got %d messages, want %d", len(msgs), want)
+	}
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"finta/internal/llm"
+)
+
+// streamAccumulator assembles a complete response from stream deltas and
+// turns them into loop events
+type streamAccumulator struct {
+	msg        llm.Message
+	stopReason llm.StopReason
+	usage      llm.Usage
+	model      string
+	calls      map[string]*llm.ToolCall // Keyed by call ID
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{
+		msg:   llm.Message{Role: llm.RoleAssistant},
+		calls: make(map[string]*llm.ToolCall),
+	}
+}
+
+// add applies a delta and emits the events it produces
+func (s *streamAccumulator) add(delta *llm.Delta, emit func(Event)) {
+	if delta.Usage != nil {
+		s.usage = *delta.Usage
+	}
+	if delta.Done {
+		s.stopReason = delta.StopReason
+		s.model = delta.Model
+		s.msg.Thinking = delta.Thinking
+		return
+	}
+
+	if delta.Reason != "" {
+		s.msg.Reason += delta.Reason
+		emit(Event{Type: EventReasoningDelta, Text: delta.Reason})
+	}
+	if delta.Content != "" {
+		s.msg.Content += delta.Content
+		emit(Event{Type: EventContentDelta, Text: delta.Content})
+	}
+
+	// Providers send either every tool call so far or only the calls a chunk
+	// touched, with arguments accumulated; merge them by call ID
+	for i, tc := range delta.ToolCalls {
+		if tc.Function == nil {
+			continue
+		}
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("#%d", i) // Position in the delta
+		}
+
+		call, ok := s.calls[id]
+		if !ok {
+			call = &llm.ToolCall{ID: tc.ID, Type: tc.Type, Function: &llm.FunctionCall{Name: tc.Function.Name}}
+			s.calls[id] = call
+			s.msg.ToolCalls = append(s.msg.ToolCalls, call)
+			emit(Event{Type: EventToolCallStart, ToolCall: copyToolCall(call)})
+		}
+		if tc.Function.Name != "" {
+			call.Function.Name = tc.Function.Name
+		}
+
+		args := tc.Function.Arguments
+		if args == call.Function.Arguments {
+			continue
+		}
+		added := args
+		if strings.HasPrefix(args, call.Function.Arguments) {
+			added = args[len(call.Function.Arguments):]
+		}
+		call.Function.Arguments = args
+		emit(Event{Type: EventToolCallDelta, ToolCall: copyToolCall(call), Text: added})
+	}
+}
+
+// response returns the accumulated response. Providers that do not report
+// a stop reason are judged by whether the model called tools.
+func (s *streamAccumulator) response() *llm.ChatResponse {
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = llm.StopReasonStop
+		if len(s.msg.ToolCalls) > 0 {
+			stopReason = llm.StopReasonToolCalls
+		}
+	}
+	return &llm.ChatResponse{Message: s.msg, StopReason: stopReason, Usage: s.usage, Model: s.model}
+}
+
+// copyToolCall snapshots a tool call that is still being accumulated
+func copyToolCall(tc *llm.ToolCall) *llm.ToolCall {
+	copied := *tc
+	fn := *tc.Function
+	copied.Function = &fn
+	return &copied
+}
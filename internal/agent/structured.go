@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"finta/internal/llm"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// ErrInvalidStructuredOutput is returned when the final answer still does
+// not conform to the requested schema after the allowed corrections
+var ErrInvalidStructuredOutput = errors.New("final answer does not conform to the requested schema")
+
+// maxStructuredCorrections is how many times the model is asked to fix a
+// final answer that fails schema validation
+const maxStructuredCorrections = 2
+
+// SchemaFor infers a response format from a Go type. The structured result
+// of a run using it can be decoded into a T with Output.Decode.
+func SchemaFor[T any](name string) (*llm.ResponseFormat, error) {
+	schema, err := jsonschema.For[T](nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer schema: %w", err)
+	}
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode schema: %w", err)
+	}
+
+	return &llm.ResponseFormat{Name: name, Schema: m}, nil
+}
+
+// Decode unmarshals the structured result of a run into v
+func (o *Output) Decode(v any) error {
+	if len(o.Structured) == 0 {
+		return fmt.Errorf("output has no structured result")
+	}
+	return json.Unmarshal(o.Structured, v)
+}
+
+// structuredOutput validates the final answers of a run against the
+// requested schema. A nil structuredOutput accepts any answer.
+type structuredOutput struct {
+	schema      *jsonschema.Resolved
+	corrections int
+}
+
+// newStructuredOutput resolves the schema of a response format
+func newStructuredOutput(format *llm.ResponseFormat) (*structuredOutput, error) {
+	if format == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(format.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response schema: %w", err)
+	}
+	var schema jsonschema.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid response schema: %w", err)
+	}
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response schema: %w", err)
+	}
+
+	return &structuredOutput{schema: resolved}, nil
+}
+
+// check validates a final answer. It returns the answer as compact JSON,
+// or a user message asking the model to correct it while corrections remain.
+func (s *structuredOutput) check(content string) (json.RawMessage, *llm.Message, error) {
+	if s == nil {
+		return nil, nil, nil
+	}
+
+	result, err := s.validate(content)
+	if err == nil {
+		return result, nil, nil
+	}
+
+	if s.corrections >= maxStructuredCorrections {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidStructuredOutput, err)
+	}
+	s.corrections++
+
+	return nil, &llm.Message{
+		Role:    llm.RoleUser,
+		Content: fmt.Sprintf("Your answer does not conform to the required JSON schema: %v\nRespond again with only the corrected JSON.", err),
+	}, nil
+}
+
+func (s *structuredOutput) validate(content string) (json.RawMessage, error) {
+	raw := extractJSON(content)
+
+	var instance any
+	if err := json.Unmarshal([]byte(raw), &instance); err != nil {
+		return nil, fmt.Errorf("answer is not valid JSON: %v", err)
+	}
+	if err := s.schema.Validate(instance); err != nil {
+		return nil, err
+	}
+
+	compacted, err := json.Marshal(instance)
+	if err != nil {
+		return nil, err
+	}
+	return compacted, nil
+}
+
+// extractJSON strips surrounding whitespace and markdown code fences,
+// which models add even when asked not to
+func extractJSON(content string) string {
+	s := strings.TrimSpace(content)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:] // Drop the language tag line
+	}
+	s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	return strings.TrimSpace(s)
+}
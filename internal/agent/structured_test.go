@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"finta/internal/llm"
+	"finta/internal/logger"
+	"finta/internal/tool"
+)
+
+type planResult struct {
+	Summary string   `json:"summary"`
+	Steps   []string `json:"steps"`
+}
+
+func TestRun_StructuredOutputCorrectedAndDecoded(t *testing.T) {
+	format, err := SchemaFor[planResult]("plan")
+	if err != nil {
+		t.Fatalf("SchemaFor failed: %v", err)
+	}
+
+	client := &scriptedClient{model: "gpt-4o", responses: []*llm.ChatResponse{
+		stopResponse(`{"summary": "add auth"}`, 1, 1),
+		stopResponse("```json\n{\"summary\": \"add auth\", \"steps\": [\"add middleware\"]}\n```", 1, 1),
+	}}
+	ag := NewBaseAgent("plan", "", client, tool.NewRegistry(), nil)
+
+	out, err := ag.Run(context.Background(), &Input{
+		Task:           "plan auth",
+		Logger:         logger.NewLogger(io.Discard, logger.LevelError),
+		ResponseFormat: format,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if client.requests[0].ResponseFormat != format {
+		t.Error("Expected the response format to be sent with the request")
+	}
+	if last := client.requests[1].Messages[len(client.requests[1].Messages)-1]; last.Role != llm.RoleUser {
+		t.Errorf("Expected a correction message after the invalid answer, got %+v", last)
+	}
+
+	var plan planResult
+	if err := out.Decode(&plan); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if plan.Summary != "add auth" || len(plan.Steps) != 1 {
+		t.Errorf("Unexpected plan: %+v", plan)
+	}
+}
+
+func TestRun_StructuredOutputGivesUp(t *testing.T) {
+	client := &scriptedClient{model: "gpt-4o", responses: []*llm.ChatResponse{
+		stopResponse("not json", 1, 1),
+		stopResponse("still not json", 1, 1),
+		stopResponse("[]", 1, 1),
+	}}
+	ag := NewBaseAgent("plan", "", client, tool.NewRegistry(), nil)
+
+	_, err := ag.Run(context.Background(), &Input{
+		Task:           "plan",
+		Logger:         logger.NewLogger(io.Discard, logger.LevelError),
+		ResponseFormat: &llm.ResponseFormat{Name: "plan", Schema: map[string]any{"type": "object"}},
+	})
+	if !errors.Is(err, ErrInvalidStructuredOutput) {
+		t.Fatalf("Expected ErrInvalidStructuredOutput, got %v", err)
+	}
+	if len(client.requests) != maxStructuredCorrections+1 {
+		t.Errorf("Expected %d attempts, got %d", maxStructuredCorrections+1, len(client.requests))
+	}
+}
+
+func TestRun_StructuredOutputCutOffIsAnError(t *testing.T) {
+	truncated := stopResponse(`{"summary": "add auth", "steps": ["add middl`, 1, 1)
+	truncated.StopReason = llm.StopReasonLength
+	client := &scriptedClient{model: "gpt-4o", responses: []*llm.ChatResponse{truncated}}
+	ag := NewBaseAgent("plan", "", client, tool.NewRegistry(), nil)
+
+	format, _ := SchemaFor[planResult]("plan")
+	out, err := ag.Run(context.Background(), &Input{
+		Task:           "plan auth",
+		Logger:         logger.NewLogger(io.Discard, logger.LevelError),
+		ResponseFormat: format,
+	})
+	if !errors.Is(err, ErrInvalidStructuredOutput) || out != nil {
+		t.Fatalf("Expected ErrInvalidStructuredOutput for a truncated answer, got %+v, %v", out, err)
+	}
+}
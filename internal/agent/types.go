@@ -2,8 +2,11 @@ package agent
 
 import (
 	"fmt"
+	"sync"
 
+	"finta/internal/hook"
 	"finta/internal/llm"
+	"finta/internal/llm/compact"
 	"finta/internal/tool"
 )
 
@@ -20,13 +23,48 @@ const (
 // Factory creates agents of different types
 type Factory interface {
 	CreateAgent(agentType AgentType) (Agent, error)
+	// AgentTypes lists the agent types the factory can create
+	AgentTypes() []AgentTypeInfo
+}
+
+// ClientProvider returns an LLM client for the given model name.
+// It lets agents whose config names a model call that model instead of
+// the factory's default client.
+type ClientProvider func(model string) (llm.Client, error)
+
+// ConfigOverride holds per-agent-type settings that replace the built-in
+// defaults. Zero values (and a nil Temperature) keep the default.
+type ConfigOverride struct {
+	Model       string
+	Temperature *float32
+	MaxTokens   int
+	MaxTurns    int
+
+	ToolChoice        *llm.ToolChoice
+	ParallelToolCalls *bool
+	TopP              float32
+	Stop              []string
+	Seed              *int
 }
 
 // DefaultFactory is the standard agent factory
 type DefaultFactory struct {
-	llmClient           llm.Client
-	toolRegistry        *tool.Registry
-	includeBestPractices bool // Whether to include tool best practices in system prompts
+	llmClient            llm.Client
+	toolRegistry         *tool.Registry
+	includeBestPractices bool   // Whether to include tool best practices in system prompts
+	instructions         string // Project instructions added to every system prompt
+	clientProvider       ClientProvider
+	overrides            map[AgentType]ConfigOverride
+	custom               map[AgentType]Definition // Custom agent types by name
+	clients              map[string]llm.Client    // Clients resolved by model name
+	compaction           *compact.Config          // Nil uses the compact package defaults
+	prices               llm.PriceTable           // Nil uses llm.DefaultPrices
+	systemContext        SystemContext            // Nil adds no per-run context
+	hooks                *hook.Manager            // Agent lifecycle and LLM call hooks of created agents
+	loop                 *LoopConfig              // Nil uses the loop detection defaults
+	summarizeOnStop      bool                     // Sets Config.SummarizeOnStop of created agents
+	budget               Budget                   // Sets Config.Budget of created agents
+	mu                   sync.Mutex
 }
 
 // NewDefaultFactory creates a new agent factory with best practices enabled by default
@@ -35,6 +73,9 @@ func NewDefaultFactory(client llm.Client, registry *tool.Registry) *DefaultFacto
 		llmClient:            client,
 		toolRegistry:         registry,
 		includeBestPractices: true, // Enable by default
+		overrides:            make(map[AgentType]ConfigOverride),
+		custom:               make(map[AgentType]Definition),
+		clients:              make(map[string]llm.Client),
 	}
 }
 
@@ -43,18 +84,177 @@ func (f *DefaultFactory) SetIncludeBestPractices(include bool) {
 	f.includeBestPractices = include
 }
 
-// buildSystemPrompt constructs a system prompt with optional tool best practices
+// SetInstructions sets project instructions (e.g. from FINTA.md files) that
+// are added to the system prompt of every created agent, including sub-agents
+func (f *DefaultFactory) SetInstructions(instructions string) {
+	f.instructions = instructions
+}
+
+// SetSystemContext sets a generator for context (e.g. the environment)
+// that created agents add to their system prompt at the start of each run
+func (f *DefaultFactory) SetSystemContext(generate SystemContext) {
+	f.systemContext = generate
+}
+
+// SetHookManager sets the hook manager for the agent lifecycle and LLM call
+// hooks of the agents it creates. Tool hooks are left to the top-level
+// agent (see BaseAgent.SetHookManager), so that confirmation prompts of
+// concurrent sub-agents don't compete for the terminal.
+func (f *DefaultFactory) SetHookManager(manager *hook.Manager) {
+	f.hooks = manager
+}
+
+// SetClientProvider sets the provider used to create clients for agents
+// whose config names a model other than the default client's
+func (f *DefaultFactory) SetClientProvider(provider ClientProvider) {
+	f.clientProvider = provider
+}
+
+// SetAgentOverride replaces built-in config values for an agent type
+func (f *DefaultFactory) SetAgentOverride(agentType AgentType, override ConfigOverride) {
+	f.overrides[agentType] = override
+}
+
+// SetCompactionConfig sets the history compaction settings of created agents
+func (f *DefaultFactory) SetCompactionConfig(cfg compact.Config) {
+	f.compaction = &cfg
+}
+
+// SetLoopConfig sets the loop detection thresholds of the agents it creates
+func (f *DefaultFactory) SetLoopConfig(cfg LoopConfig) {
+	f.loop = &cfg
+}
+
+// SetSummarizeOnStop makes the agents it creates summarise their progress
+// in a final tool-less turn when they stop before a final answer
+func (f *DefaultFactory) SetSummarizeOnStop(summarize bool) {
+	f.summarizeOnStop = summarize
+}
+
+// SetBudget sets the budget of every run of the agents it creates. Task
+// sub-agents are further limited to a share of their caller's remaining
+// budget.
+func (f *DefaultFactory) SetBudget(budget Budget) {
+	f.budget = budget
+}
+
+// SetPriceTable sets the model prices used for cost accounting by created agents
+func (f *DefaultFactory) SetPriceTable(prices llm.PriceTable) {
+	f.prices = prices
+}
+
+// clientFor returns the client for a model, creating and caching it on first use.
+// An empty model, or the default client's own model, uses the default client.
+func (f *DefaultFactory) clientFor(model string) (llm.Client, error) {
+	if model == "" || model == f.llmClient.Model() {
+		return f.llmClient, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if client, ok := f.clients[model]; ok {
+		return client, nil
+	}
+
+	if f.clientProvider == nil {
+		return nil, fmt.Errorf("no client provider configured for model %s", model)
+	}
+
+	client, err := f.clientProvider(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for model %s: %w", model, err)
+	}
+	f.clients[model] = client
+	return client, nil
+}
+
+// newAgent applies any config override for the agent type and creates a
+// BaseAgent bound to the client for the configured model
+func (f *DefaultFactory) newAgent(agentType AgentType, systemPrompt string, registry *tool.Registry, cfg *Config) (Agent, error) {
+	if override, ok := f.overrides[agentType]; ok {
+		if override.Model != "" {
+			cfg.Model = override.Model
+		}
+		if override.Temperature != nil {
+			cfg.Temperature = *override.Temperature
+		}
+		if override.MaxTokens > 0 {
+			cfg.MaxTokens = override.MaxTokens
+		}
+		if override.MaxTurns > 0 {
+			cfg.MaxTurns = override.MaxTurns
+		}
+		if override.ToolChoice != nil {
+			cfg.ToolChoice = override.ToolChoice
+		}
+		if override.ParallelToolCalls != nil {
+			cfg.ParallelToolCalls = override.ParallelToolCalls
+		}
+		if override.TopP > 0 {
+			cfg.TopP = override.TopP
+		}
+		if len(override.Stop) > 0 {
+			cfg.Stop = override.Stop
+		}
+		if override.Seed != nil {
+			cfg.Seed = override.Seed
+		}
+	}
+
+	if f.loop != nil {
+		cfg.Loop = *f.loop
+	}
+	if f.summarizeOnStop {
+		cfg.SummarizeOnStop = true
+	}
+	if !f.budget.IsZero() {
+		cfg.Budget = f.budget
+	}
+
+	client, err := f.clientFor(cfg.Model)
+	if err != nil {
+		return nil, fmt.Errorf("%s agent: %w", agentType, err)
+	}
+
+	base := NewBaseAgent(string(agentType), systemPrompt, client, registry, cfg)
+	if f.compaction != nil {
+		base.SetCompactionConfig(*f.compaction)
+	}
+	if f.prices != nil {
+		base.SetPriceTable(f.prices)
+	}
+	if f.systemContext != nil {
+		base.SetSystemContext(f.systemContext)
+	}
+	base.hooks = f.hooks
+	return base, nil
+}
+
+// buildSystemPrompt constructs a system prompt with project instructions
+// and optional tool best practices
 func (f *DefaultFactory) buildSystemPrompt(basePrompt string) string {
+	return f.buildSystemPromptFor(basePrompt, f.toolRegistry)
+}
+
+// buildSystemPromptFor constructs a system prompt whose best practices cover
+// the tools of the given registry
+func (f *DefaultFactory) buildSystemPromptFor(basePrompt string, registry *tool.Registry) string {
+	prompt := basePrompt
+	if f.instructions != "" {
+		prompt += "\n\n" + f.instructions
+	}
+
 	if !f.includeBestPractices {
-		return basePrompt
+		return prompt
 	}
 
-	bestPractices := f.toolRegistry.GetToolBestPractices()
+	bestPractices := registry.GetToolBestPractices()
 	if bestPractices == "" {
-		return basePrompt
+		return prompt
 	}
 
-	return basePrompt + "\n\n" + bestPractices
+	return prompt + "\n\n" + bestPractices
 }
 
 // CreateAgent creates an agent of the specified type
@@ -69,6 +269,9 @@ func (f *DefaultFactory) CreateAgent(agentType AgentType) (Agent, error) {
 	case AgentTypeExecute:
 		return f.createExecuteAgent()
 	default:
+		if def, ok := f.customDefinition(agentType); ok {
+			return f.createCustomAgent(def)
+		}
 		return nil, fmt.Errorf("unknown agent type: %s", agentType)
 	}
 }
@@ -88,20 +291,19 @@ Always provide clear, concise responses.`
 
 	systemPrompt := f.buildSystemPrompt(basePrompt)
 
-	return NewBaseAgent(
-		"general",
+	return f.newAgent(
+		AgentTypeGeneral,
 		systemPrompt,
-		f.llmClient,
 		f.toolRegistry, // All tools available
 		&Config{
-			Model:              "gpt-4-turbo",
-			Temperature:        0.7,
-			MaxTokens:          4096,
-			MaxTurns:           20,
+			Model:               "", // Empty uses the factory's default client
+			Temperature:         0.7,
+			MaxTokens:           4096,
+			MaxTurns:            20,
 			EnableParallelTools: true,
 			ToolExecutionMode:   tool.ExecutionModeMixed,
 		},
-	), nil
+	)
 }
 
 // createExploreAgent creates an exploration-focused agent with read-only tools
@@ -139,20 +341,19 @@ Always provide clear summaries of your findings.`
 	// Build system prompt with best practices from the filtered explore registry
 	systemPrompt := f.buildSystemPrompt(basePrompt)
 
-	return NewBaseAgent(
-		"explore",
+	return f.newAgent(
+		AgentTypeExplore,
 		systemPrompt,
-		f.llmClient,
 		exploreRegistry,
 		&Config{
-			Model:              "gpt-4-turbo",
-			Temperature:        0.3, // Lower for focused exploration
-			MaxTokens:          4096,
-			MaxTurns:           15,
+			Model:               "",  // Empty uses the factory's default client
+			Temperature:         0.3, // Lower for focused exploration
+			MaxTokens:           4096,
+			MaxTurns:            15,
 			EnableParallelTools: true,
 			ToolExecutionMode:   tool.ExecutionModeMixed,
 		},
-	), nil
+	)
 }
 
 // createPlanAgent creates a planning-focused agent with limited tools
@@ -188,31 +389,32 @@ When creating plans:
 4. Suggest best practices
 5. Anticipate potential issues
 
-Output your plan in a structured markdown format with:
+Unless your answer must follow a JSON schema, output your plan in a structured markdown format with:
 - **Overview**: High-level summary
 - **Implementation Steps**: Numbered, actionable steps
 - **Files to Modify**: List with descriptions
 - **Testing Strategy**: How to verify the implementation
 - **Potential Risks**: Issues to watch out for
 
+When a JSON schema is required, answer with JSON only and fit the plan into the schema's fields.
+
 Be thorough and consider edge cases.`
 
 	systemPrompt := f.buildSystemPrompt(basePrompt)
 
-	return NewBaseAgent(
-		"plan",
+	return f.newAgent(
+		AgentTypePlan,
 		systemPrompt,
-		f.llmClient,
 		planRegistry,
 		&Config{
-			Model:              "gpt-4-turbo",
-			Temperature:        0.5, // Balanced
-			MaxTokens:          4096,
-			MaxTurns:           10,
+			Model:               "",  // Empty uses the factory's default client
+			Temperature:         0.5, // Balanced
+			MaxTokens:           4096,
+			MaxTurns:            10,
 			EnableParallelTools: true,
 			ToolExecutionMode:   tool.ExecutionModeMixed,
 		},
-	), nil
+	)
 }
 
 // createExecuteAgent creates an execution-focused agent with all tools
@@ -236,18 +438,17 @@ Focus on correctness and safety over speed.`
 
 	systemPrompt := f.buildSystemPrompt(basePrompt)
 
-	return NewBaseAgent(
-		"execute",
+	return f.newAgent(
+		AgentTypeExecute,
 		systemPrompt,
-		f.llmClient,
 		f.toolRegistry, // All tools available
 		&Config{
-			Model:              "gpt-4-turbo",
-			Temperature:        0.5,
-			MaxTokens:          4096,
-			MaxTurns:           20,
+			Model:               "", // Empty uses the factory's default client
+			Temperature:         0.5,
+			MaxTokens:           4096,
+			MaxTurns:            20,
 			EnableParallelTools: true,
 			ToolExecutionMode:   tool.ExecutionModeMixed,
 		},
-	), nil
+	)
 }
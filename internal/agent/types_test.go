@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"finta/internal/llm"
+	"finta/internal/tool"
+)
+
+// modelClient is a minimal llm.Client that only reports its model
+type modelClient struct {
+	model string
+}
+
+func (c *modelClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	return &llm.ChatResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: c.model}, StopReason: llm.StopReasonStop}, nil
+}
+
+func (c *modelClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	return nil, nil
+}
+
+func (c *modelClient) Provider() string { return "test" }
+func (c *modelClient) Model() string    { return c.model }
+
+// namedTool is a no-op tool used to populate registries
+type namedTool struct {
+	name string
+}
+
+func (t *namedTool) Name() string               { return t.name }
+func (t *namedTool) Description() string        { return t.name }
+func (t *namedTool) BestPractices() string      { return "" }
+func (t *namedTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *namedTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	return &tool.Result{Success: true}, nil
+}
+
+func newTestRegistry() *tool.Registry {
+	registry := tool.NewRegistry()
+	for _, name := range []string{"read", "glob", "grep", "bash", "write", "edit", "ls"} {
+		registry.Register(&namedTool{name: name})
+	}
+	return registry
+}
+
+func TestDefaultFactory_UsesDefaultClientWithoutOverride(t *testing.T) {
+	factory := NewDefaultFactory(&modelClient{model: "default"}, newTestRegistry())
+
+	ag, err := factory.CreateAgent(AgentTypeExplore)
+	if err != nil {
+		t.Fatalf("CreateAgent failed: %v", err)
+	}
+	if model := ag.(*BaseAgent).Model(); model != "default" {
+		t.Errorf("Expected default client, got %s", model)
+	}
+}
+
+func TestDefaultFactory_OverrideSelectsModelClient(t *testing.T) {
+	factory := NewDefaultFactory(&modelClient{model: "default"}, newTestRegistry())
+
+	created := 0
+	factory.SetClientProvider(func(model string) (llm.Client, error) {
+		created++
+		return &modelClient{model: model}, nil
+	})
+
+	temp := float32(0.1)
+	factory.SetAgentOverride(AgentTypeExplore, ConfigOverride{Model: "cheap", Temperature: &temp, MaxTurns: 5})
+
+	for i := 0; i < 2; i++ {
+		ag, err := factory.CreateAgent(AgentTypeExplore)
+		if err != nil {
+			t.Fatalf("CreateAgent failed: %v", err)
+		}
+		base := ag.(*BaseAgent)
+		if base.Model() != "cheap" {
+			t.Errorf("Expected explore agent to use cheap model, got %s", base.Model())
+		}
+		if base.config.Temperature != 0.1 || base.config.MaxTurns != 5 {
+			t.Errorf("Expected overrides to apply, got %+v", base.config)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("Expected client to be created once and cached, got %d", created)
+	}
+
+	// Other agent types keep the default client
+	ag, _ := factory.CreateAgent(AgentTypePlan)
+	if model := ag.(*BaseAgent).Model(); model != "default" {
+		t.Errorf("Expected plan agent to keep default client, got %s", model)
+	}
+}
+
+func TestDefaultFactory_ModelWithoutProvider(t *testing.T) {
+	factory := NewDefaultFactory(&modelClient{model: "default"}, newTestRegistry())
+	factory.SetAgentOverride(AgentTypePlan, ConfigOverride{Model: "other"})
+
+	if _, err := factory.CreateAgent(AgentTypePlan); err == nil {
+		t.Fatal("Expected error when no client provider can supply the model")
+	}
+}
+
+func TestDefaultFactory_CustomAgent(t *testing.T) {
+	factory := NewDefaultFactory(&modelClient{model: "default"}, newTestRegistry())
+
+	temp := float32(0.2)
+	err := factory.RegisterAgent(Definition{
+		Name:          "reviewer",
+		Description:   "Reviews changes",
+		Prompt:        "You review code.",
+		Tools:         []string{"read", "g*"},
+		Temperature:   &temp,
+		MaxTurns:      7,
+		ExecutionMode: tool.ExecutionModeSequential,
+	})
+	if err != nil {
+		t.Fatalf("RegisterAgent failed: %v", err)
+	}
+
+	ag, err := factory.CreateAgent("reviewer")
+	if err != nil {
+		t.Fatalf("CreateAgent failed: %v", err)
+	}
+	base := ag.(*BaseAgent)
+	if base.Name() != "reviewer" || base.systemPrompt != "You review code." {
+		t.Errorf("Unexpected agent %s with prompt %q", base.Name(), base.systemPrompt)
+	}
+	for _, name := range []string{"read", "glob", "grep"} {
+		if _, err := base.toolRegistry.Get(name); err != nil {
+			t.Errorf("Expected tool %s to be allowed", name)
+		}
+	}
+	if n := len(base.toolRegistry.List()); n != 3 {
+		t.Errorf("Expected 3 tools, got %d", n)
+	}
+	if base.config.Temperature != 0.2 || base.config.MaxTurns != 7 || base.config.ToolExecutionMode != tool.ExecutionModeSequential {
+		t.Errorf("Expected definition settings to apply, got %+v", base.config)
+	}
+
+	types := factory.AgentTypes()
+	if last := types[len(types)-1]; last.Type != "reviewer" || last.Description != "Reviews changes" {
+		t.Errorf("Expected custom type after built-ins, got %+v", types)
+	}
+
+	if err := factory.RegisterAgent(Definition{Name: "plan", Prompt: "x"}); err == nil {
+		t.Error("Expected error when shadowing a built-in type")
+	}
+	factory.RegisterAgent(Definition{Name: "broken", Prompt: "x", Tools: []string{"missing"}})
+	if _, err := factory.CreateAgent("broken"); err == nil {
+		t.Error("Expected error for a tool that is not registered")
+	}
+}
+
+func TestDefaultFactory_InstructionsInEveryPrompt(t *testing.T) {
+	factory := NewDefaultFactory(&modelClient{model: "default"}, newTestRegistry())
+	factory.SetInstructions("# Project Instructions\n\nRun make test.")
+	factory.RegisterAgent(Definition{Name: "reviewer", Prompt: "You review code."})
+
+	for _, agentType := range []AgentType{AgentTypeGeneral, AgentTypeExplore, AgentTypePlan, AgentTypeExecute, "reviewer"} {
+		ag, err := factory.CreateAgent(agentType)
+		if err != nil {
+			t.Fatalf("CreateAgent(%s) failed: %v", agentType, err)
+		}
+		if prompt := ag.(*BaseAgent).systemPrompt; !strings.Contains(prompt, "Run make test.") {
+			t.Errorf("Expected %s prompt to include instructions, got %q", agentType, prompt)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"finta/internal/llm"
+)
+
+// UsageContextKey is the context key for the usage of the calling agent,
+// under which sub-agents register their own usage
+const UsageContextKey ContextKey = "usage"
+
+// TurnUsage is the token usage of a single LLM call
+type TurnUsage struct {
+	Turn  int
+	Model string
+	Usage llm.Usage
+	Cost  float64
+}
+
+// Usage records the token usage and cost of one agent run,
+// including the runs of any sub-agents it spawned
+type Usage struct {
+	Agent     string
+	Turns     []TurnUsage
+	Own       llm.Usage // Usage of this agent's own LLM calls
+	OwnCost   float64
+	Unpriced  bool // Some calls used a model missing from the price table
+	SubAgents []*Usage
+
+	mu sync.Mutex
+}
+
+// NewUsage creates an empty usage record for an agent
+func NewUsage(agentName string) *Usage {
+	return &Usage{Agent: agentName}
+}
+
+// AddTurn records the usage of one LLM call
+func (u *Usage) AddTurn(turn int, model string, usage llm.Usage, prices llm.PriceTable) {
+	cost, priced := prices.Cost(model, usage)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.Turns = append(u.Turns, TurnUsage{Turn: turn, Model: model, Usage: usage, Cost: cost})
+	u.Own.Add(usage)
+	u.OwnCost += cost
+	if !priced && usage.TotalTokens > 0 {
+		u.Unpriced = true
+	}
+}
+
+// AddSubAgent attaches the usage of a sub-agent run. Safe for concurrent use.
+func (u *Usage) AddSubAgent(sub *Usage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.SubAgents = append(u.SubAgents, sub)
+}
+
+// Total returns the usage and cost of this run including all sub-agents.
+// A nil Usage reports zero.
+func (u *Usage) Total() (llm.Usage, float64) {
+	if u == nil {
+		return llm.Usage{}, 0
+	}
+
+	u.mu.Lock()
+	total, cost := u.Own, u.OwnCost
+	subs := append([]*Usage(nil), u.SubAgents...)
+	u.mu.Unlock()
+
+	for _, sub := range subs {
+		subTotal, subCost := sub.Total()
+		total.Add(subTotal)
+		cost += subCost
+	}
+	return total, cost
+}
+
+// HasUnpriced reports whether any call in this run or its sub-agents was not priced
+func (u *Usage) HasUnpriced() bool {
+	if u == nil {
+		return false
+	}
+
+	u.mu.Lock()
+	unpriced := u.Unpriced
+	subs := append([]*Usage(nil), u.SubAgents...)
+	u.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.HasUnpriced() {
+			return true
+		}
+	}
+	return unpriced
+}
+
+// GetUsageFromContext retrieves the calling agent's usage from context
+func GetUsageFromContext(ctx context.Context) *Usage {
+	if usage, ok := ctx.Value(UsageContextKey).(*Usage); ok {
+		return usage
+	}
+	return nil
+}
+
+// WithUsage adds an agent's usage to the context so that sub-agents
+// started from its tool calls are accounted under it
+func WithUsage(ctx context.Context, usage *Usage) context.Context {
+	return context.WithValue(ctx, UsageContextKey, usage)
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"finta/internal/llm"
+	"finta/internal/logger"
+	"finta/internal/tool"
+)
+
+// scriptedClient returns queued responses in order and records requests
+type scriptedClient struct {
+	model     string
+	responses []*llm.ChatResponse
+	requests  []*llm.ChatRequest
+}
+
+func (c *scriptedClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	c.requests = append(c.requests, req)
+	resp := c.responses[0]
+	c.responses = c.responses[1:]
+	return resp, nil
+}
+
+func (c *scriptedClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	return nil, io.EOF
+}
+
+func (c *scriptedClient) Provider() string { return "test" }
+func (c *scriptedClient) Model() string    { return c.model }
+
+// subAgentTool runs a sub-agent, like the Task tool
+type subAgentTool struct {
+	sub Agent
+}
+
+func (t *subAgentTool) Name() string               { return "delegate" }
+func (t *subAgentTool) Description() string        { return "delegate" }
+func (t *subAgentTool) BestPractices() string      { return "" }
+func (t *subAgentTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *subAgentTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	out, err := t.sub.Run(ctx, &Input{Task: "sub task", Logger: GetLoggerFromContext(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	return &tool.Result{Success: true, Output: out.Result}, nil
+}
+
+func stopResponse(content string, prompt, completion int) *llm.ChatResponse {
+	return &llm.ChatResponse{
+		Message:    llm.Message{Role: llm.RoleAssistant, Content: content},
+		StopReason: llm.StopReasonStop,
+		Usage:      llm.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion},
+	}
+}
+
+func TestRun_AccountsUsageIncludingSubAgents(t *testing.T) {
+	log := logger.NewLogger(io.Discard, logger.LevelError)
+
+	sub := NewBaseAgent("explore", "", &scriptedClient{
+		model:     "gpt-4o-mini",
+		responses: []*llm.ChatResponse{stopResponse("found it", 1000000, 0)},
+	}, tool.NewRegistry(), nil)
+
+	registry := tool.NewRegistry()
+	registry.Register(&subAgentTool{sub: sub})
+
+	parent := NewBaseAgent("general", "", &scriptedClient{
+		model: "gpt-4o",
+		responses: []*llm.ChatResponse{
+			{
+				Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: []*llm.ToolCall{
+					{ID: "1", Function: &llm.FunctionCall{Name: "delegate", Arguments: "{}"}},
+				}},
+				StopReason: llm.StopReasonToolCalls,
+				Usage:      llm.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+			},
+			stopResponse("done", 200, 0),
+		},
+	}, registry, nil)
+
+	out, err := parent.Run(context.Background(), &Input{Task: "go", Logger: log})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(out.Usage.Turns) != 2 || out.Usage.Own.TotalTokens != 310 {
+		t.Errorf("Expected 2 parent turns totalling 310 tokens, got %+v", out.Usage.Turns)
+	}
+	if len(out.Usage.SubAgents) != 1 || out.Usage.SubAgents[0].Agent != "explore" {
+		t.Fatalf("Expected explore sub-agent usage, got %+v", out.Usage.SubAgents)
+	}
+
+	total, cost := out.Usage.Total()
+	if total.PromptTokens != 1000300 || total.CompletionTokens != 10 {
+		t.Errorf("Unexpected total usage: %+v", total)
+	}
+
+	// gpt-4o: 300 prompt * 2.5 + 10 completion * 10; gpt-4o-mini: 1M prompt * 0.15
+	want := (300*2.5+10*10)/1e6 + 0.15
+	if cost < want-1e-9 || cost > want+1e-9 {
+		t.Errorf("Expected cost %.6f, got %.6f", want, cost)
+	}
+}
+
+func TestRun_PricesTheModelThatServedTheCall(t *testing.T) {
+	// A router may serve the call with another client than its default
+	resp := stopResponse("done", 1000000, 0)
+	resp.Model = "gpt-4o-mini"
+	ag := NewBaseAgent("explore", "", &scriptedClient{model: "gpt-4o", responses: []*llm.ChatResponse{resp}}, tool.NewRegistry(), nil)
+
+	out, err := ag.Run(context.Background(), &Input{Task: "go", Logger: logger.NewLogger(io.Discard, logger.LevelError)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, cost := out.Usage.Total(); out.Usage.Turns[0].Model != "gpt-4o-mini" || cost < 0.15-1e-9 || cost > 0.15+1e-9 {
+		t.Errorf("Expected the call priced as gpt-4o-mini, got %+v (cost %.6f)", out.Usage.Turns[0], cost)
+	}
+}
+
+func TestPriceTable_Lookup(t *testing.T) {
+	prices := llm.DefaultPrices().Merge(llm.PriceTable{"local": {Input: 0, Output: 0}})
+
+	tests := []struct {
+		model string
+		want  llm.Price
+		ok    bool
+	}{
+		{"gpt-4o-2024-08-06", llm.Price{Input: 2.5, Output: 10}, true},
+		{"gpt-4o-mini", llm.Price{Input: 0.15, Output: 0.6}, true},
+		{"claude-opus-4-5-20251101", llm.Price{Input: 5, Output: 25}, true},
+		{"claude-opus-4-1", llm.Price{Input: 15, Output: 75}, true},
+		{"local", llm.Price{}, true},
+		{"mystery-model", llm.Price{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := prices.Lookup(tt.model)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
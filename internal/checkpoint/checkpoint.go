@@ -0,0 +1,349 @@
+package checkpoint
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"finta/internal/session"
+)
+
+// ErrNoTurn is returned when rewinding to a turn that has no checkpoint
+var ErrNoTurn = errors.New("no checkpoint for turn")
+
+// contextKey is the context key for the store of the running session
+type contextKey struct{}
+
+// record is one line of the checkpoint index
+type record struct {
+	Type       string      `json:"type"` // "turn" or "file"
+	Turn       int         `json:"turn"`
+	Time       time.Time   `json:"time"`
+	Prompt     string      `json:"prompt,omitempty"`      // turn: the user prompt that started it
+	HistoryLen int         `json:"history_len,omitempty"` // turn: history length before the prompt
+	Path       string      `json:"path,omitempty"`        // file: absolute path
+	Existed    bool        `json:"existed,omitempty"`     // file: whether the file existed before the turn
+	Blob       string      `json:"blob,omitempty"`        // file: content hash of the previous content
+	Mode       fs.FileMode `json:"mode,omitempty"`        // file: previous permissions
+}
+
+// Turn describes a checkpointed REPL turn
+type Turn struct {
+	Number     int
+	Prompt     string
+	HistoryLen int // Messages in the history before the turn's prompt
+	Time       time.Time
+	Files      []string // Files modified during the turn
+}
+
+// RewindResult lists what a rewind changed
+type RewindResult struct {
+	Turn     Turn
+	Restored []string // Files written back to their previous content
+	Removed  []string // Files that did not exist before and were deleted
+}
+
+// Store keeps file snapshots of one session, taken before files are
+// modified. Snapshots are grouped by turn: only the first modification of
+// a file within a turn is recorded, which is the file's state before the turn.
+type Store struct {
+	dir string
+
+	mu      sync.Mutex
+	records []record
+	seen    map[string]bool // Paths snapshotted in the current turn
+}
+
+// Open opens the checkpoint store in dir, loading any earlier checkpoints
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir, seen: make(map[string]bool)}
+
+	f, err := os.Open(s.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to open checkpoints: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse checkpoint index: %w", err)
+		}
+		s.records = append(s.records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	return s, nil
+}
+
+// ForSession opens the checkpoint store of a session of the project in
+// the current directory
+func ForSession(sessionID string) (*Store, error) {
+	dir, err := session.ProjectDir()
+	if err != nil {
+		return nil, err
+	}
+	return Open(filepath.Join(dir, "checkpoints", sessionID))
+}
+
+// WithStore adds a checkpoint store to the context, so that tools
+// modifying files snapshot them first
+func WithStore(ctx context.Context, s *Store) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the checkpoint store of the context, if any
+func FromContext(ctx context.Context) *Store {
+	s, _ := ctx.Value(contextKey{}).(*Store)
+	return s
+}
+
+// Snapshot records a file's content before a tool modifies it. It does
+// nothing when the context carries no checkpoint store. Tools that write
+// files call it before every modification.
+func Snapshot(ctx context.Context, path string) error {
+	if s := FromContext(ctx); s != nil {
+		return s.Snapshot(path)
+	}
+	return nil
+}
+
+// BeginTurn starts a new turn for a user prompt and returns its number
+func (s *Store) BeginTurn(prompt string, historyLen int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turn := 1
+	if n := len(s.records); n > 0 {
+		turn = s.records[n-1].Turn + 1
+	}
+	s.seen = make(map[string]bool)
+
+	rec := record{Type: "turn", Turn: turn, Time: time.Now(), Prompt: prompt, HistoryLen: historyLen}
+	if err := s.append(rec); err != nil {
+		return 0, err
+	}
+	return turn, nil
+}
+
+// Snapshot records the current content of path, unless it was already
+// recorded in the current turn. Files that do not exist yet are recorded
+// as absent, so that rewinding removes them.
+func (s *Store) Snapshot(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.records) == 0 {
+		return fmt.Errorf("checkpoint: no turn started")
+	}
+	if s.seen[abs] {
+		return nil
+	}
+
+	rec := record{Type: "file", Turn: s.records[len(s.records)-1].Turn, Time: time.Now(), Path: abs}
+
+	info, err := os.Stat(abs)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("checkpoint: %s is a directory", abs)
+	case err == nil:
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("checkpoint: failed to read %s: %w", abs, err)
+		}
+		blob, err := s.writeBlob(data)
+		if err != nil {
+			return err
+		}
+		rec.Existed, rec.Blob, rec.Mode = true, blob, info.Mode().Perm()
+	case !os.IsNotExist(err):
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	if err := s.append(rec); err != nil {
+		return err
+	}
+	s.seen[abs] = true
+	return nil
+}
+
+// Turns returns the checkpointed turns in order
+func (s *Store) Turns() []Turn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var turns []Turn
+	for _, rec := range s.records {
+		switch rec.Type {
+		case "turn":
+			turns = append(turns, Turn{Number: rec.Turn, Prompt: rec.Prompt, HistoryLen: rec.HistoryLen, Time: rec.Time})
+		case "file":
+			if n := len(turns); n > 0 && turns[n-1].Number == rec.Turn {
+				turns[n-1].Files = append(turns[n-1].Files, rec.Path)
+			}
+		}
+	}
+	return turns
+}
+
+// Delete removes the store with all its snapshots, e.g. when its session
+// is deleted
+func (s *Store) Delete() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to delete checkpoints: %w", err)
+	}
+	s.records = nil
+	s.seen = make(map[string]bool)
+	return nil
+}
+
+// Rewind restores every file modified in the given turn or later to its
+// state before that turn, and drops those turns' checkpoints
+func (s *Store) Rewind(turn int) (*RewindResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := -1
+	result := &RewindResult{}
+	for i, rec := range s.records {
+		if rec.Type == "turn" && rec.Turn == turn {
+			keep = i
+			result.Turn = Turn{Number: rec.Turn, Prompt: rec.Prompt, HistoryLen: rec.HistoryLen, Time: rec.Time}
+			break
+		}
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("%w %d", ErrNoTurn, turn)
+	}
+
+	// The first snapshot of a file from the turn on is its state before the turn
+	restored := make(map[string]bool)
+	for _, rec := range s.records[keep:] {
+		if rec.Type != "file" || restored[rec.Path] {
+			continue
+		}
+		restored[rec.Path] = true
+
+		if !rec.Existed {
+			if err := os.Remove(rec.Path); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove %s: %w", rec.Path, err)
+			}
+			result.Removed = append(result.Removed, rec.Path)
+			continue
+		}
+
+		data, err := os.ReadFile(s.blobPath(rec.Blob))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot of %s: %w", rec.Path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(rec.Path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", rec.Path, err)
+		}
+		if err := os.WriteFile(rec.Path, data, rec.Mode); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", rec.Path, err)
+		}
+		os.Chmod(rec.Path, rec.Mode) // WriteFile keeps the mode of existing files
+		result.Restored = append(result.Restored, rec.Path)
+	}
+	sort.Strings(result.Restored)
+	sort.Strings(result.Removed)
+
+	s.records = s.records[:keep]
+	s.seen = make(map[string]bool)
+	if err := s.rewriteIndex(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, "index.jsonl")
+}
+
+func (s *Store) blobPath(hash string) string {
+	return filepath.Join(s.dir, "blobs", hash)
+}
+
+// writeBlob stores content under its hash, once
+func (s *Store) writeBlob(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	path := s.blobPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("checkpoint: failed to save snapshot: %w", err)
+	}
+	return hash, nil
+}
+
+// append adds a record to the index
+func (s *Store) append(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	f, err := os.OpenFile(s.indexPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	s.records = append(s.records, rec)
+	return nil
+}
+
+// rewriteIndex replaces the index with the current records
+func (s *Store) rewriteIndex() error {
+	var buf strings.Builder
+	for _, rec := range s.records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmp := s.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0600); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	return os.Rename(tmp, s.indexPath())
+}
@@ -0,0 +1,135 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewind_RestoresFilesBeforeTurn(t *testing.T) {
+	work := t.TempDir()
+	existing := filepath.Join(work, "main.go")
+	created := filepath.Join(work, "new", "util.go")
+	writeFile(t, existing, "v1")
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	ctx := WithStore(context.Background(), store)
+
+	// Turn 1 edits main.go twice; only the state before the turn is kept
+	if _, err := store.BeginTurn("first", 0); err != nil {
+		t.Fatalf("BeginTurn failed: %v", err)
+	}
+	for _, content := range []string{"v2", "v3"} {
+		if err := Snapshot(ctx, existing); err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		writeFile(t, existing, content)
+	}
+
+	// Turn 2 edits main.go again and creates a file
+	if _, err := store.BeginTurn("second", 2); err != nil {
+		t.Fatalf("BeginTurn failed: %v", err)
+	}
+	for path, content := range map[string]string{existing: "v4", created: "package new"} {
+		if err := Snapshot(ctx, path); err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		writeFile(t, path, content)
+	}
+
+	// Reopening loads the index from disk
+	store, err = Open(store.dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	turns := store.Turns()
+	if len(turns) != 2 || turns[0].Prompt != "first" || len(turns[0].Files) != 1 || len(turns[1].Files) != 2 {
+		t.Fatalf("Unexpected turns: %+v", turns)
+	}
+
+	result, err := store.Rewind(2)
+	if err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	if got := readFile(t, existing); got != "v3" {
+		t.Errorf("Expected main.go restored to v3, got %q", got)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("Expected file created in turn 2 to be removed, got %v", err)
+	}
+	if len(result.Restored) != 1 || len(result.Removed) != 1 || result.Turn.HistoryLen != 2 {
+		t.Errorf("Unexpected rewind result: %+v", result)
+	}
+
+	if _, err := store.Rewind(1); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	if got := readFile(t, existing); got != "v1" {
+		t.Errorf("Expected main.go restored to v1, got %q", got)
+	}
+	if _, err := store.Rewind(1); !errors.Is(err, ErrNoTurn) {
+		t.Errorf("Expected ErrNoTurn for a rewound turn, got %v", err)
+	}
+
+	// Turn numbers restart after the rewound turns
+	if turn, _ := store.BeginTurn("again", 0); turn != 1 {
+		t.Errorf("Expected next turn to be 1, got %d", turn)
+	}
+}
+
+func TestDelete_RemovesSnapshots(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	writeFile(t, file, "v1")
+
+	dir := filepath.Join(t.TempDir(), "checkpoints", "session")
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := store.BeginTurn("edit", 0); err != nil {
+		t.Fatalf("BeginTurn failed: %v", err)
+	}
+	if err := store.Snapshot(file); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint directory removed, got %v", err)
+	}
+	if turns := store.Turns(); len(turns) != 0 {
+		t.Errorf("Expected no turns left, got %+v", turns)
+	}
+}
+
+func TestSnapshot_WithoutStoreIsNoop(t *testing.T) {
+	if err := Snapshot(context.Background(), filepath.Join(t.TempDir(), "a.txt")); err != nil {
+		t.Errorf("Expected no error without a store, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AgentsDir is the project directory holding custom agent definitions
+const AgentsDir = ".finta/agents"
+
+// AgentDefinition declares a custom agent type. It is read from a YAML
+// file, or from a markdown file whose YAML front matter holds the settings
+// and whose body is the system prompt.
+type AgentDefinition struct {
+	Name        string `yaml:"name"` // Defaults to the file name without extension
+	Description string `yaml:"description"`
+	Prompt      string `yaml:"prompt"`
+
+	// Tools lists tool names or glob patterns; empty allows all tools
+	Tools []string `yaml:"tools"`
+
+	Model         string   `yaml:"model"`
+	Temperature   *float32 `yaml:"temperature"`
+	MaxTokens     int      `yaml:"max_tokens"`
+	MaxTurns      int      `yaml:"max_turns"`
+	ExecutionMode string   `yaml:"execution_mode"` // "sequential", "parallel" or "mixed"
+
+	Path string `yaml:"-"` // File the definition was loaded from
+}
+
+// LoadAgents reads all agent definitions (*.yaml, *.yml, *.md) in dir,
+// in file name order. A missing directory yields no definitions.
+func LoadAgents(dir string) ([]AgentDefinition, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read agents directory: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var defs []AgentDefinition
+	names := make(map[string]string)
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".md") {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		def, err := LoadAgent(path)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[def.Name]; ok {
+			return nil, fmt.Errorf("agent %s is defined in both %s and %s", def.Name, other, path)
+		}
+		names[def.Name] = path
+		defs = append(defs, *def)
+	}
+	return defs, nil
+}
+
+// LoadAgent reads a single agent definition file
+func LoadAgent(path string) (*AgentDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent definition: %w", err)
+	}
+
+	var def AgentDefinition
+	if filepath.Ext(path) == ".md" {
+		frontMatter, body, err := splitFrontMatter(data)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(frontMatter, &def); err != nil {
+			return nil, fmt.Errorf("agent %s: failed to parse front matter: %w", path, err)
+		}
+		if body := strings.TrimSpace(body); body != "" {
+			def.Prompt = body
+		}
+	} else if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("agent %s: failed to parse YAML: %w", path, err)
+	}
+
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	def.Prompt = strings.TrimSpace(def.Prompt)
+	def.Path = path
+
+	if err := def.Validate(); err != nil {
+		return nil, fmt.Errorf("agent %s (%s): %w", def.Name, path, err)
+	}
+	return &def, nil
+}
+
+// Validate checks an agent definition
+func (d *AgentDefinition) Validate() error {
+	for _, ch := range d.Name {
+		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '_' || ch == '-') {
+			return fmt.Errorf("name contains invalid character '%c' (only alphanumeric, underscore, and hyphen allowed)", ch)
+		}
+	}
+	if d.Prompt == "" {
+		return fmt.Errorf("prompt is required")
+	}
+	if d.Temperature != nil && (*d.Temperature < 0 || *d.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if d.MaxTokens < 0 || d.MaxTurns < 0 {
+		return fmt.Errorf("max_tokens and max_turns cannot be negative")
+	}
+	switch d.ExecutionMode {
+	case "", "sequential", "parallel", "mixed":
+	default:
+		return fmt.Errorf("unsupported execution_mode: %s (use sequential, parallel or mixed)", d.ExecutionMode)
+	}
+	return nil
+}
+
+// splitFrontMatter separates a leading "---" delimited YAML block from the
+// rest of a markdown file. Files without front matter are all body.
+func splitFrontMatter(data []byte) ([]byte, string, error) {
+	text := strings.ReplaceAll(strings.TrimPrefix(string(data), "\ufeff"), "\r\n", "\n")
+
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, text, nil
+	}
+
+	// Search from the newline before the block so empty front matter works
+	rest := text[len("---"):]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return nil, "", fmt.Errorf("front matter is not closed with ---")
+	}
+
+	frontMatter := rest[:end]
+	body := rest[end+len("\n---"):]
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+		body = body[nl+1:]
+	} else {
+		body = ""
+	}
+	return []byte(frontMatter), body, nil
+}
@@ -4,14 +4,159 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the complete Finta configuration
 type Config struct {
-	MCP   MCPConfig   `yaml:"mcp"`
-	Hooks HooksConfig `yaml:"hooks"`
+	LLM         LLMConfig              `yaml:"llm"`
+	Agents      map[string]AgentConfig `yaml:"agents"`
+	Compaction  CompactionConfig       `yaml:"compaction"`
+	Environment EnvironmentConfig      `yaml:"environment"`
+	Task        TaskConfig             `yaml:"task"`
+	Loop        LoopConfig             `yaml:"loop_detection"`
+	TurnLimit   TurnLimitConfig        `yaml:"turn_limit"`
+	Budget      BudgetConfig           `yaml:"budget"`
+	Pricing     map[string]PriceConfig `yaml:"pricing"`
+	MCP         MCPConfig              `yaml:"mcp"`
+	Hooks       HooksConfig            `yaml:"hooks"`
+}
+
+// PriceConfig is the price of a model in USD per million tokens.
+// Entries are matched by exact model name or by name prefix.
+type PriceConfig struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// CompactionConfig controls automatic compaction of conversation history.
+// Zero values fall back to the compact package defaults.
+type CompactionConfig struct {
+	Disabled       bool           `yaml:"disabled"`        // Never compact automatically (/compact still works)
+	Threshold      float64        `yaml:"threshold"`       // Fraction of the context window that triggers compaction
+	KeepRecent     int            `yaml:"keep_recent"`     // Most recent messages kept verbatim
+	MaxToolOutput  int            `yaml:"max_tool_output"` // Older tool outputs above this many characters are elided
+	ContextWindow  int            `yaml:"context_window"`  // Context window for every model, in tokens
+	ContextWindows map[string]int `yaml:"context_windows"` // Per-model context windows, e.g. for local models
+}
+
+// EnvironmentConfig controls the environment block (working directory, OS,
+// shell, date, git state, directory listing, MCP servers) in system prompts
+type EnvironmentConfig struct {
+	Disabled   bool `yaml:"disabled"`    // Leave the block out of system prompts
+	NoGit      bool `yaml:"no_git"`      // Skip git branch and working tree state
+	MaxEntries int  `yaml:"max_entries"` // Top-level entries listed; 0 uses the default, -1 omits the listing
+}
+
+// TaskConfig controls sub-agents launched by the Task tool
+type TaskConfig struct {
+	MaxConcurrency int `yaml:"max_concurrency"` // Sub-agents of a batch running at once (0 uses the default)
+}
+
+// LoopConfig controls the detection of agents repeating the same tool calls
+// across turns. Zero values use the agent package defaults.
+type LoopConfig struct {
+	Disabled             bool `yaml:"disabled"`
+	RepeatThreshold      int  `yaml:"repeat_threshold"`      // Turns with identical tool calls in a row
+	OscillationThreshold int  `yaml:"oscillation_threshold"` // Turns alternating between two sets of tool calls
+	MaxNotes             int  `yaml:"max_notes"`             // Corrective notes before stopping; -1 stops at once
+}
+
+// TurnLimitConfig controls what happens when an agent reaches its turn
+// limit before a final answer
+type TurnLimitConfig struct {
+	Summarize     bool `yaml:"summarize"`      // Make a final tool-less turn summarising progress
+	ContinueTurns int  `yaml:"continue_turns"` // More turns the REPL offers; 0 uses the default, -1 never asks
+}
+
+// BudgetConfig limits every agent run. Zero values are unlimited.
+type BudgetConfig struct {
+	MaxTokens    int           `yaml:"max_tokens"`     // Total tokens, including sub-agents
+	MaxCost      float64       `yaml:"max_cost"`       // Cost in USD, including sub-agents
+	Timeout      time.Duration `yaml:"timeout"`        // Wall-clock time, e.g. "10m"
+	MaxToolCalls int           `yaml:"max_tool_calls"` // Tool calls of the agent itself
+}
+
+// AgentConfig overrides the built-in settings of an agent type.
+// Unset fields keep the agent type's defaults.
+type AgentConfig struct {
+	// Model to call; may also name a client under llm.clients
+	Model       string   `yaml:"model"`
+	Temperature *float32 `yaml:"temperature"`
+	MaxTokens   int      `yaml:"max_tokens"`
+	MaxTurns    int      `yaml:"max_turns"`
+
+	// ToolChoice is "auto", "none", "required" or a tool name the agent
+	// must call first
+	ToolChoice        string   `yaml:"tool_choice"`
+	ParallelToolCalls *bool    `yaml:"parallel_tool_calls"`
+	TopP              float32  `yaml:"top_p"`
+	Stop              []string `yaml:"stop"`
+	Seed              *int     `yaml:"seed"`
+}
+
+// LLMConfig contains LLM client settings
+type LLMConfig struct {
+	// Providers holds per-provider settings keyed by provider name ("openai", "anthropic")
+	Providers map[string]ProviderConfig `yaml:"providers"`
+	// Clients defines named LLM clients that the router can choose between
+	Clients map[string]ClientConfig `yaml:"clients"`
+	// Router selects a named client per request; used when Default is set
+	Router RouterConfig `yaml:"router"`
+}
+
+// ClientConfig defines a single named LLM client
+type ClientConfig struct {
+	Provider       string `yaml:"provider"`        // "openai" or "anthropic"
+	Model          string `yaml:"model"`           // Model name sent to the API
+	APIKey         string `yaml:"api_key"`         // API key with ${VAR} support
+	BaseURL        string `yaml:"base_url"`        // Optional custom endpoint
+	ThinkingBudget int    `yaml:"thinking_budget"` // Extended thinking budget (anthropic only)
+}
+
+// RouterConfig controls how requests are routed across named clients
+type RouterConfig struct {
+	// Default is the fallback chain used when no rule matches
+	Default []string `yaml:"default"`
+	// Rules are evaluated in order; the first match selects the chain
+	Rules []RouteRule `yaml:"rules"`
+	// Timeout bounds each attempt (until the first delta when streaming); 0 disables
+	Timeout time.Duration `yaml:"timeout"`
+	// FailureThreshold is the number of consecutive failures after which a
+	// client is skipped for Cooldown (0 uses the router default)
+	FailureThreshold int           `yaml:"failure_threshold"`
+	Cooldown         time.Duration `yaml:"cooldown"`
+}
+
+// RouteRule selects a client chain for matching requests.
+// Empty match fields match any request.
+type RouteRule struct {
+	Agent    string   `yaml:"agent"`     // Agent name, e.g. "explore" (supports * wildcards)
+	HasTools *bool    `yaml:"has_tools"` // Match on whether the request offers tools
+	Clients  []string `yaml:"clients"`   // Fallback chain of client names
+}
+
+// Enabled reports whether a router is configured
+func (r *RouterConfig) Enabled() bool {
+	return len(r.Default) > 0
+}
+
+// ProviderConfig contains settings for a single LLM provider
+type ProviderConfig struct {
+	Retry RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig controls retries of failed LLM calls.
+// Zero values fall back to the retry package defaults; Jitter is a pointer
+// so that 0 (no jitter) can be set explicitly.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`    // Total attempts including the first (1 disables retries)
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // Delay before the first retry, e.g. "1s"
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // Upper bound for a single delay, e.g. "30s"
+	Multiplier     float64       `yaml:"multiplier"`      // Backoff growth factor per attempt
+	Jitter         *float64      `yaml:"jitter"`          // Random fraction (0-1) subtracted from each delay
 }
 
 // HooksConfig contains hook-related settings
@@ -85,6 +230,49 @@ func LoadWithDefaults() (*Config, error) {
 
 // Validate checks config correctness
 func (c *Config) Validate() error {
+	if err := c.LLM.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Compaction.Validate(); err != nil {
+		return fmt.Errorf("compaction: %w", err)
+	}
+
+	if c.Environment.MaxEntries < -1 {
+		return fmt.Errorf("environment: max_entries must be -1 or more")
+	}
+
+	if c.Task.MaxConcurrency < 0 {
+		return fmt.Errorf("task: max_concurrency cannot be negative")
+	}
+
+	if c.Loop.RepeatThreshold < 0 || c.Loop.OscillationThreshold < 0 {
+		return fmt.Errorf("loop_detection: thresholds cannot be negative")
+	}
+	if c.Loop.MaxNotes < -1 {
+		return fmt.Errorf("loop_detection: max_notes must be -1 or more")
+	}
+
+	if c.TurnLimit.ContinueTurns < -1 {
+		return fmt.Errorf("turn_limit: continue_turns must be -1 or more")
+	}
+
+	if c.Budget.MaxTokens < 0 || c.Budget.MaxCost < 0 || c.Budget.Timeout < 0 || c.Budget.MaxToolCalls < 0 {
+		return fmt.Errorf("budget: limits cannot be negative")
+	}
+
+	for model, price := range c.Pricing {
+		if price.Input < 0 || price.Output < 0 {
+			return fmt.Errorf("pricing %s: prices cannot be negative", model)
+		}
+	}
+
+	for name, agent := range c.Agents {
+		if err := agent.Validate(); err != nil {
+			return fmt.Errorf("agent %s: %w", name, err)
+		}
+	}
+
 	if len(c.MCP.Servers) == 0 {
 		// Empty config is valid
 		return nil
@@ -139,3 +327,106 @@ func (s *MCPServerConfig) Validate() error {
 
 	return nil
 }
+
+// Validate checks agent override values
+func (a *AgentConfig) Validate() error {
+	if a.Temperature != nil && (*a.Temperature < 0 || *a.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if a.MaxTokens < 0 || a.MaxTurns < 0 {
+		return fmt.Errorf("max_tokens and max_turns cannot be negative")
+	}
+	if a.TopP < 0 || a.TopP > 1 {
+		return fmt.Errorf("top_p must be between 0 and 1")
+	}
+	if a.ToolChoice == "function" {
+		return fmt.Errorf("tool_choice must be auto, none, required or a tool name")
+	}
+	return nil
+}
+
+// Validate checks compaction settings
+func (c *CompactionConfig) Validate() error {
+	if c.Threshold < 0 || c.Threshold > 1 {
+		return fmt.Errorf("threshold must be between 0 and 1")
+	}
+	if c.KeepRecent < 0 || c.MaxToolOutput < 0 || c.ContextWindow < 0 {
+		return fmt.Errorf("keep_recent, max_tool_output and context_window cannot be negative")
+	}
+	return nil
+}
+
+// Validate checks LLM provider, client and router settings
+func (l *LLMConfig) Validate() error {
+	for name, provider := range l.Providers {
+		if err := provider.Retry.Validate(); err != nil {
+			return fmt.Errorf("llm provider %s: %w", name, err)
+		}
+	}
+
+	for name, client := range l.Clients {
+		switch client.Provider {
+		case "openai", "anthropic":
+		case "":
+			return fmt.Errorf("llm client %s: provider is required", name)
+		default:
+			return fmt.Errorf("llm client %s: unsupported provider: %s", name, client.Provider)
+		}
+		if client.Model == "" {
+			return fmt.Errorf("llm client %s: model is required", name)
+		}
+	}
+
+	if len(l.Router.Rules) > 0 && !l.Router.Enabled() {
+		return fmt.Errorf("llm router: rules require a default client chain")
+	}
+
+	checkChain := func(where string, names []string) error {
+		if len(names) == 0 {
+			return fmt.Errorf("llm router %s: at least one client is required", where)
+		}
+		for _, name := range names {
+			if _, ok := l.Clients[name]; !ok {
+				return fmt.Errorf("llm router %s: unknown client: %s", where, name)
+			}
+		}
+		return nil
+	}
+
+	if l.Router.Enabled() {
+		if err := checkChain("default", l.Router.Default); err != nil {
+			return err
+		}
+	}
+	for i, rule := range l.Router.Rules {
+		if err := checkChain(fmt.Sprintf("rule #%d", i+1), rule.Clients); err != nil {
+			return err
+		}
+	}
+
+	if l.Router.Timeout < 0 || l.Router.Cooldown < 0 || l.Router.FailureThreshold < 0 {
+		return fmt.Errorf("llm router: timeout, cooldown and failure_threshold cannot be negative")
+	}
+
+	return nil
+}
+
+// Validate checks retry settings
+func (r *RetryConfig) Validate() error {
+	if r.MaxAttempts < 0 {
+		return fmt.Errorf("retry.max_attempts cannot be negative")
+	}
+	if r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff durations cannot be negative")
+	}
+	if r.MaxBackoff > 0 && r.InitialBackoff > r.MaxBackoff {
+		return fmt.Errorf("retry.initial_backoff (%s) exceeds retry.max_backoff (%s)", r.InitialBackoff, r.MaxBackoff)
+	}
+	if r.Multiplier != 0 && r.Multiplier < 1 {
+		return fmt.Errorf("retry.multiplier must be >= 1")
+	}
+	if r.Jitter != nil && (*r.Jitter < 0 || *r.Jitter > 1) {
+		return fmt.Errorf("retry.jitter must be between 0 and 1")
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"finta/internal/config"
+)
+
+// gitTimeout bounds each git command so a slow repository cannot delay a run
+const gitTimeout = 2 * time.Second
+
+// Config controls what the environment block contains
+type Config struct {
+	Disabled   bool            // Leave the block out of system prompts
+	Git        bool            // Include git branch and working tree state
+	MaxEntries int             // Top-level entries listed; 0 omits the listing
+	MCPServers func() []string // Names of connected MCP servers; nil omits them
+}
+
+// DefaultConfig returns the default environment settings
+func DefaultConfig() Config {
+	return Config{
+		Git:        true,
+		MaxEntries: 50,
+	}
+}
+
+// ConfigFrom builds settings from the YAML config, applying defaults for unset fields
+func ConfigFrom(c config.EnvironmentConfig) Config {
+	cfg := DefaultConfig()
+	cfg.Disabled = c.Disabled
+	cfg.Git = !c.NoGit
+	if c.MaxEntries > 0 {
+		cfg.MaxEntries = c.MaxEntries
+	} else if c.MaxEntries < 0 {
+		cfg.MaxEntries = 0
+	}
+	return cfg
+}
+
+// Collector generates the environment block of system prompts
+type Collector struct {
+	dir string
+	cfg Config
+	now func() time.Time
+}
+
+// New creates a collector for the environment of dir
+func New(dir string, cfg Config) *Collector {
+	return &Collector{dir: dir, cfg: cfg, now: time.Now}
+}
+
+// Block describes the current environment as a system prompt section.
+// It is generated anew on every call so that it reflects the latest state.
+// A disabled collector returns an empty block.
+func (c *Collector) Block() string {
+	if c.cfg.Disabled {
+		return ""
+	}
+
+	dir, err := filepath.Abs(c.dir)
+	if err != nil {
+		dir = c.dir
+	}
+
+	var b strings.Builder
+	b.WriteString("# Environment\n\n")
+	fmt.Fprintf(&b, "- Working directory: %s\n", dir)
+	fmt.Fprintf(&b, "- Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "- Shell: %s\n", shell())
+	fmt.Fprintf(&b, "- Date: %s\n", c.now().Format("2006-01-02 (Monday)"))
+	if c.cfg.Git {
+		fmt.Fprintf(&b, "- Git: %s\n", gitState(dir))
+	}
+	if c.cfg.MCPServers != nil {
+		servers := c.cfg.MCPServers()
+		sort.Strings(servers)
+		if len(servers) == 0 {
+			b.WriteString("- MCP servers: none\n")
+		} else {
+			fmt.Fprintf(&b, "- MCP servers: %s\n", strings.Join(servers, ", "))
+		}
+	}
+
+	if c.cfg.MaxEntries > 0 {
+		if listing := listDir(dir, c.cfg.MaxEntries); listing != "" {
+			b.WriteString("\nTop-level entries of the working directory:\n")
+			b.WriteString(listing)
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// shell returns the name of the user's shell
+func shell() string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return filepath.Base(sh)
+	}
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return filepath.Base(comspec)
+		}
+		return "cmd.exe"
+	}
+	return "sh"
+}
+
+// gitState describes the branch and working tree of the repository at dir
+func gitState(dir string) string {
+	if _, err := git(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return "not a git repository"
+	}
+
+	// symbolic-ref also names branches without commits yet
+	branch := "detached HEAD"
+	if name, err := git(dir, "symbolic-ref", "--short", "HEAD"); err == nil {
+		branch = "branch " + name
+	} else if commit, err := git(dir, "rev-parse", "--short", "HEAD"); err == nil {
+		branch = "detached at " + commit
+	}
+
+	status, err := git(dir, "status", "--porcelain")
+	switch {
+	case err != nil:
+		return branch
+	case status == "":
+		return branch + ", clean"
+	default:
+		return fmt.Sprintf("%s, %d uncommitted changes", branch, strings.Count(status, "\n")+1)
+	}
+}
+
+// git runs a git command in dir and returns its trimmed output
+func git(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// listDir lists the entries of dir, directories with a trailing slash,
+// skipping hidden entries
+func listDir(dir string, max int) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if e.IsDir() {
+			names = append(names, e.Name()+"/")
+		} else {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, name := range names {
+		if i == max {
+			fmt.Fprintf(&b, "... and %d more\n", len(names)-max)
+			break
+		}
+		b.WriteString(name + "\n")
+	}
+	return b.String()
+}
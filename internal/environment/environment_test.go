@@ -0,0 +1,66 @@
+package environment
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlock_DescribesEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"go.mod", "main.go", ".hidden"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "cmd"), 0755)
+	t.Setenv("SHELL", "/bin/zsh")
+
+	cfg := DefaultConfig()
+	cfg.Git = false
+	cfg.MaxEntries = 2
+	cfg.MCPServers = func() []string { return []string{"github", "fs"} }
+
+	c := New(dir, cfg)
+	c.now = func() time.Time { return time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC) }
+
+	block := c.Block()
+	for _, want := range []string{
+		"- Working directory: " + dir,
+		"- Shell: zsh",
+		"- Date: 2026-10-16 (Friday)",
+		"- MCP servers: fs, github",
+		"cmd/\ngo.mod\n... and 1 more",
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("Expected block to contain %q, got:\n%s", want, block)
+		}
+	}
+	if strings.Contains(block, ".hidden") || strings.Contains(block, "Git:") {
+		t.Errorf("Expected hidden entries and git state to be left out, got:\n%s", block)
+	}
+}
+
+func TestBlock_GitState(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.MaxEntries = 0
+
+	if block := New(dir, cfg).Block(); !strings.Contains(block, "- Git: not a git repository") {
+		t.Errorf("Expected no repository, got:\n%s", block)
+	}
+
+	if out, err := exec.Command("git", "-C", dir, "init", "-q", "-b", "trunk").CombinedOutput(); err != nil {
+		t.Skipf("git init failed: %v %s", err, out)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+
+	if block := New(dir, cfg).Block(); !strings.Contains(block, "- Git: branch trunk, 1 uncommitted changes") {
+		t.Errorf("Expected dirty trunk branch, got:\n%s", block)
+	}
+}
@@ -94,6 +94,14 @@ func NewToolConfirmHandler(tools ...string) *ToolConfirmHandler {
 	}
 }
 
+// NewToolConfirmHandlerWithIO creates a handler with custom IO
+func NewToolConfirmHandlerWithIO(reader io.Reader, writer io.Writer, tools ...string) *ToolConfirmHandler {
+	h := NewToolConfirmHandler(tools...)
+	h.reader = reader
+	h.writer = writer
+	return h
+}
+
 func (h *ToolConfirmHandler) Name() string {
 	return "tool_confirm"
 }
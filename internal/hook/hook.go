@@ -2,6 +2,7 @@ package hook
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -17,11 +18,35 @@ const (
 	BeforeBashCommand HookPoint = "before_bash_command"
 	AfterBashCommand  HookPoint = "after_bash_command"
 
-	// Agent lifecycle hooks
+	// Agent lifecycle hooks, for the top-level agent and sub-agents alike.
+	// Data: "agent" (name), "task", "depth" (nesting depth, 0 for the
+	// top-level agent); OnAgentEnd adds "output" (*agent.Output, nil on
+	// failure) and "error". Denying OnAgentStart aborts the run.
 	OnAgentStart HookPoint = "on_agent_start"
 	OnAgentEnd   HookPoint = "on_agent_end"
+
+	// LLM call hooks. Data: "agent", "depth", "turn", "request"
+	// (*llm.ChatRequest); BeforeLLMCall adds "messages" ([]llm.Message) and
+	// AfterLLMCall adds "response" (*llm.ChatResponse) and "duration".
+	// BeforeLLMCall handlers may return replacement messages as Modified,
+	// or deny to veto the call.
+	BeforeLLMCall HookPoint = "before_llm_call"
+	AfterLLMCall  HookPoint = "after_llm_call"
+
+	// Loop detection hook, fired when an agent repeats the same tool calls
+	// across turns. Data: "agent", "depth", "turn", "kind" ("repeat" or
+	// "oscillation"), "turns", "tools" ([]string) and "action" ("note" when
+	// a corrective note is added, "stop" when the run ends).
+	OnLoopDetected HookPoint = "on_loop_detected"
+
+	// REPL input hook. Data: "prompt". Handlers may return a rewritten
+	// prompt as Modified, or deny to reject the input.
+	OnUserPromptSubmit HookPoint = "on_user_prompt_submit"
 )
 
+// ErrDenied is wrapped by errors of operations a handler denied
+var ErrDenied = errors.New("denied by hook")
+
 // HookData carries context-specific information for hooks
 type HookData struct {
 	Point     HookPoint
@@ -51,6 +76,12 @@ func (d *HookData) Get(key string) any {
 	return d.Data[key]
 }
 
+// Modified returns the data returned as Modified by the last handler that
+// changed it, or nil
+func (d *HookData) Modified() any {
+	return d.Data["_modified"]
+}
+
 // GetString retrieves a string data field
 func (d *HookData) GetString(key string) string {
 	if v, ok := d.Data[key].(string); ok {
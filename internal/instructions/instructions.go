@@ -0,0 +1,158 @@
+package instructions
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the name of project instruction files
+const FileName = "FINTA.md"
+
+// maxImportDepth bounds nested @import chains
+const maxImportDepth = 5
+
+// File is a loaded instruction file with its imports expanded
+type File struct {
+	Path    string
+	Content string
+}
+
+// Discover finds the instruction files that apply to dir, from the most
+// general to the most specific: ~/.config/finta/FINTA.md, then FINTA.md in
+// each parent directory down to dir itself. Later files can refine the
+// instructions of earlier ones.
+func Discover(dir string) ([]File, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "finta", FileName))
+	}
+
+	var chain []string
+	for d := dir; ; d = filepath.Dir(d) {
+		chain = append(chain, filepath.Join(d, FileName))
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		paths = append(paths, chain[i])
+	}
+
+	var files []File
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil || seen[path] {
+			continue
+		}
+		seen[path] = true
+		content, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(content) != "" {
+			files = append(files, File{Path: path, Content: content})
+		}
+	}
+	return files, nil
+}
+
+// Load reads an instruction file, replacing each "@import <path>" line
+// with the content of the imported file. Relative paths are resolved
+// against the importing file's directory; "~/" refers to the home directory.
+// Lines inside code fences are left as they are.
+func Load(path string) (string, error) {
+	return load(path, nil)
+}
+
+func load(path string, stack []string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range stack {
+		if p == abs {
+			return "", fmt.Errorf("import cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	if len(stack) > maxImportDepth {
+		return "", fmt.Errorf("imports nested deeper than %d levels at %s", maxImportDepth, abs)
+	}
+	stack = append(stack, abs)
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		if len(stack) > 1 {
+			return "", fmt.Errorf("failed to import %s (from %s): %w", abs, stack[len(stack)-2], err)
+		}
+		return "", fmt.Errorf("failed to read instructions: %w", err)
+	}
+
+	var out strings.Builder
+	inFence := false
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+
+		target, ok := strings.CutPrefix(trimmed, "@import ")
+		if inFence || !ok {
+			out.WriteString(line)
+			out.WriteByte('\n')
+			continue
+		}
+
+		imported, err := load(resolve(strings.TrimSpace(target), filepath.Dir(abs)), stack)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(strings.TrimRight(imported, "\n"))
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", abs, err)
+	}
+	return out.String(), nil
+}
+
+// resolve turns an import target into a path
+func resolve(target, baseDir string) string {
+	if rest, ok := strings.CutPrefix(target, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(baseDir, target)
+}
+
+// Format renders instruction files as a system prompt section
+func Format(files []File) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("# Project Instructions\n\n")
+	b.WriteString("The user provided these instructions in " + FileName + " files. ")
+	b.WriteString("Follow them; later files are more specific and take precedence over earlier ones.")
+	for _, f := range files {
+		fmt.Fprintf(&b, "\n\n## %s\n\n%s", f.Path, strings.TrimSpace(f.Content))
+	}
+	return b.String()
+}
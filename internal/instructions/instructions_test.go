@@ -0,0 +1,57 @@
+package instructions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscover_LayersParentsAndImports(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	root := t.TempDir()
+	project := filepath.Join(root, "repo")
+	writeFile(t, filepath.Join(root, FileName), "Use British spelling.")
+	writeFile(t, filepath.Join(project, FileName), "# Repo\n\n@import docs/build.md\n\n```\n@import not-a-directive.md\n```")
+	writeFile(t, filepath.Join(project, "docs", "build.md"), "Build with `go build ./...`.")
+
+	files, err := Discover(project)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != filepath.Join(root, FileName) {
+		t.Fatalf("Expected parent file before project file, got %+v", files)
+	}
+	if !strings.Contains(files[1].Content, "Build with `go build ./...`.") {
+		t.Errorf("Expected import to be expanded, got %q", files[1].Content)
+	}
+	if !strings.Contains(files[1].Content, "@import not-a-directive.md") {
+		t.Errorf("Expected import inside a code fence to be kept, got %q", files[1].Content)
+	}
+
+	prompt := Format(files)
+	if strings.Index(prompt, "British") > strings.Index(prompt, "# Repo") {
+		t.Errorf("Expected general instructions first, got %q", prompt)
+	}
+}
+
+func TestLoad_ImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "@import b.md")
+	writeFile(t, filepath.Join(dir, "b.md"), "@import a.md")
+
+	if _, err := Load(filepath.Join(dir, "a.md")); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected import cycle error, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
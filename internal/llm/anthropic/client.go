@@ -0,0 +1,498 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"finta/internal/llm"
+)
+
+const (
+	// DefaultBaseURL is the public Anthropic API endpoint
+	DefaultBaseURL = "https://api.anthropic.com"
+
+	// APIVersion is the Messages API version sent in the anthropic-version header
+	APIVersion = "2023-06-01"
+
+	// defaultMaxTokens is used when the request does not set MaxTokens,
+	// since the Messages API requires max_tokens on every call
+	defaultMaxTokens = 4096
+)
+
+type Client struct {
+	httpClient     *http.Client
+	apiKey         string
+	model          string
+	baseURL        string
+	thinkingBudget int
+}
+
+// NewClient creates a new Anthropic Messages API client with the given API key and model.
+// If baseURL is empty, it uses the default Anthropic API endpoint.
+// If baseURL is provided, it uses the custom endpoint (useful for proxies and gateways).
+func NewClient(apiKey, model string, baseURL ...string) *Client {
+	url := DefaultBaseURL
+	if len(baseURL) > 0 && baseURL[0] != "" {
+		url = strings.TrimRight(baseURL[0], "/")
+	}
+
+	return &Client{
+		httpClient: http.DefaultClient,
+		apiKey:     apiKey,
+		model:      model,
+		baseURL:    url,
+	}
+}
+
+// SetThinkingBudget enables extended thinking with the given token budget.
+// A budget of 0 disables thinking.
+func (c *Client) SetThinkingBudget(tokens int) {
+	c.thinkingBudget = tokens
+}
+
+// SetHTTPClient replaces the HTTP client used for API calls
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	body := c.buildRequest(req, false)
+
+	httpResp, err := c.send(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp messagesResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return c.convertResponse(&resp), nil
+}
+
+func (c *Client) Provider() string {
+	return "anthropic"
+}
+
+func (c *Client) Model() string {
+	return c.model
+}
+
+// send posts a request body to the Messages endpoint and returns the raw
+// response. Non-2xx responses are converted into an *llm.APIError.
+func (c *Client) send(ctx context.Context, body *messagesRequest) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", APIVersion)
+	if body.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		defer httpResp.Body.Close()
+		return nil, newAPIError(httpResp)
+	}
+
+	return httpResp, nil
+}
+
+// newAPIError converts a non-2xx response into an *llm.APIError
+func newAPIError(resp *http.Response) *llm.APIError {
+	apiErr := &llm.APIError{
+		Provider:   "anthropic",
+		StatusCode: resp.StatusCode,
+		RetryAfter: llm.ParseRetryAfter(resp.Header, time.Now()),
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var envelope struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &envelope); err == nil && envelope.Error.Message != "" {
+		apiErr.Type = envelope.Error.Type
+		apiErr.Message = envelope.Error.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+
+	return apiErr
+}
+
+// Wire types for the Messages API
+
+type messagesRequest struct {
+	Model       string          `json:"model"`
+	System      string          `json:"system,omitempty"`
+	Messages    []message       `json:"messages"`
+	Tools       []toolDef       `json:"tools,omitempty"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	TopP        float32         `json:"top_p,omitempty"`
+	Stop        []string        `json:"stop_sequences,omitempty"`
+	ToolChoice  *toolChoice     `json:"tool_choice,omitempty"`
+	Thinking    *thinkingConfig `json:"thinking,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+}
+
+type toolChoice struct {
+	Type                   string `json:"type"` // auto, any, tool or none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type thinkingConfig struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// thinking; redacted_thinking carries Data instead
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// image
+	Source *imageSource `json:"source,omitempty"`
+
+	// tool_result; Content is a string, or []contentBlock when images are included
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// imageSource carries inline image data for image blocks
+type imageSource struct {
+	Type      string `json:"type"` // "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type toolDef struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type messagesResponse struct {
+	ID         string         `json:"id"`
+	Role       string         `json:"role"`
+	Model      string         `json:"model"`
+	Content    []contentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      usage          `json:"usage"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// buildRequest converts a ChatRequest into a Messages API request body
+func (c *Client) buildRequest(req *llm.ChatRequest, stream bool) *messagesRequest {
+	system, messages := c.convertMessages(req.Messages)
+
+	body := &messagesRequest{
+		Model:     c.model,
+		System:    system,
+		Messages:  messages,
+		Tools:     c.convertTools(req.Tools),
+		MaxTokens: req.MaxTokens,
+		Stream:    stream,
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = defaultMaxTokens
+	}
+	if req.ResponseFormat != nil {
+		// The Messages API has no response format; ask for JSON in the prompt
+		body.System = strings.TrimSpace(body.System + "\n\n" + req.ResponseFormat.Instruction())
+	}
+	body.TopP = req.TopP
+	body.Stop = req.Stop
+	if len(body.Tools) > 0 {
+		body.ToolChoice = convertToolChoice(req.ToolChoice, req.ParallelToolCalls)
+	}
+
+	if c.thinkingBudget > 0 {
+		// Extended thinking requires max_tokens > budget_tokens and does not
+		// accept a custom temperature
+		body.Thinking = &thinkingConfig{Type: "enabled", BudgetTokens: c.thinkingBudget}
+		if body.MaxTokens <= c.thinkingBudget {
+			body.MaxTokens = c.thinkingBudget + defaultMaxTokens
+		}
+	} else if req.Temperature > 0 {
+		temp := req.Temperature
+		body.Temperature = &temp
+	}
+
+	return body
+}
+
+// convertToolChoice maps the tool controls of a request onto tool_choice.
+// Seed is not supported by the Messages API and is dropped.
+func convertToolChoice(choice *llm.ToolChoice, parallel *bool) *toolChoice {
+	if choice == nil && parallel == nil {
+		return nil
+	}
+
+	tc := &toolChoice{Type: "auto"}
+	if choice != nil {
+		switch choice.Mode {
+		case llm.ToolChoiceNone:
+			tc.Type = "none"
+		case llm.ToolChoiceRequired:
+			tc.Type = "any"
+		case llm.ToolChoiceFunction:
+			tc.Type, tc.Name = "tool", choice.Name
+		}
+	}
+	if parallel != nil && !*parallel && tc.Type != "none" {
+		tc.DisableParallelToolUse = true
+	}
+	return tc
+}
+
+// Helper method: message format conversion
+// System messages are lifted into the top-level system prompt, tool results
+// become tool_result blocks inside a user turn, and consecutive messages with
+// the same role are merged since the API requires alternating roles.
+func (c *Client) convertMessages(msgs []llm.Message) (string, []message) {
+	var systemParts []string
+	result := make([]message, 0, len(msgs))
+
+	for _, msg := range msgs {
+		var role string
+		var blocks []contentBlock
+
+		switch msg.Role {
+		case llm.RoleSystem:
+			if msg.Content != "" {
+				systemParts = append(systemParts, msg.Content)
+			}
+			continue
+
+		case llm.RoleTool:
+			role = "user"
+			block := contentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			}
+			if msg.HasImages() {
+				block.Content = convertParts(msg.Parts)
+			}
+			blocks = append(blocks, block)
+
+		case llm.RoleAssistant:
+			role = "assistant"
+			for _, b := range msg.Thinking {
+				switch {
+				case b.Redacted != "":
+					blocks = append(blocks, contentBlock{Type: "redacted_thinking", Data: b.Redacted})
+				case b.Signature != "":
+					// Thinking blocks can only be replayed with their signature
+					blocks = append(blocks, contentBlock{
+						Type:      "thinking",
+						Thinking:  b.Thinking,
+						Signature: b.Signature,
+					})
+				}
+			}
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, contentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: toolInput(tc.Function.Arguments),
+				})
+			}
+
+		default:
+			role = "user"
+			if msg.HasImages() {
+				blocks = append(blocks, convertParts(msg.Parts)...)
+			} else if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// Merge with the previous message when roles repeat
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+			continue
+		}
+
+		result = append(result, message{Role: role, Content: blocks})
+	}
+
+	return strings.Join(systemParts, "\n\n"), result
+}
+
+// convertParts converts content parts to text and base64 image blocks
+func convertParts(parts []llm.ContentPart) []contentBlock {
+	blocks := make([]contentBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case llm.ContentPartImage:
+			blocks = append(blocks, contentBlock{
+				Type: "image",
+				Source: &imageSource{
+					Type:      "base64",
+					MediaType: part.MIMEType,
+					Data:      base64.StdEncoding.EncodeToString(part.Data),
+				},
+			})
+		default:
+			if part.Text != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: part.Text})
+			}
+		}
+	}
+	return blocks
+}
+
+// toolInput converts tool call arguments into a JSON object for tool_use blocks
+func toolInput(arguments string) json.RawMessage {
+	trimmed := strings.TrimSpace(arguments)
+	if trimmed == "" || !json.Valid([]byte(trimmed)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(trimmed)
+}
+
+// Helper method: tool definition conversion
+func (c *Client) convertTools(tools []*llm.ToolDefinition) []toolDef {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	result := make([]toolDef, len(tools))
+	for i, t := range tools {
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		result[i] = toolDef{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		}
+	}
+	return result
+}
+
+// Helper method: response conversion
+func (c *Client) convertResponse(resp *messagesResponse) *llm.ChatResponse {
+	result := &llm.ChatResponse{
+		Message: llm.Message{
+			Role: llm.RoleAssistant,
+		},
+		StopReason: convertStopReason(resp.StopReason),
+		Usage: llm.Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+		Model: resp.Model,
+	}
+	if result.Model == "" {
+		result.Model = c.model
+	}
+
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "thinking":
+			result.Message.Reason += block.Thinking
+			result.Message.Thinking = append(result.Message.Thinking, llm.ThinkingBlock{
+				Thinking:  block.Thinking,
+				Signature: block.Signature,
+			})
+		case "redacted_thinking":
+			result.Message.Thinking = append(result.Message.Thinking, llm.ThinkingBlock{Redacted: block.Data})
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			result.Message.ToolCalls = append(result.Message.ToolCalls, &llm.ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: &llm.FunctionCall{
+					Name:      block.Name,
+					Arguments: args,
+				},
+			})
+		}
+	}
+	result.Message.Content = text.String()
+
+	if len(result.Message.ToolCalls) > 0 {
+		result.StopReason = llm.StopReasonToolCalls
+	}
+
+	return result
+}
+
+// convertStopReason maps Anthropic stop reasons onto the shared StopReason values
+func convertStopReason(reason string) llm.StopReason {
+	switch reason {
+	case "tool_use":
+		return llm.StopReasonToolCalls
+	case "max_tokens":
+		return llm.StopReasonLength
+	default:
+		// end_turn, stop_sequence, pause_turn
+		return llm.StopReasonStop
+	}
+}
@@ -0,0 +1,281 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"finta/internal/llm"
+)
+
+func TestConvertMessages_BlocksAndRoleMerging(t *testing.T) {
+	client := NewClient("key", "claude-test")
+
+	system, msgs := client.convertMessages([]llm.Message{
+		{Role: llm.RoleSystem, Content: "be helpful"},
+		{Role: llm.RoleUser, Content: "list files"},
+		{
+			Role:   llm.RoleAssistant,
+			Reason: "I should run ls",
+			Thinking: []llm.ThinkingBlock{
+				{Thinking: "I should", Signature: "sig1"},
+				{Redacted: "opaque"},
+				{Thinking: " run ls", Signature: "sig2"},
+			},
+			ToolCalls: []*llm.ToolCall{
+				{ID: "tu_1", Function: &llm.FunctionCall{Name: "bash", Arguments: `{"command":"ls"}`}},
+				{ID: "tu_2", Function: &llm.FunctionCall{Name: "glob", Arguments: ""}},
+			},
+		},
+		{Role: llm.RoleTool, ToolCallID: "tu_1", Content: "a.go"},
+		{Role: llm.RoleTool, ToolCallID: "tu_2", Content: "b.go"},
+		{Role: llm.RoleUser, Content: "thanks"},
+	})
+
+	if system != "be helpful" {
+		t.Errorf("Expected system prompt to be lifted, got %q", system)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatalf("Expected 3 messages (user, assistant, user), got %d", len(msgs))
+	}
+
+	assistant := msgs[1]
+	if assistant.Role != "assistant" || len(assistant.Content) != 5 {
+		t.Fatalf("Expected assistant with 3 thinking + 2 tool_use blocks, got %+v", assistant)
+	}
+	if b := assistant.Content[0]; b.Type != "thinking" || b.Thinking != "I should" || b.Signature != "sig1" {
+		t.Errorf("Expected the first signed thinking block, got %+v", b)
+	}
+	if b := assistant.Content[1]; b.Type != "redacted_thinking" || b.Data != "opaque" {
+		t.Errorf("Expected the redacted block passed through, got %+v", b)
+	}
+	if b := assistant.Content[2]; b.Type != "thinking" || b.Thinking != " run ls" || b.Signature != "sig2" {
+		t.Errorf("Expected the second thinking block with its own signature, got %+v", b)
+	}
+	if string(assistant.Content[4].Input) != "{}" {
+		t.Errorf("Expected empty arguments to become {}, got %s", assistant.Content[4].Input)
+	}
+
+	// Tool results and the following user text are merged into one user turn
+	results := msgs[2]
+	if results.Role != "user" || len(results.Content) != 3 {
+		t.Fatalf("Expected merged user turn with 3 blocks, got %+v", results)
+	}
+	if results.Content[0].Type != "tool_result" || results.Content[0].ToolUseID != "tu_1" {
+		t.Errorf("Expected tool_result for tu_1, got %+v", results.Content[0])
+	}
+	if results.Content[2].Type != "text" || results.Content[2].Text != "thanks" {
+		t.Errorf("Expected trailing text block, got %+v", results.Content[2])
+	}
+}
+
+func TestConvertMessages_UnsignedReasoningDropped(t *testing.T) {
+	client := NewClient("key", "claude-test")
+
+	_, msgs := client.convertMessages([]llm.Message{
+		{Role: llm.RoleUser, Content: "hi"},
+		{Role: llm.RoleAssistant, Reason: "from another provider", Content: "hello"},
+	})
+
+	if len(msgs[1].Content) != 1 || msgs[1].Content[0].Type != "text" {
+		t.Errorf("Expected only a text block for unsigned reasoning, got %+v", msgs[1].Content)
+	}
+}
+
+func TestConvertMessages_ImageToolResult(t *testing.T) {
+	client := NewClient("key", "claude-test")
+
+	_, msgs := client.convertMessages([]llm.Message{
+		{Role: llm.RoleUser, Content: "show me"},
+		{Role: llm.RoleAssistant, ToolCalls: []*llm.ToolCall{{ID: "tu_1", Function: &llm.FunctionCall{Name: "read", Arguments: "{}"}}}},
+		{
+			Role:       llm.RoleTool,
+			ToolCallID: "tu_1",
+			Content:    "[Image 1: a.png]",
+			Parts:      []llm.ContentPart{llm.TextPart("[Image 1: a.png]"), llm.ImagePart("image/png", []byte("png"))},
+		},
+	})
+
+	blocks, ok := msgs[2].Content[0].Content.([]contentBlock)
+	if !ok || len(blocks) != 2 {
+		t.Fatalf("Expected tool_result with text and image blocks, got %+v", msgs[2].Content[0].Content)
+	}
+	if blocks[1].Type != "image" || blocks[1].Source.MediaType != "image/png" || blocks[1].Source.Data != "cG5n" {
+		t.Errorf("Unexpected image block: %+v", blocks[1].Source)
+	}
+}
+
+func TestChat_ToolUseResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") != APIVersion {
+			t.Errorf("Missing auth or version headers")
+		}
+
+		var req messagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.MaxTokens != defaultMaxTokens {
+			t.Errorf("Expected default max_tokens, got %d", req.MaxTokens)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Name != "read" {
+			t.Errorf("Expected read tool definition, got %+v", req.Tools)
+		}
+
+		fmt.Fprint(w, `{
+			"id": "msg_1",
+			"role": "assistant",
+			"content": [
+				{"type": "thinking", "thinking": "need ", "signature": "abc"},
+				{"type": "redacted_thinking", "data": "opaque"},
+				{"type": "thinking", "thinking": "file", "signature": "def"},
+				{"type": "text", "text": "Reading."},
+				{"type": "tool_use", "id": "tu_1", "name": "read", "input": {"files": [{"file_path": "a.go"}]}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 5}
+		}`)
+	}))
+	defer server.Close()
+
+	client := NewClient("key", "claude-test", server.URL)
+	resp, err := client.Chat(context.Background(), &llm.ChatRequest{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "read a.go"}},
+		Tools: []*llm.ToolDefinition{
+			{Type: "function", Function: &llm.FunctionDef{Name: "read", Parameters: map[string]any{"type": "object"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if resp.StopReason != llm.StopReasonToolCalls {
+		t.Errorf("Expected tool_calls stop reason, got %s", resp.StopReason)
+	}
+	wantThinking := []llm.ThinkingBlock{{Thinking: "need ", Signature: "abc"}, {Redacted: "opaque"}, {Thinking: "file", Signature: "def"}}
+	if resp.Message.Reason != "need file" || !reflect.DeepEqual(resp.Message.Thinking, wantThinking) {
+		t.Errorf("Expected thinking to be mapped, got %q / %+v", resp.Message.Reason, resp.Message.Thinking)
+	}
+	if len(resp.Message.ToolCalls) != 1 || resp.Message.ToolCalls[0].Function.Arguments != `{"files": [{"file_path": "a.go"}]}` {
+		t.Errorf("Unexpected tool calls: %+v", resp.Message.ToolCalls)
+	}
+	if resp.Usage.TotalTokens != 15 {
+		t.Errorf("Expected 15 total tokens, got %d", resp.Usage.TotalTokens)
+	}
+}
+
+func TestChat_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	}))
+	defer server.Close()
+
+	client := NewClient("key", "claude-test", server.URL)
+	_, err := client.Chat(context.Background(), &llm.ChatRequest{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}},
+	})
+
+	apiErr, ok := err.(*llm.APIError)
+	if !ok {
+		t.Fatalf("Expected *llm.APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Type != "rate_limit_error" || apiErr.RetryAfter != 3*time.Second {
+		t.Errorf("Unexpected error fields: %+v", apiErr)
+	}
+}
+
+func TestChatStream_AccumulatesBlocks(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[],"usage":{"input_tokens":12,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"opaque"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"thinking_delta","thinking":"!"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"signature_delta","signature":"sig2"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"content_block_start","index":3,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"text_delta","text":"lo"}}`,
+		`{"type":"content_block_stop","index":3}`,
+		`{"type":"content_block_start","index":4,"content_block":{"type":"tool_use","id":"tu_1","name":"bash","input":{}}}`,
+		`{"type":"content_block_delta","index":4,"delta":{"type":"input_json_delta","partial_json":"{\"command\":"}}`,
+		`{"type":"content_block_delta","index":4,"delta":{"type":"input_json_delta","partial_json":"\"ls\"}"}}`,
+		`{"type":"content_block_stop","index":4}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(e), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, e)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("key", "claude-test", server.URL)
+	reader, err := client.ChatStream(context.Background(), &llm.ChatRequest{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	defer reader.Close()
+
+	var content, reason string
+	var thinking []llm.ThinkingBlock
+	var toolCalls []*llm.ToolCall
+	for {
+		delta, err := reader.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if delta.Done {
+			thinking = delta.Thinking
+			break
+		}
+		content += delta.Content
+		reason += delta.Reason
+		if len(delta.ToolCalls) > 0 {
+			toolCalls = delta.ToolCalls
+		}
+	}
+
+	if content != "Hello" || reason != "hmm!" {
+		t.Errorf("Unexpected stream content: content=%q reason=%q", content, reason)
+	}
+	wantThinking := []llm.ThinkingBlock{{Thinking: "hmm", Signature: "sig"}, {Redacted: "opaque"}, {Thinking: "!", Signature: "sig2"}}
+	if !reflect.DeepEqual(thinking, wantThinking) {
+		t.Errorf("Expected each thinking block with its signature on the final delta, got %+v", thinking)
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Function.Arguments != `{"command":"ls"}` {
+		t.Errorf("Unexpected tool calls: %+v", toolCalls)
+	}
+
+	sr := reader.(*StreamReader)
+	if sr.StopReason() != llm.StopReasonToolCalls {
+		t.Errorf("Expected tool_calls stop reason, got %s", sr.StopReason())
+	}
+	if sr.Usage().TotalTokens != 19 {
+		t.Errorf("Expected 19 total tokens, got %d", sr.Usage().TotalTokens)
+	}
+}
@@ -0,0 +1,289 @@
+package anthropic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"finta/internal/llm"
+)
+
+type StreamReader struct {
+	body           io.ReadCloser
+	scanner        *bufio.Scanner
+	accumulatedMsg llm.Message
+	blockTypes     map[int]string        // Content block type by index
+	toolCallsMap   map[int]*llm.ToolCall // Track tool calls by block index
+	toolCalls      []*llm.ToolCall       // Tool calls in block order
+	thinkingMap    map[int]int           // Position in accumulatedMsg.Thinking by block index
+	usage          llm.Usage
+	stopReason     llm.StopReason
+	model          string // Reported by message_start, defaulting to the requested model
+	done           bool
+}
+
+func (c *Client) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	body := c.buildRequest(req, true)
+
+	httpResp, err := c.send(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	return &StreamReader{
+		body:    httpResp.Body,
+		scanner: scanner,
+		accumulatedMsg: llm.Message{
+			Role: llm.RoleAssistant,
+		},
+		blockTypes:   make(map[int]string),
+		toolCallsMap: make(map[int]*llm.ToolCall),
+		thinkingMap:  make(map[int]int),
+		model:        c.model,
+	}, nil
+}
+
+// streamEvent is the union of all server-sent event payloads
+type streamEvent struct {
+	Type         string            `json:"type"`
+	Index        int               `json:"index"`
+	Message      *messagesResponse `json:"message,omitempty"`
+	ContentBlock *contentBlock     `json:"content_block,omitempty"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	Usage *usage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (s *StreamReader) Recv() (*llm.Delta, error) {
+	for {
+		if s.done {
+			return s.doneDelta(), nil
+		}
+
+		data, err := s.nextEvent()
+		if err == io.EOF {
+			s.finalize()
+			return s.doneDelta(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode stream event: %w", err)
+		}
+
+		delta, err := s.handleEvent(&event)
+		if err != nil {
+			return nil, err
+		}
+		if delta != nil {
+			return delta, nil
+		}
+	}
+}
+
+// nextEvent returns the data payload of the next server-sent event
+func (s *StreamReader) nextEvent() (string, error) {
+	var data []string
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+
+		if line == "" {
+			if len(data) > 0 {
+				return strings.Join(data, "\n"), nil
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+		// "event:" lines duplicate the type field in the payload and are ignored
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(data) > 0 {
+		return strings.Join(data, "\n"), nil
+	}
+	return "", io.EOF
+}
+
+// handleEvent applies a stream event to the accumulated state and returns
+// the delta to surface, or nil if the event produced nothing visible
+func (s *StreamReader) handleEvent(event *streamEvent) (*llm.Delta, error) {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.usage.PromptTokens = event.Message.Usage.InputTokens
+			if event.Message.Model != "" {
+				s.model = event.Message.Model
+			}
+		}
+		return &llm.Delta{Role: llm.RoleAssistant}, nil
+
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return nil, nil
+		}
+		s.blockTypes[event.Index] = event.ContentBlock.Type
+		switch event.ContentBlock.Type {
+		case "thinking":
+			s.thinkingMap[event.Index] = len(s.accumulatedMsg.Thinking)
+			s.accumulatedMsg.Thinking = append(s.accumulatedMsg.Thinking, llm.ThinkingBlock{})
+		case "redacted_thinking":
+			s.accumulatedMsg.Thinking = append(s.accumulatedMsg.Thinking, llm.ThinkingBlock{Redacted: event.ContentBlock.Data})
+		}
+		if event.ContentBlock.Type == "tool_use" {
+			toolCall := &llm.ToolCall{
+				ID:   event.ContentBlock.ID,
+				Type: "function",
+				Function: &llm.FunctionCall{
+					Name:      event.ContentBlock.Name,
+					Arguments: "",
+				},
+			}
+			s.toolCallsMap[event.Index] = toolCall
+			s.toolCalls = append(s.toolCalls, toolCall)
+			return &llm.Delta{ToolCalls: s.toolCalls}, nil
+		}
+		return nil, nil
+
+	case "content_block_delta":
+		if event.Delta == nil {
+			return nil, nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			s.accumulatedMsg.Content += event.Delta.Text
+			return &llm.Delta{Content: event.Delta.Text}, nil
+
+		case "thinking_delta":
+			s.accumulatedMsg.Reason += event.Delta.Thinking
+			if i, ok := s.thinkingMap[event.Index]; ok {
+				s.accumulatedMsg.Thinking[i].Thinking += event.Delta.Thinking
+			}
+			return &llm.Delta{Reason: event.Delta.Thinking}, nil
+
+		case "signature_delta":
+			if i, ok := s.thinkingMap[event.Index]; ok {
+				s.accumulatedMsg.Thinking[i].Signature += event.Delta.Signature
+			}
+			return nil, nil
+
+		case "input_json_delta":
+			if toolCall, ok := s.toolCallsMap[event.Index]; ok {
+				toolCall.Function.Arguments += event.Delta.PartialJSON
+				return &llm.Delta{ToolCalls: s.toolCalls}, nil
+			}
+		}
+		return nil, nil
+
+	case "content_block_stop":
+		// Tool calls without arguments still need a valid JSON object
+		if toolCall, ok := s.toolCallsMap[event.Index]; ok && toolCall.Function.Arguments == "" {
+			toolCall.Function.Arguments = "{}"
+		}
+		return nil, nil
+
+	case "message_delta":
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			s.stopReason = convertStopReason(event.Delta.StopReason)
+		}
+		if event.Usage != nil {
+			s.usage.CompletionTokens = event.Usage.OutputTokens
+			s.usage.TotalTokens = s.usage.PromptTokens + s.usage.CompletionTokens
+		}
+		return nil, nil
+
+	case "message_stop":
+		s.finalize()
+		return s.doneDelta(), nil
+
+	case "error":
+		if event.Error != nil {
+			// Errors after the response started (e.g. overloaded_error) have no
+			// HTTP status of their own; report them like the equivalent status
+			return nil, &llm.APIError{
+				Provider:   "anthropic",
+				StatusCode: streamErrorStatus(event.Error.Type),
+				Type:       event.Error.Type,
+				Message:    event.Error.Message,
+			}
+		}
+		return nil, fmt.Errorf("anthropic stream error")
+
+	default:
+		// ping and unknown events
+		return nil, nil
+	}
+}
+
+// streamErrorStatus maps an in-stream error type to its HTTP status code
+func streamErrorStatus(errType string) int {
+	switch errType {
+	case "overloaded_error":
+		return 529
+	case "rate_limit_error":
+		return 429
+	case "api_error":
+		return 500
+	default:
+		return 400
+	}
+}
+
+// finalize marks the stream complete and records accumulated tool calls
+func (s *StreamReader) finalize() {
+	s.done = true
+	if len(s.toolCalls) > 0 {
+		s.accumulatedMsg.ToolCalls = s.toolCalls
+	}
+}
+
+func (s *StreamReader) Close() error {
+	return s.body.Close()
+}
+
+// GetAccumulatedMessage returns the fully accumulated message
+// This should be called after the stream is complete
+func (s *StreamReader) GetAccumulatedMessage() llm.Message {
+	return s.accumulatedMsg
+}
+
+// doneDelta returns the final delta, carrying the usage reported by the
+// stream and the thinking blocks needed to replay the message
+func (s *StreamReader) doneDelta() *llm.Delta {
+	usage := s.usage
+	return &llm.Delta{Done: true, StopReason: s.stopReason, Usage: &usage, Model: s.model, Thinking: s.accumulatedMsg.Thinking}
+}
+
+// Usage returns the token usage reported by the stream
+func (s *StreamReader) Usage() llm.Usage {
+	return s.usage
+}
+
+// StopReason returns the stop reason reported by the stream
+func (s *StreamReader) StopReason() llm.StopReason {
+	return s.stopReason
+}
@@ -0,0 +1,400 @@
+package cassette
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"finta/internal/llm"
+)
+
+// Mode selects whether a cassette client records or replays
+type Mode string
+
+const (
+	// ModeRecord calls the wrapped client and records every interaction
+	ModeRecord Mode = "record"
+	// ModeReplay serves recorded interactions without any network access
+	ModeReplay Mode = "replay"
+)
+
+// formatVersion is bumped when the cassette file layout changes
+const formatVersion = 1
+
+// ErrNoInteraction is returned in replay mode when no recorded
+// interaction matches a request
+var ErrNoInteraction = errors.New("cassette: no recorded interaction matches request")
+
+// Interaction is one recorded request and its outcome
+type Interaction struct {
+	Key      string            `json:"key"`
+	Request  RecordedRequest   `json:"request"`
+	Response *llm.ChatResponse `json:"response,omitempty"` // Set for Chat calls
+	Stream   []*llm.Delta      `json:"stream,omitempty"`   // Set for ChatStream calls, ending with the Done delta
+	Error    string            `json:"error,omitempty"`
+}
+
+// RecordedRequest is the part of a request used for matching
+type RecordedRequest struct {
+	Messages   []RecordedMessage `json:"messages"`
+	Tools      []RecordedTool    `json:"tools,omitempty"`
+	ToolChoice string            `json:"tool_choice,omitempty"`
+	Format     string            `json:"response_format,omitempty"` // Schema name and JSON
+}
+
+// RecordedMessage is a message reduced to the fields that identify it.
+// Timestamps and tool call IDs are left out so that replays match
+// regardless of when and by whom the conversation was produced.
+type RecordedMessage struct {
+	Role      llm.Role `json:"role"`
+	Content   string   `json:"content,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	ToolCalls []string `json:"tool_calls,omitempty"` // "name(arguments)"
+	Images    int      `json:"images,omitempty"`
+}
+
+// RecordedTool identifies a tool definition by name and schema
+type RecordedTool struct {
+	Name       string `json:"name"`
+	Parameters string `json:"parameters,omitempty"`
+}
+
+// file is the on-disk cassette layout
+type file struct {
+	Version      int            `json:"version"`
+	Provider     string         `json:"provider"`
+	Model        string         `json:"model"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Client is an llm.Client that records interactions of a wrapped client to
+// a JSON cassette file, or replays them offline. Requests are matched on
+// message content and tool definitions; identical requests are replayed in
+// the order they were recorded.
+type Client struct {
+	path  string
+	mode  Mode
+	inner llm.Client
+
+	mu       sync.Mutex
+	cassette file
+	used     map[string]int // Replay position per request key
+}
+
+// NewRecorder creates a client that calls inner and records to path,
+// replacing any existing cassette
+func NewRecorder(path string, inner llm.Client) *Client {
+	return &Client{
+		path:  path,
+		mode:  ModeRecord,
+		inner: inner,
+		cassette: file{
+			Version:  formatVersion,
+			Provider: inner.Provider(),
+			Model:    inner.Model(),
+		},
+	}
+}
+
+// NewReplayer creates a client that replays the cassette at path
+func NewReplayer(path string) (*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if f.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported cassette version %d in %s", f.Version, path)
+	}
+
+	return &Client{
+		path:     path,
+		mode:     ModeReplay,
+		cassette: f,
+		used:     make(map[string]int),
+	}, nil
+}
+
+// New creates a client for the given mode; inner is only used when recording
+func New(path string, mode Mode, inner llm.Client) (*Client, error) {
+	switch mode {
+	case ModeRecord:
+		if inner == nil {
+			return nil, fmt.Errorf("cassette: recording requires a client")
+		}
+		return NewRecorder(path, inner), nil
+	case ModeReplay:
+		return NewReplayer(path)
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q (use record or replay)", mode)
+	}
+}
+
+func (c *Client) Provider() string {
+	return c.cassette.Provider
+}
+
+func (c *Client) Model() string {
+	return c.cassette.Model
+}
+
+// Interactions returns the recorded interactions
+func (c *Client) Interactions() []*Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Interaction(nil), c.cassette.Interactions...)
+}
+
+func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	recorded := recordRequest(req)
+	key := requestKey(recorded)
+
+	if c.mode == ModeReplay {
+		interaction, err := c.next(key, false)
+		if err != nil {
+			return nil, err
+		}
+		if interaction.Error != "" {
+			return nil, errors.New(interaction.Error)
+		}
+		resp := *interaction.Response
+		return &resp, nil
+	}
+
+	resp, err := c.inner.Chat(ctx, req)
+	interaction := &Interaction{Key: key, Request: recorded, Response: resp}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if saveErr := c.record(interaction); saveErr != nil {
+		return nil, saveErr
+	}
+	return resp, err
+}
+
+func (c *Client) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	recorded := recordRequest(req)
+	key := requestKey(recorded)
+
+	if c.mode == ModeReplay {
+		interaction, err := c.next(key, true)
+		if err != nil {
+			return nil, err
+		}
+		if interaction.Error != "" && len(interaction.Stream) == 0 {
+			return nil, errors.New(interaction.Error)
+		}
+		return &replayStream{deltas: interaction.Stream, err: interaction.Error}, nil
+	}
+
+	reader, err := c.inner.ChatStream(ctx, req)
+	if err != nil {
+		if saveErr := c.record(&Interaction{Key: key, Request: recorded, Error: err.Error()}); saveErr != nil {
+			return nil, saveErr
+		}
+		return nil, err
+	}
+
+	return &recordStream{
+		client:      c,
+		reader:      reader,
+		interaction: &Interaction{Key: key, Request: recorded, Stream: []*llm.Delta{}},
+	}, nil
+}
+
+// next returns the next unused interaction recorded for key
+func (c *Client) next(key string, stream bool) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	skip := c.used[key]
+	for _, interaction := range c.cassette.Interactions {
+		if interaction.Key != key {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		c.used[key]++
+		if stream && interaction.Response != nil {
+			return nil, fmt.Errorf("cassette: request was recorded with Chat but replayed with ChatStream")
+		}
+		if !stream && interaction.Stream != nil {
+			return nil, fmt.Errorf("cassette: request was recorded with ChatStream but replayed with Chat")
+		}
+		return interaction, nil
+	}
+
+	return nil, fmt.Errorf("%w (key %s, %d recorded)", ErrNoInteraction, key[:12], len(c.cassette.Interactions))
+}
+
+// record appends an interaction and rewrites the cassette file so that a
+// run that fails midway still leaves everything recorded so far
+func (c *Client) record(interaction *Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cassette.Interactions = append(c.cassette.Interactions, interaction)
+
+	data, err := json.MarshalIndent(c.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// recordRequest reduces a request to the fields used for matching
+func recordRequest(req *llm.ChatRequest) RecordedRequest {
+	recorded := RecordedRequest{
+		Messages: make([]RecordedMessage, len(req.Messages)),
+	}
+
+	for i, msg := range req.Messages {
+		rm := RecordedMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+			Name:    msg.Name,
+		}
+		for _, tc := range msg.ToolCalls {
+			if tc.Function != nil {
+				rm.ToolCalls = append(rm.ToolCalls, tc.Function.Name+"("+tc.Function.Arguments+")")
+			}
+		}
+		for _, part := range msg.Parts {
+			if part.Type == llm.ContentPartImage {
+				rm.Images++
+			}
+		}
+		recorded.Messages[i] = rm
+	}
+
+	if req.ToolChoice != nil {
+		recorded.ToolChoice = req.ToolChoice.String()
+	}
+	if req.ResponseFormat != nil {
+		schema, _ := json.Marshal(req.ResponseFormat.Schema)
+		recorded.Format = req.ResponseFormat.Name + " " + string(schema)
+	}
+
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		params, _ := json.Marshal(t.Function.Parameters)
+		recorded.Tools = append(recorded.Tools, RecordedTool{
+			Name:       t.Function.Name,
+			Parameters: string(params),
+		})
+	}
+
+	return recorded
+}
+
+// requestKey hashes a recorded request
+func requestKey(recorded RecordedRequest) string {
+	data, _ := json.Marshal(recorded)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordStream passes deltas through and records them once the stream ends
+type recordStream struct {
+	client      *Client
+	reader      llm.StreamReader
+	interaction *Interaction
+	saved       bool
+}
+
+func (s *recordStream) Recv() (*llm.Delta, error) {
+	delta, err := s.reader.Recv()
+	if err != nil {
+		s.interaction.Error = err.Error()
+		s.save()
+		return nil, err
+	}
+
+	recorded := *delta
+	if len(delta.ToolCalls) > 0 {
+		// Providers reuse accumulating tool call structs; copy the current state
+		recorded.ToolCalls = make([]*llm.ToolCall, len(delta.ToolCalls))
+		for i, tc := range delta.ToolCalls {
+			copied := *tc
+			if tc.Function != nil {
+				fn := *tc.Function
+				copied.Function = &fn
+			}
+			recorded.ToolCalls[i] = &copied
+		}
+	}
+	s.interaction.Stream = append(s.interaction.Stream, &recorded)
+
+	if delta.Done {
+		if saveErr := s.save(); saveErr != nil {
+			return nil, saveErr
+		}
+	}
+	return delta, nil
+}
+
+func (s *recordStream) save() error {
+	if s.saved {
+		return nil
+	}
+	s.saved = true
+	return s.client.record(s.interaction)
+}
+
+// Close also saves a stream closed before its Done delta, as far as it got,
+// so the interaction can still be replayed
+func (s *recordStream) Close() error {
+	saveErr := s.save()
+	if err := s.reader.Close(); err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// replayStream replays recorded deltas, then the recorded error if any
+type replayStream struct {
+	deltas []*llm.Delta
+	err    string
+	pos    int
+}
+
+func (s *replayStream) Recv() (*llm.Delta, error) {
+	if s.pos < len(s.deltas) {
+		delta := *s.deltas[s.pos]
+		s.pos++
+		return &delta, nil
+	}
+	if s.err != "" {
+		return nil, errors.New(s.err)
+	}
+	// Streams recorded without a Done delta still terminate
+	return &llm.Delta{Done: true}, nil
+}
+
+func (s *replayStream) Close() error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"finta/internal/llm"
+)
+
+// echoClient answers with the last message content and a call counter
+type echoClient struct {
+	calls int
+}
+
+func (c *echoClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	c.calls++
+	last := req.Messages[len(req.Messages)-1].Content
+	if last == "fail" {
+		return nil, errors.New("upstream failure")
+	}
+	return &llm.ChatResponse{
+		Message:    llm.Message{Role: llm.RoleAssistant, Content: "echo: " + last},
+		StopReason: llm.StopReasonStop,
+		Usage:      llm.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+	}, nil
+}
+
+func (c *echoClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	c.calls++
+	call := &llm.ToolCall{ID: "call_1", Function: &llm.FunctionCall{Name: "glob"}}
+	return &accumulatingStream{call: call, chunks: []string{`{"pattern":`, `"*.go"}`}}, nil
+}
+
+func (c *echoClient) Provider() string { return "echo" }
+func (c *echoClient) Model() string    { return "echo-1" }
+
+// accumulatingStream mutates the same tool call across deltas, like real providers
+type accumulatingStream struct {
+	call   *llm.ToolCall
+	chunks []string
+	pos    int
+}
+
+func (s *accumulatingStream) Recv() (*llm.Delta, error) {
+	if s.pos < len(s.chunks) {
+		s.call.Function.Arguments += s.chunks[s.pos]
+		s.pos++
+		return &llm.Delta{ToolCalls: []*llm.ToolCall{s.call}}, nil
+	}
+	return &llm.Delta{Done: true, Usage: &llm.Usage{TotalTokens: 9}}, nil
+}
+
+func (s *accumulatingStream) Close() error { return nil }
+
+func userRequest(content string) *llm.ChatRequest {
+	return &llm.ChatRequest{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: content}},
+		Tools: []*llm.ToolDefinition{
+			{Type: "function", Function: &llm.FunctionDef{Name: "glob", Parameters: map[string]any{"type": "object"}}},
+		},
+	}
+}
+
+func TestRecordAndReplayChat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.json")
+	inner := &echoClient{}
+	recorder := NewRecorder(path, inner)
+
+	ctx := context.Background()
+	for _, content := range []string{"one", "two", "one"} {
+		if _, err := recorder.Chat(ctx, userRequest(content)); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if _, err := recorder.Chat(ctx, userRequest("fail")); err == nil {
+		t.Fatal("Expected upstream error to pass through while recording")
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatalf("NewReplayer failed: %v", err)
+	}
+	if replayer.Model() != "echo-1" || replayer.Provider() != "echo" {
+		t.Errorf("Expected recorded model and provider, got %s/%s", replayer.Provider(), replayer.Model())
+	}
+
+	resp, err := replayer.Chat(ctx, userRequest("two"))
+	if err != nil || resp.Message.Content != "echo: two" || resp.Usage.TotalTokens != 5 {
+		t.Fatalf("Unexpected replay: %+v, %v", resp, err)
+	}
+
+	// Identical requests replay in recorded order, then run out
+	for i := 0; i < 2; i++ {
+		if _, err := replayer.Chat(ctx, userRequest("one")); err != nil {
+			t.Fatalf("Replay %d of repeated request failed: %v", i+1, err)
+		}
+	}
+	if _, err := replayer.Chat(ctx, userRequest("one")); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction once recordings are used up, got %v", err)
+	}
+
+	if _, err := replayer.Chat(ctx, userRequest("fail")); err == nil || err.Error() != "upstream failure" {
+		t.Errorf("Expected recorded error to replay, got %v", err)
+	}
+
+	if inner.calls != 4 {
+		t.Errorf("Expected replay to make no calls to the inner client, got %d calls", inner.calls)
+	}
+}
+
+func TestReplay_MatchesToolDefinitions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.json")
+	recorder := NewRecorder(path, &echoClient{})
+	if _, err := recorder.Chat(context.Background(), userRequest("hi")); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatalf("NewReplayer failed: %v", err)
+	}
+
+	req := userRequest("hi")
+	req.Tools[0].Function.Parameters = map[string]any{"type": "object", "required": []string{"pattern"}}
+	if _, err := replayer.Chat(context.Background(), req); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Expected changed tool schema not to match, got %v", err)
+	}
+}
+
+func TestRecordAndReplayStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.json")
+	recorder := NewRecorder(path, &echoClient{})
+
+	reader, err := recorder.ChatStream(context.Background(), userRequest("list"))
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	drain(t, reader)
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatalf("NewReplayer failed: %v", err)
+	}
+	if _, err := replayer.Chat(context.Background(), userRequest("list")); err == nil {
+		t.Error("Expected Chat replay of a streamed recording to fail")
+	}
+
+	replayer, _ = NewReplayer(path)
+	reader, err = replayer.ChatStream(context.Background(), userRequest("list"))
+	if err != nil {
+		t.Fatalf("Replay ChatStream failed: %v", err)
+	}
+	deltas := drain(t, reader)
+
+	if len(deltas) != 3 {
+		t.Fatalf("Expected 3 deltas, got %d", len(deltas))
+	}
+	if args := deltas[0].ToolCalls[0].Function.Arguments; args != `{"pattern":` {
+		t.Errorf("Expected first delta to hold partial arguments, got %q", args)
+	}
+	if args := deltas[1].ToolCalls[0].Function.Arguments; args != `{"pattern":"*.go"}` {
+		t.Errorf("Expected accumulated arguments, got %q", args)
+	}
+	if !deltas[2].Done || deltas[2].Usage == nil || deltas[2].Usage.TotalTokens != 9 {
+		t.Errorf("Expected final delta with usage, got %+v", deltas[2])
+	}
+}
+
+func TestRecordStream_SavesOnEarlyClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.json")
+	recorder := NewRecorder(path, &echoClient{})
+
+	reader, err := recorder.ChatStream(context.Background(), userRequest("list"))
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if _, err := reader.Recv(); err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatalf("NewReplayer failed: %v", err)
+	}
+	reader, err = replayer.ChatStream(context.Background(), userRequest("list"))
+	if err != nil {
+		t.Fatalf("Expected the interrupted stream recorded, got %v", err)
+	}
+	if deltas := drain(t, reader); len(deltas) != 2 || !deltas[1].Done {
+		t.Errorf("Expected the recorded delta followed by Done, got %d deltas", len(deltas))
+	}
+}
+
+func drain(t *testing.T, reader llm.StreamReader) []*llm.Delta {
+	t.Helper()
+	defer reader.Close()
+
+	var deltas []*llm.Delta
+	for {
+		delta, err := reader.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		deltas = append(deltas, delta)
+		if delta.Done {
+			return deltas
+		}
+	}
+}
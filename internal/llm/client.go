@@ -1,6 +1,10 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
 
 type Client interface {
 	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
@@ -14,12 +18,72 @@ type ChatRequest struct {
 	Tools       []*ToolDefinition
 	Temperature float32
 	MaxTokens   int
+
+	// Optional sampling and tool controls; zero values use the provider default
+	ToolChoice        *ToolChoice
+	ParallelToolCalls *bool    // Whether the model may return several tool calls in one response
+	TopP              float32  // Nucleus sampling probability mass
+	Stop              []string // Sequences that end generation
+	Seed              *int     // Best-effort deterministic sampling (OpenAI only)
+
+	// ResponseFormat asks for a final answer in JSON conforming to a schema
+	ResponseFormat *ResponseFormat
+}
+
+// ResponseFormat describes a JSON answer the model must produce
+type ResponseFormat struct {
+	Name   string         // Short identifier of the schema, e.g. "plan"
+	Schema map[string]any // JSON Schema of the answer
+	Strict bool           // Ask the provider to enforce the schema exactly, where supported
+}
+
+// Instruction renders the format as a prompt instruction, for providers
+// without native schema support
+func (f *ResponseFormat) Instruction() string {
+	schema, _ := json.MarshalIndent(f.Schema, "", "  ")
+	return fmt.Sprintf("When you give your final answer, respond with only a JSON value conforming to the following JSON schema, without code fences or any other text:\n%s", schema)
+}
+
+// ToolChoiceMode controls whether the model calls tools
+type ToolChoiceMode string
+
+const (
+	ToolChoiceAuto     ToolChoiceMode = "auto"     // The model decides
+	ToolChoiceNone     ToolChoiceMode = "none"     // The model must answer without tools
+	ToolChoiceRequired ToolChoiceMode = "required" // The model must call at least one tool
+	ToolChoiceFunction ToolChoiceMode = "function" // The model must call the named tool
+)
+
+// ToolChoice selects how the model uses the tools of a request
+type ToolChoice struct {
+	Mode ToolChoiceMode
+	Name string // Tool name for ToolChoiceFunction
+}
+
+// ParseToolChoice parses "auto", "none", "required" or a tool name
+func ParseToolChoice(s string) (*ToolChoice, error) {
+	switch ToolChoiceMode(s) {
+	case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		return &ToolChoice{Mode: ToolChoiceMode(s)}, nil
+	case "", ToolChoiceFunction:
+		return nil, fmt.Errorf("tool choice must be auto, none, required or a tool name")
+	default:
+		return &ToolChoice{Mode: ToolChoiceFunction, Name: s}, nil
+	}
+}
+
+func (c *ToolChoice) String() string {
+	if c.Mode == ToolChoiceFunction {
+		return c.Name
+	}
+	return string(c.Mode)
 }
 
 type ChatResponse struct {
 	Message    Message
 	StopReason StopReason
 	Usage      Usage
+	Model      string // Model that served the call, as reported by the provider
 }
 
 type ToolDefinition struct {
@@ -39,9 +103,13 @@ type StreamReader interface {
 }
 
 type Delta struct {
-	Role      Role
-	Reason    string
-	Content   string
-	ToolCalls []*ToolCall
-	Done      bool
+	Role       Role
+	Reason     string
+	Content    string
+	ToolCalls  []*ToolCall
+	Done       bool
+	StopReason StopReason      // Why generation ended, set on the final delta
+	Usage      *Usage          // Token usage, set on the final delta when the provider reports it
+	Model      string          // Model that served the call, set on the final delta
+	Thinking   []ThinkingBlock // Complete reasoning blocks, set on the final delta when the provider keeps them
 }
@@ -0,0 +1,285 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"finta/internal/config"
+	"finta/internal/llm"
+)
+
+// SummaryPrefix marks the user message that replaces summarised history
+const SummaryPrefix = "[Summary of earlier conversation]"
+
+const summaryPrompt = `You are compacting the history of a conversation between a user and an AI coding agent so the agent can continue the work with less context.
+
+Write a concise summary that preserves:
+- The user's goals, requests and constraints, in their own words where it matters
+- Decisions made and their reasons
+- Files, functions, commands and other identifiers that were inspected or changed
+- Results of tool calls that are still relevant (findings, errors, test outcomes)
+- Work that is still pending
+
+Omit pleasantries, repeated attempts and tool output that is no longer relevant. Use short bullet points.`
+
+// Config controls when and how history is compacted
+type Config struct {
+	Disabled       bool           // Never compact automatically
+	Threshold      float64        // Fraction of the context window that triggers compaction
+	KeepRecent     int            // Most recent messages kept verbatim
+	MaxToolOutput  int            // Tool outputs longer than this (in characters) are elided
+	ContextWindow  int            // Overrides the model's context window for every model
+	ContextWindows map[string]int // Per-model context window overrides
+}
+
+// DefaultConfig returns the compaction settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Threshold:     0.75,
+		KeepRecent:    10,
+		MaxToolOutput: 4000,
+	}
+}
+
+// ConfigFrom merges YAML compaction settings onto the defaults
+func ConfigFrom(c config.CompactionConfig) Config {
+	cfg := DefaultConfig()
+	cfg.Disabled = c.Disabled
+	if c.Threshold > 0 {
+		cfg.Threshold = c.Threshold
+	}
+	if c.KeepRecent > 0 {
+		cfg.KeepRecent = c.KeepRecent
+	}
+	if c.MaxToolOutput > 0 {
+		cfg.MaxToolOutput = c.MaxToolOutput
+	}
+	cfg.ContextWindow = c.ContextWindow
+	cfg.ContextWindows = c.ContextWindows
+	return cfg
+}
+
+// Result describes what a compaction did
+type Result struct {
+	TokensBefore int
+	TokensAfter  int
+	Elided       int // Tool outputs shortened or stripped of images
+	Summarised   int // Messages replaced by the summary
+}
+
+// Compactor keeps a message history within a model's context window.
+// It first elides large tool outputs outside the recent window, then
+// summarises older turns with the LLM. Splits only happen at messages that
+// are not tool results, so every tool result stays with its tool call.
+type Compactor struct {
+	client llm.Client
+	config Config
+}
+
+// New creates a compactor that summarises with the given client.
+// The client's model also determines the context window.
+func New(client llm.Client, cfg Config) *Compactor {
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		cfg.Threshold = DefaultConfig().Threshold
+	}
+	if cfg.KeepRecent <= 0 {
+		cfg.KeepRecent = DefaultConfig().KeepRecent
+	}
+	return &Compactor{client: client, config: cfg}
+}
+
+// ContextWindow returns the context window of the client's model
+func (c *Compactor) ContextWindow() int {
+	model := c.client.Model()
+	if w, ok := c.config.ContextWindows[model]; ok && w > 0 {
+		return w
+	}
+	if c.config.ContextWindow > 0 {
+		return c.config.ContextWindow
+	}
+	return llm.ContextWindow(model)
+}
+
+// Limit returns the token count above which history is compacted
+func (c *Compactor) Limit() int {
+	return int(float64(c.ContextWindow()) * c.config.Threshold)
+}
+
+// Estimate approximates the prompt tokens of messages
+func (c *Compactor) Estimate(messages []llm.Message) int {
+	return llm.EstimateTokens(c.client.Model(), messages)
+}
+
+// NeedsCompaction reports whether messages plus reserved tokens (tool
+// definitions, the response) exceed the limit
+func (c *Compactor) NeedsCompaction(messages []llm.Message, reserved int) bool {
+	if c.config.Disabled {
+		return false
+	}
+	return c.Estimate(messages)+reserved > c.Limit()
+}
+
+// Compact shortens messages so that, together with reserved tokens, they fit
+// under the limit. With force set, older turns are summarised regardless of
+// size. The input slice is not modified. On a summarisation error the
+// elided messages are returned along with the error.
+func (c *Compactor) Compact(ctx context.Context, messages []llm.Message, reserved int, force bool) ([]llm.Message, *Result, error) {
+	result := &Result{TokensBefore: c.Estimate(messages)}
+	limit := c.Limit() - reserved
+
+	split := c.splitPoint(messages)
+
+	// Stage 1: elide large tool outputs that are no longer recent
+	compacted, elided := elideToolOutputs(messages, split, c.config.MaxToolOutput)
+	result.Elided = elided
+	result.TokensAfter = c.Estimate(compacted)
+	if !force && result.TokensAfter <= limit {
+		return compacted, result, nil
+	}
+
+	// Stage 2: summarise everything between the system prompt and the split
+	start := 0
+	for start < len(compacted) && compacted[start].Role == llm.RoleSystem {
+		start++
+	}
+	if split > start {
+		summary, err := c.summarise(ctx, compacted[start:split])
+		if err != nil {
+			return compacted, result, fmt.Errorf("failed to summarise history: %w", err)
+		}
+
+		rebuilt := make([]llm.Message, 0, start+1+len(compacted)-split)
+		rebuilt = append(rebuilt, compacted[:start]...)
+		rebuilt = append(rebuilt, llm.Message{
+			Role:      llm.RoleUser,
+			Content:   SummaryPrefix + "\n\n" + summary,
+			Timestamp: time.Now(),
+		})
+		rebuilt = append(rebuilt, compacted[split:]...)
+
+		result.Summarised = split - start
+		compacted = rebuilt
+		result.TokensAfter = c.Estimate(compacted)
+	}
+
+	// Stage 3: the recent window alone is too large; elide its tool outputs too
+	if result.TokensAfter > limit {
+		var more int
+		compacted, more = elideToolOutputs(compacted, len(compacted), c.config.MaxToolOutput)
+		result.Elided += more
+		result.TokensAfter = c.Estimate(compacted)
+	}
+
+	return compacted, result, nil
+}
+
+// splitPoint returns the index of the first message kept verbatim. It keeps
+// at least KeepRecent messages and moves back so the split never lands on a
+// tool result, which would separate it from its assistant tool call.
+func (c *Compactor) splitPoint(messages []llm.Message) int {
+	split := len(messages) - c.config.KeepRecent
+	if split <= 0 {
+		return 0
+	}
+	for split > 0 && messages[split].Role == llm.RoleTool {
+		split--
+	}
+	// Never split off the system prompt
+	if messages[split].Role == llm.RoleSystem {
+		return 0
+	}
+	return split
+}
+
+// summarise asks the LLM for a summary of messages, rendered as a transcript
+// so the request carries no tool calls that would need matching results
+func (c *Compactor) summarise(ctx context.Context, messages []llm.Message) (string, error) {
+	resp, err := c.client.Chat(ctx, &llm.ChatRequest{
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: summaryPrompt},
+			{Role: llm.RoleUser, Content: "Summarise this conversation:\n\n" + transcript(messages, c.config.MaxToolOutput)},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(resp.Message.Content)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// transcript renders messages as plain text for summarisation
+func transcript(messages []llm.Message, maxToolOutput int) string {
+	var sb strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case llm.RoleTool:
+			fmt.Fprintf(&sb, "[tool result: %s]\n%s\n\n", msg.Name, elide(msg.Content, maxToolOutput))
+		case llm.RoleAssistant:
+			if msg.Content != "" {
+				fmt.Fprintf(&sb, "[assistant]\n%s\n\n", msg.Content)
+			}
+			for _, tc := range msg.ToolCalls {
+				if tc.Function != nil {
+					fmt.Fprintf(&sb, "[tool call: %s] %s\n\n", tc.Function.Name, tc.Function.Arguments)
+				}
+			}
+		default:
+			fmt.Fprintf(&sb, "[%s]\n%s\n\n", msg.Role, msg.Content)
+		}
+	}
+	return sb.String()
+}
+
+// elideToolOutputs returns a copy of messages with tool outputs before index
+// end shortened to max characters and stripped of images, and the number of
+// outputs changed
+func elideToolOutputs(messages []llm.Message, end, max int) ([]llm.Message, int) {
+	out := make([]llm.Message, len(messages))
+	copy(out, messages)
+
+	count := 0
+	for i := 0; i < end && i < len(out); i++ {
+		if out[i].Role != llm.RoleTool {
+			continue
+		}
+		elided := false
+		if out[i].HasImages() {
+			// Content already holds a text rendering naming the images
+			out[i].Parts = nil
+			elided = true
+		}
+		if max > 0 && len(out[i].Content) > max {
+			out[i].Content = elide(out[i].Content, max)
+			elided = true
+		}
+		if elided {
+			count++
+		}
+	}
+	return out, count
+}
+
+// elide keeps the head and tail of s within max characters, noting what was cut
+func elide(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	head := max * 2 / 3
+	tailStart := len(s) - (max - head)
+	// Don't cut through multi-byte characters
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	for tailStart < len(s) && !utf8.RuneStart(s[tailStart]) {
+		tailStart++
+	}
+	return fmt.Sprintf("%s\n[... %d characters elided ...]\n%s", s[:head], tailStart-head, s[tailStart:])
+}
@@ -0,0 +1,181 @@
+package compact
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"finta/internal/llm"
+)
+
+// summaryClient returns a fixed summary and records the last request
+type summaryClient struct {
+	summary string
+	err     error
+	last    *llm.ChatRequest
+}
+
+func (c *summaryClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	c.last = req
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &llm.ChatResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: c.summary}, StopReason: llm.StopReasonStop}, nil
+}
+
+func (c *summaryClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *summaryClient) Provider() string { return "test" }
+func (c *summaryClient) Model() string    { return "test-model" }
+
+// toolTurn returns an assistant tool call followed by its result
+func toolTurn(id, output string) []llm.Message {
+	return []llm.Message{
+		{Role: llm.RoleAssistant, ToolCalls: []*llm.ToolCall{{ID: id, Function: &llm.FunctionCall{Name: "read", Arguments: `{}`}}}},
+		{Role: llm.RoleTool, ToolCallID: id, Name: "read", Content: output},
+	}
+}
+
+func conversation() []llm.Message {
+	msgs := []llm.Message{
+		{Role: llm.RoleSystem, Content: "system prompt"},
+		{Role: llm.RoleUser, Content: "look at the repo"},
+	}
+	msgs = append(msgs, toolTurn("a", strings.Repeat("x", 10000))...)
+	msgs = append(msgs, toolTurn("b", strings.Repeat("y", 10000))...)
+	msgs = append(msgs, llm.Message{Role: llm.RoleAssistant, Content: "done looking"})
+	msgs = append(msgs, llm.Message{Role: llm.RoleUser, Content: "now fix it"})
+	msgs = append(msgs, toolTurn("c", "small")...)
+	return msgs
+}
+
+// checkPairing verifies that every tool result directly follows the
+// assistant message that requested it
+func checkPairing(t *testing.T, msgs []llm.Message) {
+	t.Helper()
+	pending := map[string]bool{}
+	for i, msg := range msgs {
+		switch msg.Role {
+		case llm.RoleAssistant:
+			pending = map[string]bool{}
+			for _, tc := range msg.ToolCalls {
+				pending[tc.ID] = true
+			}
+		case llm.RoleTool:
+			if !pending[msg.ToolCallID] {
+				t.Fatalf("Tool result %d (%s) has no preceding tool call", i, msg.ToolCallID)
+			}
+		default:
+			pending = map[string]bool{}
+		}
+	}
+}
+
+func TestCompact_ElidesOldToolOutputsFirst(t *testing.T) {
+	client := &summaryClient{summary: "unused"}
+	c := New(client, Config{Threshold: 0.5, KeepRecent: 3, MaxToolOutput: 100, ContextWindow: 10000})
+
+	msgs := conversation()
+	out, result, err := c.Compact(context.Background(), msgs, 0, false)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	if client.last != nil {
+		t.Error("Expected elision alone to be enough, but the LLM was called")
+	}
+	if result.Elided != 2 || result.Summarised != 0 {
+		t.Errorf("Expected 2 elided outputs and no summary, got %+v", result)
+	}
+	if !strings.Contains(out[3].Content, "characters elided") {
+		t.Errorf("Expected old tool output to be elided, got %d chars", len(out[3].Content))
+	}
+	if len(msgs[3].Content) != 10000 {
+		t.Error("Expected input messages to be left untouched")
+	}
+	checkPairing(t, out)
+}
+
+func TestCompact_SummarisesAndKeepsPairing(t *testing.T) {
+	client := &summaryClient{summary: "- user wants the repo fixed"}
+	// KeepRecent 2 would split between tool call "c" and its result;
+	// the split must move back to the assistant message
+	c := New(client, Config{Threshold: 0.5, KeepRecent: 1, ContextWindow: 1000})
+
+	out, result, err := c.Compact(context.Background(), conversation(), 0, true)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	if len(out) != 4 {
+		t.Fatalf("Expected system, summary, tool call and result, got %d messages", len(out))
+	}
+	if out[0].Role != llm.RoleSystem {
+		t.Error("Expected system prompt to be kept")
+	}
+	if out[1].Role != llm.RoleUser || !strings.HasPrefix(out[1].Content, SummaryPrefix) {
+		t.Errorf("Expected summary message, got %+v", out[1])
+	}
+	if result.Summarised != 7 {
+		t.Errorf("Expected 7 summarised messages, got %d", result.Summarised)
+	}
+	checkPairing(t, out)
+
+	// The summarisation request must not carry tool calls
+	for _, msg := range client.last.Messages {
+		if len(msg.ToolCalls) > 0 || msg.Role == llm.RoleTool {
+			t.Fatal("Expected summarisation request to be plain text")
+		}
+	}
+	if len(client.last.Tools) != 0 {
+		t.Error("Expected no tools in summarisation request")
+	}
+}
+
+func TestCompact_SummaryErrorReturnsElidedMessages(t *testing.T) {
+	client := &summaryClient{err: errors.New("boom")}
+	c := New(client, Config{Threshold: 0.5, KeepRecent: 2, MaxToolOutput: 100, ContextWindow: 10})
+
+	msgs := conversation()
+	out, _, err := c.Compact(context.Background(), msgs, 0, false)
+	if err == nil {
+		t.Fatal("Expected summarisation error")
+	}
+	if len(out) != len(msgs) {
+		t.Errorf("Expected elided messages to be returned, got %d messages", len(out))
+	}
+}
+
+func TestNeedsCompaction(t *testing.T) {
+	c := New(&summaryClient{}, Config{Threshold: 0.5, ContextWindow: 1000})
+	small := []llm.Message{{Role: llm.RoleUser, Content: "hi"}}
+
+	if c.NeedsCompaction(small, 0) {
+		t.Error("Expected small history to fit")
+	}
+	if !c.NeedsCompaction(small, 600) {
+		t.Error("Expected reserved tokens to count towards the limit")
+	}
+
+	disabled := New(&summaryClient{}, Config{Disabled: true, ContextWindow: 10})
+	if disabled.NeedsCompaction(conversation(), 0) {
+		t.Error("Expected disabled compactor never to compact automatically")
+	}
+}
+
+func TestContextWindowOverrides(t *testing.T) {
+	c := New(&summaryClient{}, Config{ContextWindows: map[string]int{"test-model": 4096}})
+	if w := c.ContextWindow(); w != 4096 {
+		t.Errorf("Expected per-model override, got %d", w)
+	}
+
+	if w := llm.ContextWindow("openai/gpt-4o-mini"); w != 128000 {
+		t.Errorf("Expected gpt-4o window, got %d", w)
+	}
+	if w := llm.ContextWindow("claude-sonnet-4-5"); w != 200000 {
+		t.Errorf("Expected claude window, got %d", w)
+	}
+}
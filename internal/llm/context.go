@@ -0,0 +1,21 @@
+package llm
+
+import "context"
+
+type contextKey string
+
+const agentNameKey contextKey = "agent_name"
+
+// WithAgentName records the name of the agent issuing LLM calls,
+// so client middleware (e.g. routers) can make per-agent decisions
+func WithAgentName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, agentNameKey, name)
+}
+
+// AgentNameFromContext returns the agent name stored in context, or "" if none
+func AgentNameFromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(agentNameKey).(string); ok {
+		return name
+	}
+	return ""
+}
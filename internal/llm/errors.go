@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is a provider-neutral error returned when an LLM API responds
+// with a non-2xx status. Provider clients wrap their native errors in it so
+// middleware (e.g. retries) can inspect the status without knowing the provider.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Type       string        // Provider error type, e.g. "rate_limit_error"
+	Message    string        // Human readable message from the API
+	RetryAfter time.Duration // Parsed Retry-After header, 0 if absent
+	Err        error         // Underlying provider error, if any
+}
+
+func (e *APIError) Error() string {
+	status := fmt.Sprintf("status %d", e.StatusCode)
+	if e.Type != "" {
+		status += ", " + e.Type
+	}
+	return fmt.Sprintf("%s API error (%s): %s", e.Provider, status, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRetryAfter parses a Retry-After header value, which is either a number
+// of seconds or an HTTP date. It returns 0 if the header is empty or invalid.
+func ParseRetryAfter(header http.Header, now time.Time) time.Duration {
+	// Some providers send a millisecond variant, which is more precise
+	if ms := strings.TrimSpace(header.Get("retry-after-ms")); ms != "" {
+		if v, err := strconv.ParseFloat(ms, 64); err == nil && v > 0 {
+			return time.Duration(v * float64(time.Millisecond))
+		}
+	}
+
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -1,6 +1,9 @@
 package llm
 
-import "time"
+import (
+	"encoding/base64"
+	"time"
+)
 
 type Role string
 
@@ -14,13 +17,67 @@ const (
 type Message struct {
 	Role       Role
 	Reason     string
+	Thinking   []ThinkingBlock // Reasoning blocks as returned, for providers that need them replayed verbatim (Anthropic)
 	Content    string
+	Parts      []ContentPart // Multimodal content; when set, providers send Parts instead of Content
 	ToolCalls  []*ToolCall
 	ToolCallID string
 	Name       string
 	Timestamp  time.Time
 }
 
+// ThinkingBlock is one block of reasoning. Anthropic verifies each thinking
+// block by its signature and expects redacted blocks back unchanged, so
+// they are kept one by one rather than only as the joined Reason text.
+type ThinkingBlock struct {
+	Thinking  string
+	Signature string // Opaque signature of the block
+	Redacted  string // Encrypted data of a redacted block, which has no text
+}
+
+// ContentPartType identifies the kind of a content part
+type ContentPartType string
+
+const (
+	ContentPartText  ContentPartType = "text"
+	ContentPartImage ContentPartType = "image"
+)
+
+// ContentPart is one piece of multimodal message content.
+// Messages with parts keep a text rendering in Content for logging,
+// token estimation and providers that can't accept images.
+type ContentPart struct {
+	Type     ContentPartType
+	Text     string // Text parts
+	MIMEType string // Image parts, e.g. "image/png"
+	Data     []byte // Image parts, raw (not base64) bytes
+}
+
+// TextPart creates a text content part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartText, Text: text}
+}
+
+// ImagePart creates an image content part from raw image bytes
+func ImagePart(mimeType string, data []byte) ContentPart {
+	return ContentPart{Type: ContentPartImage, MIMEType: mimeType, Data: data}
+}
+
+// DataURL returns the image as a base64 data URL
+func (p ContentPart) DataURL() string {
+	return "data:" + p.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(p.Data)
+}
+
+// HasImages reports whether the message carries image parts
+func (m *Message) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == ContentPartImage {
+			return true
+		}
+	}
+	return false
+}
+
 type ToolCall struct {
 	ID       string
 	Type     string
@@ -45,3 +102,10 @@ type Usage struct {
 	CompletionTokens int
 	TotalTokens      int
 }
+
+// Add accumulates another usage into u
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
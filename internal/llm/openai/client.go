@@ -2,6 +2,10 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
 	"finta/internal/llm"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -16,45 +20,92 @@ type Client struct {
 // If baseURL is empty, it uses the default OpenAI API endpoint.
 // If baseURL is provided, it uses the custom endpoint (useful for OpenAI-compatible APIs).
 func NewClient(apiKey, model string, baseURL ...string) *Client {
-	var client *openai.Client
-
+	config := openai.DefaultConfig(apiKey)
 	if len(baseURL) > 0 && baseURL[0] != "" {
 		// Use custom base URL
-		config := openai.DefaultConfig(apiKey)
 		config.BaseURL = baseURL[0]
-		client = openai.NewClientWithConfig(config)
-	} else {
-		// Use default OpenAI endpoint
-		client = openai.NewClient(apiKey)
+	}
+
+	// Capture error response headers so Retry-After can be surfaced
+	config.HTTPClient = &http.Client{
+		Transport: &captureTransport{base: http.DefaultTransport},
 	}
 
 	return &Client{
-		client: client,
+		client: openai.NewClientWithConfig(config),
 		model:  model,
 	}
 }
 
 func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
-	// Convert message format
-	messages := c.convertMessages(req.Messages)
+	// Call OpenAI API
+	ctx, capture := withHeaderCapture(ctx)
+	resp, err := c.client.CreateChatCompletion(ctx, c.buildRequest(req))
+	if err != nil {
+		return nil, wrapError(err, capture)
+	}
 
-	// Convert tool definitions
-	tools := c.convertTools(req.Tools)
+	// Convert response
+	return c.convertResponse(resp), nil
+}
 
-	// Call OpenAI API
-	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+// buildRequest converts a ChatRequest into a chat completion request
+func (c *Client) buildRequest(req *llm.ChatRequest) openai.ChatCompletionRequest {
+	ocReq := openai.ChatCompletionRequest{
 		Model:       c.model,
-		Messages:    messages,
-		Tools:       tools,
+		Messages:    c.convertMessages(req.Messages),
+		Tools:       c.convertTools(req.Tools),
 		Temperature: req.Temperature,
 		MaxTokens:   req.MaxTokens,
-	})
-	if err != nil {
-		return nil, err
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+		Seed:        req.Seed,
 	}
 
-	// Convert response
-	return c.convertResponse(resp), nil
+	if req.ResponseFormat != nil {
+		ocReq.ResponseFormat = convertResponseFormat(req.ResponseFormat)
+	}
+
+	// The API rejects tool controls on requests without tools
+	if len(ocReq.Tools) > 0 {
+		if req.ToolChoice != nil {
+			ocReq.ToolChoice = convertToolChoice(req.ToolChoice)
+		}
+		if req.ParallelToolCalls != nil {
+			ocReq.ParallelToolCalls = *req.ParallelToolCalls
+		}
+	}
+
+	return ocReq
+}
+
+// convertResponseFormat maps a response format to a json_schema response format
+func convertResponseFormat(format *llm.ResponseFormat) *openai.ChatCompletionResponseFormat {
+	schema, _ := json.Marshal(format.Schema)
+	name := format.Name
+	if name == "" {
+		name = "response"
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: json.RawMessage(schema),
+			Strict: format.Strict,
+		},
+	}
+}
+
+// convertToolChoice maps a tool choice to the "auto"/"none"/"required"
+// string or, for a named tool, the function object form
+func convertToolChoice(choice *llm.ToolChoice) any {
+	if choice.Mode == llm.ToolChoiceFunction {
+		return openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: choice.Name},
+		}
+	}
+	return string(choice.Mode)
 }
 
 func (c *Client) Provider() string {
@@ -67,7 +118,12 @@ func (c *Client) Model() string {
 
 // Helper method: message format conversion
 func (c *Client) convertMessages(msgs []llm.Message) []openai.ChatCompletionMessage {
-	result := make([]openai.ChatCompletionMessage, len(msgs))
+	result := make([]openai.ChatCompletionMessage, 0, len(msgs))
+
+	// Tool messages can only carry text, so images returned by tools are
+	// sent in a user message following the run of tool results
+	var toolImages []openai.ChatMessagePart
+
 	for i, msg := range msgs {
 		ocMsg := openai.ChatCompletionMessage{
 			Role:             string(msg.Role),
@@ -75,6 +131,12 @@ func (c *Client) convertMessages(msgs []llm.Message) []openai.ChatCompletionMess
 			Content:          msg.Content,
 		}
 
+		// User and system messages with images use multi-part content
+		if msg.HasImages() && (msg.Role == llm.RoleUser || msg.Role == llm.RoleSystem) {
+			ocMsg.Content = ""
+			ocMsg.MultiContent = convertParts(msg.Parts)
+		}
+
 		// Convert tool calls
 		if len(msg.ToolCalls) > 0 {
 			ocMsg.ToolCalls = make([]openai.ToolCall, len(msg.ToolCalls))
@@ -93,8 +155,52 @@ func (c *Client) convertMessages(msgs []llm.Message) []openai.ChatCompletionMess
 		// Tool response message
 		if msg.Role == llm.RoleTool {
 			ocMsg.ToolCallID = msg.ToolCallID
+			if msg.HasImages() {
+				toolImages = append(toolImages, openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeText,
+					Text: fmt.Sprintf("Image output of tool call %s (%s):", msg.ToolCallID, msg.Name),
+				})
+				for _, part := range convertParts(msg.Parts) {
+					if part.Type == openai.ChatMessagePartTypeImageURL {
+						toolImages = append(toolImages, part)
+					}
+				}
+			}
+		}
+		result = append(result, ocMsg)
+
+		lastTool := i+1 == len(msgs) || msgs[i+1].Role != llm.RoleTool
+		if msg.Role == llm.RoleTool && lastTool && len(toolImages) > 0 {
+			result = append(result, openai.ChatCompletionMessage{
+				Role:         openai.ChatMessageRoleUser,
+				MultiContent: toolImages,
+			})
+			toolImages = nil
+		}
+	}
+	return result
+}
+
+// convertParts converts content parts to OpenAI message parts,
+// sending images inline as data URLs
+func convertParts(parts []llm.ContentPart) []openai.ChatMessagePart {
+	result := make([]openai.ChatMessagePart, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case llm.ContentPartImage:
+			result = append(result, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{
+					URL:    part.DataURL(),
+					Detail: openai.ImageURLDetailAuto,
+				},
+			})
+		default:
+			result = append(result, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: part.Text,
+			})
 		}
-		result[i] = ocMsg
 	}
 	return result
 }
@@ -131,6 +237,10 @@ func (c *Client) convertResponse(resp openai.ChatCompletionResponse) *llm.ChatRe
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
+		Model: resp.Model,
+	}
+	if result.Model == "" {
+		result.Model = c.model
 	}
 
 	// Convert tool calls
@@ -146,10 +256,18 @@ func (c *Client) convertResponse(resp openai.ChatCompletionResponse) *llm.ChatRe
 				},
 			}
 		}
-		result.StopReason = llm.StopReasonToolCalls
-	} else {
-		result.StopReason = llm.StopReason(choice.FinishReason)
 	}
+	result.StopReason = convertStopReason(choice.FinishReason, len(msg.ToolCalls) > 0)
 
 	return result
 }
+
+// convertStopReason maps a finish reason onto the shared StopReason values.
+// Some compatible APIs finish tool calls with "stop", which is read as
+// ToolCalls; "length" is kept so truncated tool calls are never executed.
+func convertStopReason(finishReason openai.FinishReason, hasToolCalls bool) llm.StopReason {
+	if hasToolCalls && finishReason == openai.FinishReasonStop {
+		return llm.StopReasonToolCalls
+	}
+	return llm.StopReason(finishReason)
+}
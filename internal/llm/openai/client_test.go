@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"strings"
+	"testing"
+
+	"finta/internal/llm"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestConvertMessages_Images(t *testing.T) {
+	client := NewClient("key", "gpt-4o")
+	image := llm.ImagePart("image/png", []byte("png-bytes"))
+
+	msgs := client.convertMessages([]llm.Message{
+		{Role: llm.RoleUser, Content: "what is this?", Parts: []llm.ContentPart{llm.TextPart("what is this?"), image}},
+		{Role: llm.RoleAssistant, ToolCalls: []*llm.ToolCall{
+			{ID: "call_1", Function: &llm.FunctionCall{Name: "read", Arguments: "{}"}},
+			{ID: "call_2", Function: &llm.FunctionCall{Name: "bash", Arguments: "{}"}},
+		}},
+		{Role: llm.RoleTool, ToolCallID: "call_1", Name: "read", Content: "[Image 1: a.png]", Parts: []llm.ContentPart{llm.TextPart("[Image 1: a.png]"), image}},
+		{Role: llm.RoleTool, ToolCallID: "call_2", Name: "bash", Content: "ok"},
+		{Role: llm.RoleAssistant, Content: "It is a chart."},
+	})
+
+	if len(msgs) != 6 {
+		t.Fatalf("Expected a user message for tool images to be inserted, got %d messages", len(msgs))
+	}
+
+	user := msgs[0]
+	if user.Content != "" || len(user.MultiContent) != 2 || user.MultiContent[1].Type != openai.ChatMessagePartTypeImageURL {
+		t.Fatalf("Expected multi-part user message, got %+v", user)
+	}
+	if !strings.HasPrefix(user.MultiContent[1].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("Expected data URL, got %s", user.MultiContent[1].ImageURL.URL)
+	}
+
+	// Tool results stay text and keep their order; images follow them
+	if msgs[2].ToolCallID != "call_1" || msgs[2].Content != "[Image 1: a.png]" || len(msgs[2].MultiContent) != 0 {
+		t.Errorf("Expected text-only tool message, got %+v", msgs[2])
+	}
+	if msgs[3].ToolCallID != "call_2" {
+		t.Errorf("Expected second tool result before the image message, got %+v", msgs[3])
+	}
+
+	images := msgs[4]
+	if images.Role != openai.ChatMessageRoleUser || len(images.MultiContent) != 2 {
+		t.Fatalf("Expected user message with label and image, got %+v", images)
+	}
+	if !strings.Contains(images.MultiContent[0].Text, "call_1") {
+		t.Errorf("Expected image label to name the tool call, got %q", images.MultiContent[0].Text)
+	}
+}
+
+func TestBuildRequest_ToolControls(t *testing.T) {
+	client := NewClient("key", "gpt-4o")
+	tools := []*llm.ToolDefinition{
+		{Type: "function", Function: &llm.FunctionDef{Name: "glob", Parameters: map[string]any{"type": "object"}}},
+	}
+	parallel := false
+	seed := 7
+
+	req := client.buildRequest(&llm.ChatRequest{
+		Messages:          []llm.Message{{Role: llm.RoleUser, Content: "hi"}},
+		Tools:             tools,
+		ToolChoice:        &llm.ToolChoice{Mode: llm.ToolChoiceFunction, Name: "glob"},
+		ParallelToolCalls: &parallel,
+		TopP:              0.5,
+		Stop:              []string{"END"},
+		Seed:              &seed,
+	})
+
+	choice, ok := req.ToolChoice.(openai.ToolChoice)
+	if !ok || choice.Function.Name != "glob" || choice.Type != openai.ToolTypeFunction {
+		t.Errorf("Expected named function tool choice, got %#v", req.ToolChoice)
+	}
+	if req.ParallelToolCalls != false || req.TopP != 0.5 || req.Stop[0] != "END" || *req.Seed != 7 {
+		t.Errorf("Unexpected request controls: %+v", req)
+	}
+
+	req = client.buildRequest(&llm.ChatRequest{
+		Tools:      tools,
+		ToolChoice: &llm.ToolChoice{Mode: llm.ToolChoiceNone},
+	})
+	if req.ToolChoice != "none" || req.ParallelToolCalls != nil {
+		t.Errorf("Expected string tool choice and unset parallel_tool_calls, got %#v / %#v", req.ToolChoice, req.ParallelToolCalls)
+	}
+
+	// Tool controls are dropped when the request has no tools
+	req = client.buildRequest(&llm.ChatRequest{
+		ToolChoice:        &llm.ToolChoice{Mode: llm.ToolChoiceRequired},
+		ParallelToolCalls: &parallel,
+	})
+	if req.ToolChoice != nil || req.ParallelToolCalls != nil {
+		t.Errorf("Expected no tool controls without tools, got %#v / %#v", req.ToolChoice, req.ParallelToolCalls)
+	}
+}
+
+func TestBuildRequest_ResponseFormat(t *testing.T) {
+	client := NewClient("key", "gpt-4o")
+	req := client.buildRequest(&llm.ChatRequest{
+		ResponseFormat: &llm.ResponseFormat{Name: "plan", Schema: map[string]any{"type": "object"}, Strict: true},
+	})
+
+	format := req.ResponseFormat
+	if format == nil || format.Type != openai.ChatCompletionResponseFormatTypeJSONSchema {
+		t.Fatalf("Expected json_schema response format, got %+v", format)
+	}
+	schema, _ := format.JSONSchema.Schema.MarshalJSON()
+	if format.JSONSchema.Name != "plan" || !format.JSONSchema.Strict || string(schema) != `{"type":"object"}` {
+		t.Errorf("Unexpected JSON schema format: %+v (%s)", format.JSONSchema, schema)
+	}
+}
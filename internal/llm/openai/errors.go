@@ -0,0 +1,97 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"finta/internal/llm"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// responseHeaderKey is the context key under which a headerCapture is stored
+type responseHeaderKey struct{}
+
+// headerCapture records the headers of the last error response for a single call.
+// go-openai does not expose response headers on its errors, so the transport
+// stores them here to recover Retry-After.
+type headerCapture struct {
+	mu     sync.Mutex
+	header http.Header
+}
+
+func (h *headerCapture) set(header http.Header) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header = header
+}
+
+func (h *headerCapture) get() http.Header {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.header
+}
+
+// withHeaderCapture attaches a fresh headerCapture to the context
+func withHeaderCapture(ctx context.Context) (context.Context, *headerCapture) {
+	capture := &headerCapture{}
+	return context.WithValue(ctx, responseHeaderKey{}, capture), capture
+}
+
+// captureTransport stores error response headers in the request's headerCapture
+type captureTransport struct {
+	base http.RoundTripper
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 400 {
+		if capture, ok := req.Context().Value(responseHeaderKey{}).(*headerCapture); ok {
+			capture.set(resp.Header)
+		}
+	}
+	return resp, err
+}
+
+// wrapError converts go-openai errors into *llm.APIError so status codes and
+// Retry-After are available to provider-neutral middleware
+func wrapError(err error, capture *headerCapture) error {
+	if err == nil {
+		return nil
+	}
+
+	apiErr := &llm.APIError{
+		Provider: "openai",
+		Err:      err,
+	}
+
+	var oaAPIErr *openai.APIError
+	var oaReqErr *openai.RequestError
+	switch {
+	case errors.As(err, &oaAPIErr):
+		apiErr.StatusCode = oaAPIErr.HTTPStatusCode
+		apiErr.Type = oaAPIErr.Type
+		apiErr.Message = oaAPIErr.Message
+	case errors.As(err, &oaReqErr):
+		apiErr.StatusCode = oaReqErr.HTTPStatusCode
+		apiErr.Message = strings.TrimSpace(string(oaReqErr.Body))
+		if apiErr.Message == "" && oaReqErr.Err != nil {
+			apiErr.Message = oaReqErr.Err.Error()
+		}
+	default:
+		// Network and decoding errors are returned unchanged
+		return err
+	}
+
+	if capture != nil {
+		if header := capture.get(); header != nil {
+			apiErr.RetryAfter = llm.ParseRetryAfter(header, time.Now())
+		}
+	}
+
+	return apiErr
+}
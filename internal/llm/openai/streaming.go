@@ -15,22 +15,22 @@ type StreamReader struct {
 	stream         *openai.ChatCompletionStream
 	accumulatedMsg llm.Message
 	toolCallsMap   map[int]*llm.ToolCall // Track tool calls by index
+	usage          *llm.Usage            // Set by the final usage chunk
+	stopReason     llm.StopReason        // Set by the chunk carrying the finish reason
+	model          string                // Reported by the chunks, defaulting to the requested model
 }
 
 func (c *Client) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
-	messages := c.convertMessages(req.Messages)
-	tools := c.convertTools(req.Tools)
-
-	stream, err := c.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
-		Model:       c.model,
-		Messages:    messages,
-		Tools:       tools,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		Stream:      true,
-	})
+	ocReq := c.buildRequest(req)
+	ocReq.Stream = true
+	ocReq.StreamOptions = &openai.StreamOptions{
+		IncludeUsage: true,
+	}
+
+	ctx, capture := withHeaderCapture(ctx)
+	stream, err := c.client.CreateChatCompletionStream(ctx, ocReq)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, capture)
 	}
 
 	return &StreamReader{
@@ -42,6 +42,7 @@ func (c *Client) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.Stre
 			ToolCalls: nil,
 		},
 		toolCallsMap: make(map[int]*llm.ToolCall),
+		model:        c.model,
 	}, nil
 }
 
@@ -50,11 +51,30 @@ func (s *StreamReader) Recv() (*llm.Delta, error) {
 	if err == io.EOF {
 		// Stream complete, return final accumulated message
 		return &llm.Delta{
-			Done: true,
+			Done:       true,
+			StopReason: s.stopReason,
+			Usage:      s.usage,
+			Model:      s.model,
 		}, nil
 	}
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, nil)
+	}
+
+	if resp.Model != "" {
+		s.model = resp.Model
+	}
+
+	// The usage chunk requested via stream options has no choices
+	if resp.Usage != nil {
+		s.usage = &llm.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+		if len(resp.Choices) == 0 {
+			return s.Recv()
+		}
 	}
 
 	if len(resp.Choices) == 0 {
@@ -125,6 +145,9 @@ func (s *StreamReader) Recv() (*llm.Delta, error) {
 
 	// Check if this is the final chunk
 	finishReason := resp.Choices[0].FinishReason
+	if finishReason != "" {
+		s.stopReason = convertStopReason(finishReason, len(s.toolCallsMap) > 0)
+	}
 	if finishReason == openai.FinishReasonStop ||
 		finishReason == openai.FinishReasonToolCalls ||
 		finishReason == openai.FinishReasonLength {
@@ -148,6 +171,19 @@ func (s *StreamReader) Close() error {
 	return nil
 }
 
+// Usage returns the token usage reported by the stream, if any
+func (s *StreamReader) Usage() llm.Usage {
+	if s.usage == nil {
+		return llm.Usage{}
+	}
+	return *s.usage
+}
+
+// StopReason returns the stop reason reported by the stream
+func (s *StreamReader) StopReason() llm.StopReason {
+	return s.stopReason
+}
+
 // GetAccumulatedMessage returns the fully accumulated message
 // This should be called after the stream is complete
 func (s *StreamReader) GetAccumulatedMessage() llm.Message {
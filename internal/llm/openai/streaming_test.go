@@ -0,0 +1,99 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"finta/internal/llm"
+)
+
+func TestChatStream_FinishReasonAndUsage(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"length"}]}`,
+		`{"id":"c1","choices":[],"usage":{"prompt_tokens":11,"completion_tokens":2,"total_tokens":13}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClient("key", "gpt-4o", server.URL)
+	reader, err := client.ChatStream(context.Background(), &llm.ChatRequest{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	defer reader.Close()
+
+	var content string
+	for {
+		delta, err := reader.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if !delta.Done {
+			content += delta.Content
+			continue
+		}
+
+		if delta.StopReason != llm.StopReasonLength {
+			t.Errorf("Expected length stop reason on final delta, got %q", delta.StopReason)
+		}
+		if delta.Usage == nil || delta.Usage.TotalTokens != 13 {
+			t.Errorf("Expected usage on final delta, got %+v", delta.Usage)
+		}
+		break
+	}
+
+	if content != "Hello" {
+		t.Errorf("Expected streamed content, got %q", content)
+	}
+}
+
+func TestChatStream_TruncatedToolCallKeepsLength(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"glob","arguments":"{\"pat"}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClient("key", "gpt-4o", server.URL)
+	reader, err := client.ChatStream(context.Background(), &llm.ChatRequest{
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	defer reader.Close()
+
+	for {
+		delta, err := reader.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if delta.Done {
+			if delta.StopReason != llm.StopReasonLength {
+				t.Errorf("Expected length stop reason for a truncated tool call, got %q", delta.StopReason)
+			}
+			break
+		}
+	}
+}
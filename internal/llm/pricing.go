@@ -0,0 +1,86 @@
+package llm
+
+import "strings"
+
+// Price is the cost of a model in USD per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// PriceTable maps model names (or name prefixes) to prices
+type PriceTable map[string]Price
+
+// DefaultPrices returns list prices for common models
+func DefaultPrices() PriceTable {
+	return PriceTable{
+		"gpt-5":             {Input: 1.25, Output: 10},
+		"gpt-5-mini":        {Input: 0.25, Output: 2},
+		"gpt-5-nano":        {Input: 0.05, Output: 0.4},
+		"gpt-4.1":           {Input: 2, Output: 8},
+		"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+		"gpt-4.1-nano":      {Input: 0.1, Output: 0.4},
+		"gpt-4o":            {Input: 2.5, Output: 10},
+		"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+		"gpt-4-turbo":       {Input: 10, Output: 30},
+		"gpt-4":             {Input: 30, Output: 60},
+		"gpt-3.5-turbo":     {Input: 0.5, Output: 1.5},
+		"o1":                {Input: 15, Output: 60},
+		"o3":                {Input: 2, Output: 8},
+		"o3-mini":           {Input: 1.1, Output: 4.4},
+		"o4-mini":           {Input: 1.1, Output: 4.4},
+		"claude-opus-4":     {Input: 15, Output: 75},
+		"claude-opus-4-5":   {Input: 5, Output: 25},
+		"claude-sonnet-4":   {Input: 3, Output: 15},
+		"claude-haiku-4-5":  {Input: 1, Output: 5},
+		"claude-3-7-sonnet": {Input: 3, Output: 15},
+		"claude-3-5-sonnet": {Input: 3, Output: 15},
+		"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	}
+}
+
+// Merge returns a copy of t with the entries of other added or replaced
+func (t PriceTable) Merge(other PriceTable) PriceTable {
+	merged := make(PriceTable, len(t)+len(other))
+	for model, price := range t {
+		merged[model] = price
+	}
+	for model, price := range other {
+		merged[model] = price
+	}
+	return merged
+}
+
+// Lookup returns the price of a model. An exact match wins; otherwise the
+// longest entry that prefixes the model name is used, so dated snapshots
+// such as "gpt-4o-2024-08-06" share their family's price.
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	if price, ok := t[name]; ok {
+		return price, true
+	}
+
+	best := ""
+	for prefix := range t {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t[best], true
+}
+
+// Cost returns the cost in USD of usage on a model, and whether the model is priced
+func (t PriceTable) Cost(model string, usage Usage) (float64, bool) {
+	price, ok := t.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6, true
+}
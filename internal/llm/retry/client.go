@@ -0,0 +1,299 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"finta/internal/config"
+	"finta/internal/llm"
+)
+
+// Config controls retry behaviour
+type Config struct {
+	MaxAttempts    int           // Total attempts including the first (1 disables retries)
+	InitialBackoff time.Duration // Delay before the first retry
+	MaxBackoff     time.Duration // Upper bound for a single delay, including Retry-After
+	Multiplier     float64       // Backoff growth factor per attempt
+	Jitter         float64       // Random fraction (0-1) subtracted from each delay
+}
+
+// DefaultConfig returns the retry settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// ConfigFrom merges YAML retry settings onto the defaults
+func ConfigFrom(c config.RetryConfig) Config {
+	cfg := DefaultConfig()
+	if c.MaxAttempts > 0 {
+		cfg.MaxAttempts = c.MaxAttempts
+	}
+	if c.InitialBackoff > 0 {
+		cfg.InitialBackoff = c.InitialBackoff
+	}
+	if c.MaxBackoff > 0 {
+		cfg.MaxBackoff = c.MaxBackoff
+	}
+	if c.Multiplier > 0 {
+		cfg.Multiplier = c.Multiplier
+	}
+	if c.Jitter != nil {
+		cfg.Jitter = *c.Jitter
+	}
+	return cfg
+}
+
+// RetryFunc is called before sleeping ahead of a retry
+type RetryFunc func(attempt int, delay time.Duration, err error)
+
+// Client is an llm.Client decorator that retries transient failures with
+// exponential backoff and jitter, honouring Retry-After when the API sends it.
+// Streaming calls are retried only if they fail before the first delta.
+type Client struct {
+	inner   llm.Client
+	config  Config
+	onRetry RetryFunc
+	sleep   func(ctx context.Context, d time.Duration) error
+	rand    func() float64
+}
+
+// NewClient wraps an llm.Client with retry handling
+func NewClient(inner llm.Client, cfg Config) *Client {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 1
+	}
+
+	return &Client{
+		inner:  inner,
+		config: cfg,
+		sleep:  sleepContext,
+		rand:   rand.Float64,
+	}
+}
+
+// SetOnRetry registers a callback invoked before each retry (e.g. for logging)
+func (c *Client) SetOnRetry(fn RetryFunc) {
+	c.onRetry = fn
+}
+
+func (c *Client) Provider() string {
+	return c.inner.Provider()
+}
+
+func (c *Client) Model() string {
+	return c.inner.Model()
+}
+
+// Unwrap returns the wrapped client
+func (c *Client) Unwrap() llm.Client {
+	return c.inner
+}
+
+func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.inner.Chat(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		if !c.shouldRetry(ctx, attempt, err) {
+			return nil, err
+		}
+
+		if err := c.wait(ctx, attempt, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	reader, attempt, err := c.openStream(ctx, req, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamReader{
+		client:  c,
+		ctx:     ctx,
+		req:     req,
+		reader:  reader,
+		attempt: attempt,
+	}, nil
+}
+
+// openStream opens a stream, retrying connection failures.
+// It returns the reader and the attempt number that succeeded.
+func (c *Client) openStream(ctx context.Context, req *llm.ChatRequest, attempt int) (llm.StreamReader, int, error) {
+	for ; ; attempt++ {
+		reader, err := c.inner.ChatStream(ctx, req)
+		if err == nil {
+			return reader, attempt, nil
+		}
+
+		if !c.shouldRetry(ctx, attempt, err) {
+			return nil, attempt, err
+		}
+
+		if err := c.wait(ctx, attempt, err); err != nil {
+			return nil, attempt, err
+		}
+	}
+}
+
+// shouldRetry reports whether another attempt should be made after err
+func (c *Client) shouldRetry(ctx context.Context, attempt int, err error) bool {
+	if attempt >= c.config.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+	return IsRetryable(err)
+}
+
+// wait sleeps for the backoff delay of the given attempt
+func (c *Client) wait(ctx context.Context, attempt int, err error) error {
+	delay := c.backoff(attempt, err)
+	if c.onRetry != nil {
+		c.onRetry(attempt, delay, err)
+	}
+	return c.sleep(ctx, delay)
+}
+
+// backoff computes the delay before retrying after the given attempt.
+// The exponential delay is reduced by a random jitter fraction, and a
+// server-provided Retry-After is used as a lower bound. MaxBackoff caps
+// the result, so a server can't stall the run indefinitely.
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	delay := float64(c.config.InitialBackoff) * math.Pow(c.config.Multiplier, float64(attempt-1))
+	if c.config.MaxBackoff > 0 && delay > float64(c.config.MaxBackoff) {
+		delay = float64(c.config.MaxBackoff)
+	}
+	if c.config.Jitter > 0 {
+		delay -= delay * c.config.Jitter * c.rand()
+	}
+
+	result := time.Duration(delay)
+
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > result {
+		result = apiErr.RetryAfter
+		if c.config.MaxBackoff > 0 && result > c.config.MaxBackoff {
+			result = c.config.MaxBackoff
+		}
+	}
+
+	return result
+}
+
+// IsRetryable reports whether an error is transient: rate limits, server
+// errors, timeouts and dropped connections
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusRequestTimeout,
+			apiErr.StatusCode == http.StatusConflict,
+			apiErr.StatusCode == http.StatusTooManyRequests,
+			apiErr.StatusCode >= 500:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// streamReader re-opens the underlying stream if it fails before producing
+// any content, so callers never see a partial response followed by a replay
+type streamReader struct {
+	client  *Client
+	ctx     context.Context
+	req     *llm.ChatRequest
+	reader  llm.StreamReader
+	attempt int
+	started bool
+}
+
+func (s *streamReader) Recv() (*llm.Delta, error) {
+	for {
+		delta, err := s.reader.Recv()
+		if err == nil {
+			if delta.Done || delta.Content != "" || delta.Reason != "" || len(delta.ToolCalls) > 0 {
+				s.started = true
+			}
+			return delta, nil
+		}
+
+		if s.started || !s.client.shouldRetry(s.ctx, s.attempt, err) {
+			return nil, err
+		}
+
+		s.reader.Close()
+		if waitErr := s.client.wait(s.ctx, s.attempt, err); waitErr != nil {
+			return nil, waitErr
+		}
+
+		reader, attempt, openErr := s.client.openStream(s.ctx, s.req, s.attempt+1)
+		if openErr != nil {
+			// Keep a closed-safe reader in place for the caller's Close
+			s.reader = closedReader{}
+			return nil, openErr
+		}
+		s.reader = reader
+		s.attempt = attempt
+	}
+}
+
+func (s *streamReader) Close() error {
+	return s.reader.Close()
+}
+
+// Unwrap returns the current underlying stream reader
+func (s *streamReader) Unwrap() llm.StreamReader {
+	return s.reader
+}
+
+// closedReader stands in for a stream that could not be re-opened
+type closedReader struct{}
+
+func (closedReader) Recv() (*llm.Delta, error) { return nil, io.ErrClosedPipe }
+func (closedReader) Close() error              { return nil }
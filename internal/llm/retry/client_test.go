@@ -0,0 +1,198 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"finta/internal/config"
+	"finta/internal/llm"
+)
+
+// fakeClient returns queued errors before succeeding
+type fakeClient struct {
+	chatErrs   []error
+	streamErrs []error // Errors returned by Recv on the first call of each stream
+	chatCalls  int
+	streams    int
+}
+
+func (f *fakeClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	f.chatCalls++
+	if len(f.chatErrs) > 0 {
+		err := f.chatErrs[0]
+		f.chatErrs = f.chatErrs[1:]
+		return nil, err
+	}
+	return &llm.ChatResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: "ok"}, StopReason: llm.StopReasonStop}, nil
+}
+
+func (f *fakeClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	f.streams++
+	var err error
+	if len(f.streamErrs) > 0 {
+		err = f.streamErrs[0]
+		f.streamErrs = f.streamErrs[1:]
+	}
+	return &fakeStream{failFirst: err, deltas: []string{"hel", "lo"}}, nil
+}
+
+func (f *fakeClient) Provider() string { return "fake" }
+func (f *fakeClient) Model() string    { return "fake-model" }
+
+type fakeStream struct {
+	failFirst error
+	failAfter error // Returned after all deltas instead of Done
+	deltas    []string
+	pos       int
+}
+
+func (s *fakeStream) Recv() (*llm.Delta, error) {
+	if s.failFirst != nil {
+		err := s.failFirst
+		s.failFirst = nil
+		return nil, err
+	}
+	if s.pos < len(s.deltas) {
+		s.pos++
+		return &llm.Delta{Content: s.deltas[s.pos-1]}, nil
+	}
+	if s.failAfter != nil {
+		return nil, s.failAfter
+	}
+	return &llm.Delta{Done: true}, nil
+}
+
+func (s *fakeStream) Close() error { return nil }
+
+func newTestClient(inner llm.Client, cfg Config) (*Client, *[]time.Duration) {
+	c := NewClient(inner, cfg)
+	var delays []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	c.rand = func() float64 { return 0 }
+	return c, &delays
+}
+
+func TestChat_RetriesTransientErrors(t *testing.T) {
+	inner := &fakeClient{chatErrs: []error{
+		&llm.APIError{StatusCode: http.StatusTooManyRequests},
+		&llm.APIError{StatusCode: http.StatusBadGateway},
+	}}
+	c, delays := newTestClient(inner, Config{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Multiplier: 2})
+
+	resp, err := c.Chat(context.Background(), &llm.ChatRequest{})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if resp.Message.Content != "ok" || inner.chatCalls != 3 {
+		t.Errorf("Expected 3 calls ending in success, got %d calls", inner.chatCalls)
+	}
+	if len(*delays) != 2 || (*delays)[0] != time.Second || (*delays)[1] != 2*time.Second {
+		t.Errorf("Expected exponential delays [1s 2s], got %v", *delays)
+	}
+}
+
+func TestChat_DoesNotRetryClientErrors(t *testing.T) {
+	inner := &fakeClient{chatErrs: []error{&llm.APIError{StatusCode: http.StatusBadRequest}}}
+	c, _ := newTestClient(inner, DefaultConfig())
+
+	if _, err := c.Chat(context.Background(), &llm.ChatRequest{}); err == nil {
+		t.Fatal("Expected 400 to be returned without retry")
+	}
+	if inner.chatCalls != 1 {
+		t.Errorf("Expected a single call, got %d", inner.chatCalls)
+	}
+}
+
+func TestChat_GivesUpAfterMaxAttempts(t *testing.T) {
+	rateLimited := &llm.APIError{StatusCode: http.StatusTooManyRequests}
+	inner := &fakeClient{chatErrs: []error{rateLimited, rateLimited, rateLimited}}
+	c, _ := newTestClient(inner, Config{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+
+	_, err := c.Chat(context.Background(), &llm.ChatRequest{})
+	if !errors.Is(err, rateLimited) {
+		t.Fatalf("Expected last error to be returned, got %v", err)
+	}
+	if inner.chatCalls != 2 {
+		t.Errorf("Expected 2 calls, got %d", inner.chatCalls)
+	}
+}
+
+func TestBackoff_HonoursRetryAfterAndJitter(t *testing.T) {
+	c, _ := newTestClient(&fakeClient{}, Config{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 4 * time.Second, Multiplier: 2, Jitter: 0.5})
+	c.rand = func() float64 { return 1 }
+
+	if d := c.backoff(1, errors.New("x")); d != 500*time.Millisecond {
+		t.Errorf("Expected full jitter to halve 1s, got %v", d)
+	}
+	if d := c.backoff(10, errors.New("x")); d != 2*time.Second {
+		t.Errorf("Expected delay capped at max backoff before jitter, got %v", d)
+	}
+	if d := c.backoff(1, &llm.APIError{StatusCode: 429, RetryAfter: 3 * time.Second}); d != 3*time.Second {
+		t.Errorf("Expected Retry-After to win, got %v", d)
+	}
+	if d := c.backoff(1, &llm.APIError{StatusCode: 429, RetryAfter: time.Hour}); d != 4*time.Second {
+		t.Errorf("Expected Retry-After capped at max backoff, got %v", d)
+	}
+}
+
+func TestConfigFrom_ExplicitZeroJitter(t *testing.T) {
+	if cfg := ConfigFrom(config.RetryConfig{}); cfg.Jitter != DefaultConfig().Jitter {
+		t.Errorf("Expected the default jitter when unset, got %v", cfg.Jitter)
+	}
+	zero := 0.0
+	if cfg := ConfigFrom(config.RetryConfig{Jitter: &zero}); cfg.Jitter != 0 {
+		t.Errorf("Expected jitter disabled, got %v", cfg.Jitter)
+	}
+}
+
+func TestChatStream_RetriesBeforeFirstDelta(t *testing.T) {
+	inner := &fakeClient{streamErrs: []error{&llm.APIError{StatusCode: 529}}}
+	c, delays := newTestClient(inner, DefaultConfig())
+
+	reader, err := c.ChatStream(context.Background(), &llm.ChatRequest{})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	defer reader.Close()
+
+	var content string
+	for {
+		delta, err := reader.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if delta.Done {
+			break
+		}
+		content += delta.Content
+	}
+
+	if content != "hello" || inner.streams != 2 || len(*delays) != 1 {
+		t.Errorf("Expected one retry and full content, got content=%q streams=%d retries=%d", content, inner.streams, len(*delays))
+	}
+}
+
+func TestChatStream_NoRetryAfterContent(t *testing.T) {
+	c, _ := newTestClient(&fakeClient{}, DefaultConfig())
+	failure := &llm.APIError{StatusCode: 500}
+	s := &streamReader{
+		client:  c,
+		ctx:     context.Background(),
+		req:     &llm.ChatRequest{},
+		reader:  &fakeStream{deltas: []string{"partial"}, failAfter: failure},
+		attempt: 1,
+	}
+
+	if _, err := s.Recv(); err != nil {
+		t.Fatalf("First Recv failed: %v", err)
+	}
+	if _, err := s.Recv(); !errors.Is(err, failure) {
+		t.Errorf("Expected mid-stream error to surface, got %v", err)
+	}
+}
@@ -0,0 +1,395 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"finta/internal/config"
+	"finta/internal/llm"
+	"finta/internal/llm/retry"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failures after
+	// which a client is temporarily skipped
+	DefaultFailureThreshold = 3
+
+	// DefaultCooldown is how long a failing client is skipped
+	DefaultCooldown = time.Minute
+)
+
+// Rule selects a fallback chain for matching requests
+type Rule struct {
+	Agent    string   // Agent name pattern (path.Match syntax), "" matches any
+	HasTools *bool    // Match on whether the request offers tools, nil matches any
+	Clients  []string // Fallback chain of client names
+}
+
+// matches reports whether the rule applies to a request from the given agent
+func (r *Rule) matches(agentName string, req *llm.ChatRequest) bool {
+	if r.Agent != "" {
+		if ok, _ := path.Match(r.Agent, agentName); !ok {
+			return false
+		}
+	}
+	if r.HasTools != nil && *r.HasTools != (len(req.Tools) > 0) {
+		return false
+	}
+	return true
+}
+
+// FallbackFunc is called when a client fails and the router moves on
+type FallbackFunc func(from string, err error, to string)
+
+// clientHealth tracks recent failures of a named client
+type clientHealth struct {
+	consecutiveFailures int
+	skipUntil           time.Time
+}
+
+// Router is an llm.Client that picks one of several named clients per
+// request. Rules match on the calling agent and on whether tools are offered;
+// the selected chain is tried in order, falling back on timeouts, transient
+// and auth errors. Clients that fail repeatedly are skipped for a cooldown
+// period.
+type Router struct {
+	clients          map[string]llm.Client
+	rules            []Rule
+	defaultChain     []string
+	timeout          time.Duration
+	failureThreshold int
+	cooldown         time.Duration
+	onFallback       FallbackFunc
+
+	health map[string]*clientHealth
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+// New creates a router over the given named clients
+func New(clients map[string]llm.Client, defaultChain []string, rules []Rule) (*Router, error) {
+	r := &Router{
+		clients:          clients,
+		rules:            rules,
+		defaultChain:     defaultChain,
+		failureThreshold: DefaultFailureThreshold,
+		cooldown:         DefaultCooldown,
+		health:           make(map[string]*clientHealth),
+		now:              time.Now,
+	}
+
+	if len(defaultChain) == 0 {
+		return nil, fmt.Errorf("router requires a default client chain")
+	}
+	if err := r.checkChain(defaultChain); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := r.checkChain(rule.Clients); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// NewFromConfig creates a router from YAML settings over already-built clients
+func NewFromConfig(cfg config.RouterConfig, clients map[string]llm.Client) (*Router, error) {
+	rules := make([]Rule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		rules[i] = Rule{
+			Agent:    rule.Agent,
+			HasTools: rule.HasTools,
+			Clients:  rule.Clients,
+		}
+	}
+
+	r, err := New(clients, cfg.Default, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	r.SetTimeout(cfg.Timeout)
+	if cfg.FailureThreshold > 0 {
+		r.failureThreshold = cfg.FailureThreshold
+	}
+	if cfg.Cooldown > 0 {
+		r.cooldown = cfg.Cooldown
+	}
+
+	return r, nil
+}
+
+func (r *Router) checkChain(chain []string) error {
+	for _, name := range chain {
+		if _, ok := r.clients[name]; !ok {
+			return fmt.Errorf("router: unknown client: %s", name)
+		}
+	}
+	return nil
+}
+
+// SetTimeout bounds each attempt; streams are bounded until their first delta
+func (r *Router) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// SetOnFallback registers a callback invoked when the router falls back
+func (r *Router) SetOnFallback(fn FallbackFunc) {
+	r.onFallback = fn
+}
+
+func (r *Router) Provider() string {
+	return "router"
+}
+
+// Model returns the model of the first client in the default chain
+func (r *Router) Model() string {
+	return r.clients[r.defaultChain[0]].Model()
+}
+
+// Client returns a named client
+func (r *Router) Client(name string) (llm.Client, bool) {
+	c, ok := r.clients[name]
+	return c, ok
+}
+
+// Select returns the ordered client names to try for a request.
+// Clients cooling down after repeated failures are moved to the end
+// so they are only used when everything else has failed.
+func (r *Router) Select(ctx context.Context, req *llm.ChatRequest) []string {
+	chain := r.defaultChain
+	agentName := llm.AgentNameFromContext(ctx)
+	for i := range r.rules {
+		if r.rules[i].matches(agentName, req) {
+			chain = r.rules[i].Clients
+			break
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	healthy := make([]string, 0, len(chain))
+	var cooling []string
+	for _, name := range chain {
+		if h, ok := r.health[name]; ok && now.Before(h.skipUntil) {
+			cooling = append(cooling, name)
+			continue
+		}
+		healthy = append(healthy, name)
+	}
+
+	return append(healthy, cooling...)
+}
+
+func (r *Router) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	chain := r.Select(ctx, req)
+
+	var lastErr error
+	for i, name := range chain {
+		attemptCtx, cancel := r.attemptContext(ctx)
+		resp, err := r.clients[name].Chat(attemptCtx, req)
+		cancel()
+
+		if err == nil {
+			r.recordSuccess(name)
+			if resp.Model == "" {
+				resp.Model = r.clients[name].Model()
+			}
+			return resp, nil
+		}
+
+		if ctx.Err() != nil {
+			// Caller cancelled; don't blame the client
+			return nil, err
+		}
+		if !shouldFallBack(err) {
+			// The request itself was rejected; don't blame the client
+			return nil, &ClientError{Client: name, Err: err}
+		}
+
+		lastErr = r.recordFailure(name, err)
+		r.notifyFallback(chain, i, lastErr)
+	}
+
+	return nil, lastErr
+}
+
+func (r *Router) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	chain := r.Select(ctx, req)
+
+	var lastErr error
+	for i, name := range chain {
+		reader, err := r.openStream(ctx, name, req)
+		if err == nil {
+			r.recordSuccess(name)
+			return reader, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !shouldFallBack(err) {
+			return nil, &ClientError{Client: name, Err: err}
+		}
+
+		lastErr = r.recordFailure(name, err)
+		r.notifyFallback(chain, i, lastErr)
+	}
+
+	return nil, lastErr
+}
+
+// openStream opens a stream on one client and waits for its first delta,
+// so failures that happen before any output can still fall back
+func (r *Router) openStream(ctx context.Context, name string, req *llm.ChatRequest) (llm.StreamReader, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	var timer *time.Timer
+	if r.timeout > 0 {
+		timer = time.AfterFunc(r.timeout, cancel)
+	}
+	stopTimer := func() bool {
+		return timer == nil || timer.Stop()
+	}
+
+	reader, err := r.clients[name].ChatStream(streamCtx, req)
+	if err != nil {
+		stopTimer()
+		cancel()
+		return nil, r.timeoutError(ctx, streamCtx, err)
+	}
+
+	first, err := reader.Recv()
+	if err != nil || !stopTimer() {
+		reader.Close()
+		cancel()
+		if err == nil {
+			err = context.DeadlineExceeded
+		}
+		return nil, r.timeoutError(ctx, streamCtx, err)
+	}
+
+	return &stream{reader: reader, first: first, cancel: cancel, model: r.clients[name].Model()}, nil
+}
+
+// shouldFallBack reports whether another client may succeed where one
+// failed: after a timeout, a transient error (rate limit, 5xx, dropped
+// connection) or an auth error. Other 4xx errors, e.g. an invalid or too
+// long request, would fail on any client.
+func shouldFallBack(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true // The router's attempt timeout; the caller's was checked before
+	}
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) &&
+		(apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return true
+	}
+	return retry.IsRetryable(err)
+}
+
+// attemptContext applies the per-attempt timeout
+func (r *Router) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// timeoutError makes router-imposed timeouts explicit in the error
+func (r *Router) timeoutError(parent, attempt context.Context, err error) error {
+	if parent.Err() == nil && attempt.Err() != nil {
+		return fmt.Errorf("timed out after %s: %w", r.timeout, err)
+	}
+	return err
+}
+
+func (r *Router) recordSuccess(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.health, name)
+}
+
+// recordFailure updates failure history and returns the error annotated
+// with the client name
+func (r *Router) recordFailure(name string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.health[name]
+	if !ok {
+		h = &clientHealth{}
+		r.health[name] = h
+	}
+	h.consecutiveFailures++
+	if h.consecutiveFailures >= r.failureThreshold {
+		h.skipUntil = r.now().Add(r.cooldown)
+	}
+
+	return &ClientError{Client: name, Err: err}
+}
+
+func (r *Router) notifyFallback(chain []string, i int, err error) {
+	if r.onFallback == nil || i+1 >= len(chain) {
+		return
+	}
+	r.onFallback(chain[i], err, chain[i+1])
+}
+
+// ClientError records which named client produced an error
+type ClientError struct {
+	Client string
+	Err    error
+}
+
+func (e *ClientError) Error() string {
+	return fmt.Sprintf("client %s: %v", e.Client, e.Err)
+}
+
+func (e *ClientError) Unwrap() error {
+	return e.Err
+}
+
+// stream replays the delta consumed while probing the stream
+type stream struct {
+	reader llm.StreamReader
+	first  *llm.Delta
+	cancel context.CancelFunc
+	model  string // Model of the client serving the stream
+}
+
+// Recv returns the next delta, naming the serving client's model on the
+// final delta if the provider didn't
+func (s *stream) Recv() (*llm.Delta, error) {
+	d := s.first
+	s.first = nil
+	if d == nil {
+		var err error
+		if d, err = s.reader.Recv(); err != nil {
+			return nil, err
+		}
+	}
+	if d.Done && d.Model == "" {
+		d.Model = s.model
+	}
+	return d, nil
+}
+
+func (s *stream) Close() error {
+	err := s.reader.Close()
+	s.cancel()
+	return err
+}
+
+// Unwrap returns the underlying stream reader
+func (s *stream) Unwrap() llm.StreamReader {
+	return s.reader
+}
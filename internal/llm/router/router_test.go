@@ -0,0 +1,196 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"finta/internal/llm"
+)
+
+type stubClient struct {
+	name  string
+	err   error
+	delay time.Duration
+	calls int
+}
+
+func (s *stubClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	s.calls++
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &llm.ChatResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: s.name}}, nil
+}
+
+func (s *stubClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &stubStream{content: s.name}, nil
+}
+
+func (s *stubClient) Provider() string { return "stub" }
+func (s *stubClient) Model() string    { return s.name + "-model" }
+
+type stubStream struct {
+	content string
+	sent    bool
+}
+
+func (s *stubStream) Recv() (*llm.Delta, error) {
+	if !s.sent {
+		s.sent = true
+		return &llm.Delta{Content: s.content}, nil
+	}
+	return &llm.Delta{Done: true}, nil
+}
+
+func (s *stubStream) Close() error { return nil }
+
+func TestRouter_RoutesByAgentAndTools(t *testing.T) {
+	noTools := false
+	r, err := New(map[string]llm.Client{
+		"strong": &stubClient{name: "strong"},
+		"cheap":  &stubClient{name: "cheap"},
+		"plain":  &stubClient{name: "plain"},
+	}, []string{"strong"}, []Rule{
+		{Agent: "explore", Clients: []string{"cheap"}},
+		{HasTools: &noTools, Clients: []string{"plain"}},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tools := []*llm.ToolDefinition{{Type: "function", Function: &llm.FunctionDef{Name: "read"}}}
+
+	cases := []struct {
+		agent string
+		tools []*llm.ToolDefinition
+		want  string
+	}{
+		{"explore", tools, "cheap"},
+		{"execute", tools, "strong"},
+		{"execute", nil, "plain"},
+	}
+
+	for _, tc := range cases {
+		ctx := llm.WithAgentName(context.Background(), tc.agent)
+		resp, err := r.Chat(ctx, &llm.ChatRequest{Tools: tc.tools})
+		if err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+		if resp.Message.Content != tc.want || resp.Model != tc.want+"-model" {
+			t.Errorf("agent=%s tools=%d: expected %s, got %s (model %s)", tc.agent, len(tc.tools), tc.want, resp.Message.Content, resp.Model)
+		}
+	}
+}
+
+func TestRouter_FallsBackOnErrorAndTimeout(t *testing.T) {
+	failing := &stubClient{name: "primary", err: &llm.APIError{StatusCode: 503}}
+	slow := &stubClient{name: "slow", delay: time.Second}
+	local := &stubClient{name: "local"}
+
+	r, err := New(map[string]llm.Client{"primary": failing, "slow": slow, "local": local},
+		[]string{"primary", "slow", "local"}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.SetTimeout(20 * time.Millisecond)
+
+	var fallbacks []string
+	r.SetOnFallback(func(from string, err error, to string) {
+		fallbacks = append(fallbacks, from+"->"+to)
+	})
+
+	resp, err := r.Chat(context.Background(), &llm.ChatRequest{})
+	if err != nil {
+		t.Fatalf("Expected fallback to succeed, got %v", err)
+	}
+	if resp.Message.Content != "local" {
+		t.Errorf("Expected local to answer, got %s", resp.Message.Content)
+	}
+	if len(fallbacks) != 2 || fallbacks[0] != "primary->slow" || fallbacks[1] != "slow->local" {
+		t.Errorf("Unexpected fallbacks: %v", fallbacks)
+	}
+}
+
+func TestRouter_SkipsClientsAfterRepeatedFailures(t *testing.T) {
+	failing := &stubClient{name: "primary", err: &llm.APIError{StatusCode: 500}}
+	backup := &stubClient{name: "backup"}
+
+	r, _ := New(map[string]llm.Client{"primary": failing, "backup": backup}, []string{"primary", "backup"}, nil)
+	r.failureThreshold = 2
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Chat(context.Background(), &llm.ChatRequest{}); err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+	}
+	if failing.calls != 2 {
+		t.Errorf("Expected primary to be skipped after 2 failures, got %d calls", failing.calls)
+	}
+
+	// After the cooldown the primary is tried again
+	now = now.Add(DefaultCooldown + time.Second)
+	r.Chat(context.Background(), &llm.ChatRequest{})
+	if failing.calls != 3 {
+		t.Errorf("Expected primary to be retried after cooldown, got %d calls", failing.calls)
+	}
+}
+
+func TestRouter_InvalidRequestDoesNotFallBack(t *testing.T) {
+	invalid := &llm.APIError{StatusCode: 400, Message: "prompt is too long"}
+	primary := &stubClient{name: "primary", err: invalid}
+	backup := &stubClient{name: "backup"}
+
+	r, _ := New(map[string]llm.Client{"primary": primary, "backup": backup}, []string{"primary", "backup"}, nil)
+	r.failureThreshold = 1
+
+	_, err := r.Chat(context.Background(), &llm.ChatRequest{})
+	if !errors.Is(err, invalid) || backup.calls != 0 {
+		t.Fatalf("Expected the 400 returned without falling back, got %v (%d backup calls)", err, backup.calls)
+	}
+	if got := r.Select(context.Background(), &llm.ChatRequest{}); got[0] != "primary" {
+		t.Errorf("Expected primary kept in rotation, got %v", got)
+	}
+}
+
+func TestRouter_StreamFallsBackBeforeFirstDelta(t *testing.T) {
+	r, _ := New(map[string]llm.Client{
+		"primary": &stubClient{name: "primary", err: &llm.APIError{StatusCode: 401}},
+		"local":   &stubClient{name: "local"},
+	}, []string{"primary", "local"}, nil)
+
+	reader, err := r.ChatStream(context.Background(), &llm.ChatRequest{})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	defer reader.Close()
+
+	delta, err := reader.Recv()
+	if err != nil || delta.Content != "local" {
+		t.Fatalf("Expected replayed first delta from local, got %+v, %v", delta, err)
+	}
+	if delta, _ := reader.Recv(); !delta.Done || delta.Model != "local-model" {
+		t.Errorf("Expected stream to finish naming local's model, got %+v", delta)
+	}
+}
+
+func TestNew_UnknownClient(t *testing.T) {
+	_, err := New(map[string]llm.Client{"a": &stubClient{}}, []string{"a"}, []Rule{{Clients: []string{"missing"}}})
+	if err == nil {
+		t.Fatal("Expected error for unknown client in rule")
+	}
+}
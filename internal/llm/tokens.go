@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// DefaultContextWindow is used for models not in the context window table
+const DefaultContextWindow = 128000
+
+// contextWindows maps model name prefixes to context window sizes in tokens.
+// Longer prefixes are listed before shorter ones they extend.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"gpt-5", 400000},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"deepseek", 64000},
+	{"qwen", 32768},
+}
+
+// ContextWindow returns the context window size in tokens for a model
+func ContextWindow(model string) int {
+	name := strings.ToLower(model)
+	// Strip vendor prefixes such as "openai/gpt-4o"
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	for _, w := range contextWindows {
+		if strings.HasPrefix(name, w.prefix) {
+			return w.tokens
+		}
+	}
+	return DefaultContextWindow
+}
+
+// charsPerToken returns the average characters per token for a model's tokenizer
+func charsPerToken(model string) float64 {
+	if strings.Contains(strings.ToLower(model), "claude") {
+		return 3.5
+	}
+	return 4
+}
+
+// messageOverhead approximates the tokens spent on role and framing per message
+const messageOverhead = 4
+
+// imageTokens approximates the tokens of one image; providers scale images
+// down to roughly a megapixel, which costs 1-2k tokens
+const imageTokens = 1600
+
+// EstimateTokens approximates the prompt tokens of messages for a model.
+// It is a character-based heuristic and errs on the high side; it is meant
+// for deciding when to compact, not for billing.
+func EstimateTokens(model string, messages []Message) int {
+	chars, images := 0, 0
+	for _, msg := range messages {
+		chars += len(msg.Content) + len(msg.Reason)
+		for _, part := range msg.Parts {
+			if part.Type == ContentPartImage {
+				images++
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			if tc.Function != nil {
+				chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+			}
+		}
+	}
+
+	return int(float64(chars)/charsPerToken(model)) + len(messages)*messageOverhead + images*imageTokens
+}
+
+// EstimateToolTokens approximates the prompt tokens taken by tool definitions
+func EstimateToolTokens(model string, tools []*ToolDefinition) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	data, err := json.Marshal(tools)
+	if err != nil {
+		return 0
+	}
+	return int(float64(len(data)) / charsPerToken(model))
+}
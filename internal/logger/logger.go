@@ -1,11 +1,13 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/glamour"
@@ -83,6 +85,27 @@ func (l *Logger) SetColorMode(enabled bool) {
 	}
 }
 
+// WithPrefix returns a logger writing to the same output with every line
+// prefixed, e.g. with the id of a sub-agent. Lines are written whole, so
+// loggers derived from the same parent can be used concurrently.
+func (l *Logger) WithPrefix(prefix string) *Logger {
+	if l.colorMode {
+		prefix = ColorMagenta + prefix + ColorReset
+	}
+	child := *l
+	child.writer = &prefixWriter{out: l.writer, prefix: prefix + " "}
+	return &child
+}
+
+// WithOutput returns a logger with the same level writing to w instead,
+// without colors, e.g. to capture the log of a background sub-agent
+func (l *Logger) WithOutput(w io.Writer) *Logger {
+	child := *l
+	child.writer = w
+	child.SetColorMode(false)
+	return &child
+}
+
 // SetShowTime enables or disables timestamp display
 func (l *Logger) SetShowTime(enabled bool) {
 	l.showTime = enabled
@@ -171,9 +194,34 @@ func (l *Logger) SessionStart(task string) {
 	l.printBanner(ColorCyan, "🚀 Session Started", task)
 }
 
+// TokenUsage summarises the token usage and cost of a session
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64 // USD
+	Unpriced         bool    // Some tokens were used on models without a known price
+}
+
+// String formats the usage for display, e.g. "Tokens: 1200 in / 300 out | Cost: $0.0042"
+func (u TokenUsage) String() string {
+	s := fmt.Sprintf("Tokens: %d in / %d out", u.PromptTokens, u.CompletionTokens)
+	switch {
+	case u.Cost > 0 && u.Unpriced:
+		s += fmt.Sprintf(" | Cost: >$%.4f", u.Cost)
+	case u.Cost > 0:
+		s += fmt.Sprintf(" | Cost: $%.4f", u.Cost)
+	case u.Unpriced:
+		s += " | Cost: unknown"
+	}
+	return s
+}
+
 // SessionEnd logs the completion of an agent session with statistics
-func (l *Logger) SessionEnd(duration time.Duration, toolCallCount int) {
+func (l *Logger) SessionEnd(duration time.Duration, toolCallCount int, usage TokenUsage) {
 	summary := fmt.Sprintf("Duration: %s | Tool Calls: %d", duration.Round(time.Millisecond), toolCallCount)
+	if usage.PromptTokens > 0 || usage.CompletionTokens > 0 {
+		summary += " | " + usage.String()
+	}
 	l.printBanner(ColorGreen, "✨ Session Completed", summary)
 }
 
@@ -306,3 +354,37 @@ func (l *Logger) formatJSON(jsonStr string) string {
 
 	return string(pretty)
 }
+
+// prefixWriter prefixes each line and forwards only complete lines, so that
+// output of concurrent writers does not interleave within a line
+type prefixWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte // Incomplete last line
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	end := bytes.LastIndexByte(w.buf, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	var lines []byte
+	for _, line := range bytes.SplitAfter(w.buf[:end+1], []byte("\n")) {
+		if len(line) > 0 {
+			lines = append(lines, w.prefix...)
+			lines = append(lines, line...)
+		}
+	}
+	w.buf = append(w.buf[:0], w.buf[end+1:]...)
+
+	if _, err := w.out.Write(lines); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
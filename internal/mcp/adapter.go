@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"finta/internal/llm"
 	"finta/internal/tool"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -117,6 +118,7 @@ func (a *MCPToolAdapter) Execute(ctx context.Context, params json.RawMessage) (*
 	return &tool.Result{
 		Success: true,
 		Output:  formatMCPContent(result.Content),
+		Parts:   mcpContentParts(result.Content),
 		Data: map[string]any{
 			"mcp_server": a.client.Name(),
 			"mcp_tool":   a.mcpTool.Name,
@@ -124,6 +126,32 @@ func (a *MCPToolAdapter) Execute(ctx context.Context, params json.RawMessage) (*
 	}, nil
 }
 
+// mcpContentParts converts MCP content to content parts so images reach
+// the model. It returns nil when the content holds no images.
+func mcpContentParts(content []mcp.Content) []llm.ContentPart {
+	hasImages := false
+	for _, item := range content {
+		if _, ok := item.(*mcp.ImageContent); ok {
+			hasImages = true
+			break
+		}
+	}
+	if !hasImages {
+		return nil
+	}
+
+	parts := make([]llm.ContentPart, 0, len(content))
+	for _, item := range content {
+		if image, ok := item.(*mcp.ImageContent); ok {
+			parts = append(parts, llm.ImagePart(image.MIMEType, image.Data))
+			continue
+		}
+		// Everything else keeps its text rendering
+		parts = append(parts, llm.TextPart(formatMCPContent([]mcp.Content{item})))
+	}
+	return parts
+}
+
 // formatMCPContent converts MCP content array to string
 func formatMCPContent(content []mcp.Content) string {
 	var parts []string
@@ -0,0 +1,401 @@
+package session
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"finta/internal/llm"
+)
+
+// ErrNotFound is returned when no session matches an id
+var ErrNotFound = errors.New("session not found")
+
+// RecordType identifies a line of a session file
+type RecordType string
+
+const (
+	// RecordSession is the first line of a file and holds the session metadata
+	RecordSession RecordType = "session"
+	// RecordMessage appends one message to the history
+	RecordMessage RecordType = "message"
+	// RecordReplace replaces the whole history, e.g. after compaction
+	RecordReplace RecordType = "replace"
+)
+
+// Record is one line of a session file
+type Record struct {
+	Type      RecordType    `json:"type"`
+	Timestamp time.Time     `json:"timestamp"`
+	Meta      *Meta         `json:"meta,omitempty"`
+	Message   *llm.Message  `json:"message,omitempty"`
+	Messages  []llm.Message `json:"messages,omitempty"`
+}
+
+// Meta describes a session
+type Meta struct {
+	ID        string    `json:"id"`
+	Created   time.Time `json:"created"`
+	Dir       string    `json:"dir"` // Working directory the session was started in
+	AgentType string    `json:"agent_type,omitempty"`
+	Model     string    `json:"model,omitempty"`
+}
+
+// Info summarises a saved session
+type Info struct {
+	Meta
+	Updated  time.Time
+	Messages int
+	Title    string // First line of the first user message
+}
+
+// Store keeps the sessions of one project as JSONL files in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store for the sessions in dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultStore returns the store for the project in the current directory,
+// under ~/.config/finta/projects/<project>/sessions
+func DefaultStore() (*Store, error) {
+	dir, err := ProjectDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(filepath.Join(dir, "sessions")), nil
+}
+
+// ProjectDir returns the directory holding the saved state of the project
+// in the current directory: ~/.config/finta/projects/<project>
+func ProjectDir() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "finta", "projects", ProjectKey(cwd)), nil
+}
+
+// ProjectKey turns a project path into a directory name
+func ProjectKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' {
+			return r
+		}
+		return '-'
+	}, path)
+}
+
+// Dir returns the directory holding the session files
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Create starts a new session. The file is written on the first Sync, so
+// sessions that never receive a message leave nothing behind.
+func (s *Store) Create(meta Meta) *Session {
+	meta.ID = newID()
+	meta.Created = time.Now()
+	if meta.Dir == "" {
+		meta.Dir, _ = os.Getwd()
+	}
+	return &Session{path: s.path(meta.ID), meta: meta}
+}
+
+// Open loads a session for resuming. The id may be any unique prefix.
+func (s *Store) Open(id string) (*Session, []llm.Message, error) {
+	id, err := s.Resolve(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, history, err := s.Load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Session{
+		path:    s.path(id),
+		meta:    info.Meta,
+		created: true,
+		synced:  append([]llm.Message(nil), history...),
+	}, history, nil
+}
+
+// Latest returns the id of the most recently updated session
+func (s *Store) Latest() (string, error) {
+	infos, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	if len(infos) == 0 {
+		return "", ErrNotFound
+	}
+	return infos[0].ID, nil
+}
+
+// Resolve expands a unique id prefix to a full session id
+func (s *Store) Resolve(prefix string) (string, error) {
+	if prefix == "" {
+		return "", ErrNotFound
+	}
+	if _, err := os.Stat(s.path(prefix)); err == nil {
+		return prefix, nil
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrNotFound, prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("session id %s is ambiguous (%d matches)", prefix, len(matches))
+	}
+}
+
+// List returns all sessions, most recently updated first
+func (s *Store) List() ([]*Info, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(ids))
+	for _, id := range ids {
+		info, _, err := s.Load(id)
+		if err != nil {
+			continue // Skip unreadable files rather than failing the listing
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Updated.After(infos[j].Updated)
+	})
+	return infos, nil
+}
+
+// Load reads a session and returns its metadata and history
+func (s *Store) Load(id string) (*Info, []llm.Message, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer f.Close()
+
+	info := &Info{}
+	var history []llm.Message
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024) // Lines hold whole tool outputs and images
+	for line := 1; scanner.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, nil, fmt.Errorf("session %s line %d: %w", id, line, err)
+		}
+
+		switch rec.Type {
+		case RecordSession:
+			if rec.Meta != nil {
+				info.Meta = *rec.Meta
+			}
+		case RecordMessage:
+			if rec.Message != nil {
+				history = append(history, *rec.Message)
+			}
+		case RecordReplace:
+			history = append([]llm.Message(nil), rec.Messages...)
+		}
+		info.Updated = rec.Timestamp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read session %s: %w", id, err)
+	}
+
+	if info.ID == "" {
+		info.ID = id
+	}
+	info.Messages = len(history)
+	info.Title = title(history)
+	return info, history, nil
+}
+
+// Delete removes a session. The id may be any unique prefix.
+func (s *Store) Delete(id string) error {
+	id, err := s.Resolve(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.path(id))
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".jsonl")
+}
+
+// ids returns the ids of all session files in the store
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".jsonl") {
+			ids = append(ids, strings.TrimSuffix(e.Name(), ".jsonl"))
+		}
+	}
+	return ids, nil
+}
+
+// Session is an open session that conversation history is saved to
+type Session struct {
+	path    string
+	meta    Meta
+	created bool          // The file exists
+	synced  []llm.Message // History as saved on disk
+}
+
+// ID returns the session id
+func (s *Session) ID() string {
+	return s.meta.ID
+}
+
+// Saved reports whether the session has been written to disk
+func (s *Session) Saved() bool {
+	return s.created
+}
+
+// Sync saves the current conversation history. Messages added since the
+// last sync are appended; if earlier history changed (compaction, rewind)
+// the whole history is rewritten as a replace record.
+func (s *Session) Sync(history []llm.Message) error {
+	now := time.Now()
+	var records []Record
+
+	if !s.created {
+		meta := s.meta
+		records = append(records, Record{Type: RecordSession, Timestamp: now, Meta: &meta})
+	}
+
+	if hasPrefix(history, s.synced) {
+		for i := len(s.synced); i < len(history); i++ {
+			msg := history[i]
+			records = append(records, Record{Type: RecordMessage, Timestamp: now, Message: &msg})
+		}
+	} else {
+		records = append(records, Record{Type: RecordReplace, Timestamp: now, Messages: history})
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.write(records); err != nil {
+		return err
+	}
+
+	s.created = true
+	s.synced = append(s.synced[:0:0], history...)
+	return nil
+}
+
+// write appends records to the session file
+func (s *Session) write(records []Record) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	var buf strings.Builder
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to encode session record: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open session file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(buf.String()); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+// hasPrefix reports whether history starts with the saved messages
+func hasPrefix(history, saved []llm.Message) bool {
+	if len(saved) > len(history) {
+		return false
+	}
+	for i := range saved {
+		a, b := history[i], saved[i]
+		if a.Role != b.Role || a.Content != b.Content || a.Reason != b.Reason ||
+			a.ToolCallID != b.ToolCallID || len(a.ToolCalls) != len(b.ToolCalls) ||
+			!a.Timestamp.Equal(b.Timestamp) {
+			return false
+		}
+	}
+	return true
+}
+
+// title returns the first line of the first user message
+func title(history []llm.Message) string {
+	for _, msg := range history {
+		if msg.Role == llm.RoleUser && msg.Content != "" {
+			line, _, _ := strings.Cut(strings.TrimSpace(msg.Content), "\n")
+			if runes := []rune(line); len(runes) > 60 {
+				line = string(runes[:57]) + "..."
+			}
+			return line
+		}
+	}
+	return ""
+}
+
+// newID returns a sortable, unique session id
+func newID() string {
+	var b [3]byte
+	rand.Read(b[:])
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
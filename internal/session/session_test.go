@@ -0,0 +1,92 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"finta/internal/llm"
+)
+
+func TestSyncAndResume(t *testing.T) {
+	store := NewStore(t.TempDir())
+	sess := store.Create(Meta{AgentType: "general", Model: "gpt-4o"})
+
+	if ids, _ := store.ids(); len(ids) != 0 {
+		t.Fatalf("Expected no file before the first sync, got %v", ids)
+	}
+
+	now := time.Now()
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "list files", Timestamp: now},
+		{Role: llm.RoleAssistant, Reason: "use glob", ToolCalls: []*llm.ToolCall{
+			{ID: "call_1", Type: "function", Function: &llm.FunctionCall{Name: "glob", Arguments: `{"pattern":"*"}`}},
+		}},
+		{Role: llm.RoleTool, ToolCallID: "call_1", Name: "glob", Content: "a.go", Timestamp: now},
+		{Role: llm.RoleAssistant, Content: "There is a.go"},
+	}
+	if err := sess.Sync(history[:2]); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := sess.Sync(history); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	resumed, loaded, err := store.Open(sess.ID()[:15])
+	if err != nil {
+		t.Fatalf("Open by prefix failed: %v", err)
+	}
+	if resumed.ID() != sess.ID() || len(loaded) != 4 {
+		t.Fatalf("Expected 4 messages of session %s, got %d of %s", sess.ID(), len(loaded), resumed.ID())
+	}
+	if loaded[1].Reason != "use glob" || loaded[1].ToolCalls[0].Function.Name != "glob" || loaded[2].ToolCallID != "call_1" {
+		t.Errorf("Tool calls, results and reasoning not preserved: %+v", loaded[1:3])
+	}
+
+	// A compacted history no longer extends what was saved and replaces it
+	compacted := []llm.Message{{Role: llm.RoleUser, Content: "summary"}, history[3]}
+	if err := resumed.Sync(compacted); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	info, loaded, err := store.Load(sess.ID())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Content != "summary" {
+		t.Errorf("Expected replaced history, got %+v", loaded)
+	}
+	if info.AgentType != "general" || info.Model != "gpt-4o" || info.Title != "summary" {
+		t.Errorf("Unexpected session info: %+v", info)
+	}
+}
+
+func TestListLatestAndDelete(t *testing.T) {
+	store := NewStore(t.TempDir())
+	if _, err := store.Latest(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for an empty store, got %v", err)
+	}
+
+	first := store.Create(Meta{})
+	first.Sync([]llm.Message{{Role: llm.RoleUser, Content: "first"}})
+	time.Sleep(10 * time.Millisecond)
+	second := store.Create(Meta{})
+	second.Sync([]llm.Message{{Role: llm.RoleUser, Content: "second\nmore detail"}})
+
+	infos, err := store.List()
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d (%v)", len(infos), err)
+	}
+	if infos[0].ID != second.ID() || infos[0].Title != "second" {
+		t.Errorf("Expected most recent session first with its title, got %+v", infos[0])
+	}
+	if latest, _ := store.Latest(); latest != second.ID() {
+		t.Errorf("Expected latest %s, got %s", second.ID(), latest)
+	}
+
+	if err := store.Delete(second.ID()); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, _, err := store.Open(second.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted session to be gone, got %v", err)
+	}
+}
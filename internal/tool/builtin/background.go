@@ -0,0 +1,322 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"finta/internal/agent"
+	"finta/internal/llm"
+	"finta/internal/tool"
+)
+
+// maxBackgroundLog bounds the log kept for each background sub-agent;
+// older output is dropped first
+const maxBackgroundLog = 256 * 1024
+
+// BackgroundStatus is the state of a background sub-agent
+type BackgroundStatus string
+
+const (
+	BackgroundRunning   BackgroundStatus = "running"
+	BackgroundCompleted BackgroundStatus = "completed"
+	BackgroundFailed    BackgroundStatus = "failed"
+	BackgroundCancelled BackgroundStatus = "cancelled"
+)
+
+// BackgroundTasks tracks the sub-agents started with run_in_background.
+// It is shared by the task tool and the tools that follow up on background
+// sub-agents, and as an agent.Inbox delivers each finished result to the
+// agent that started it.
+type BackgroundTasks struct {
+	mu    sync.Mutex
+	tasks map[string]*backgroundTask
+	order []string // Ids in start order
+}
+
+// backgroundTask is one sub-agent running in the background
+type backgroundTask struct {
+	id      string
+	params  taskParams
+	owner   agent.Agent // Agent the result is delivered to
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{} // Closed when the sub-agent finished
+	log     *logBuffer
+
+	// Guarded by BackgroundTasks.mu
+	status    BackgroundStatus
+	finished  time.Time
+	result    *subAgentResult
+	delivered bool // Result was reported to the owner
+}
+
+// NewBackgroundTasks creates an empty background task registry
+func NewBackgroundTasks() *BackgroundTasks {
+	return &BackgroundTasks{tasks: make(map[string]*backgroundTask)}
+}
+
+// add registers a started sub-agent
+func (b *BackgroundTasks) add(id string, p taskParams, owner agent.Agent, cancel context.CancelFunc) *backgroundTask {
+	task := &backgroundTask{
+		id:      id,
+		params:  p,
+		owner:   owner,
+		started: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		log:     &logBuffer{},
+		status:  BackgroundRunning,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tasks[id] = task
+	b.order = append(b.order, id)
+	return task
+}
+
+// finish records the result of a sub-agent. A cancelled agent returns its
+// partial output without an error, so cancellation is checked first.
+func (b *BackgroundTasks) finish(task *backgroundTask, r *subAgentResult, cancelled bool) {
+	b.mu.Lock()
+	task.result = r
+	task.finished = time.Now()
+	switch {
+	case cancelled, r.output != nil && r.output.StopReason == agent.StopInterrupted:
+		task.status = BackgroundCancelled
+	case r.err == nil:
+		task.status = BackgroundCompleted
+	default:
+		task.status = BackgroundFailed
+	}
+	b.mu.Unlock()
+
+	task.cancel()
+	close(task.done)
+}
+
+// get returns a task by id
+func (b *BackgroundTasks) get(id string) (*backgroundTask, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("no background sub-agent with id %q", id)
+	}
+	return task, nil
+}
+
+// list returns all tasks in start order
+func (b *BackgroundTasks) list() []*backgroundTask {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tasks := make([]*backgroundTask, len(b.order))
+	for i, id := range b.order {
+		tasks[i] = b.tasks[id]
+	}
+	return tasks
+}
+
+// Cancel stops a background sub-agent. It reports whether it was running.
+func (b *BackgroundTasks) Cancel(id string) (bool, error) {
+	task, err := b.get(id)
+	if err != nil {
+		return false, err
+	}
+	if task.state() != BackgroundRunning {
+		return false, nil
+	}
+	task.cancel()
+	<-task.done
+	return true, nil
+}
+
+// Close cancels all running background sub-agents and waits for them to
+// stop. It returns how many were running.
+func (b *BackgroundTasks) Close() int {
+	n := 0
+	for _, task := range b.list() {
+		select {
+		case <-task.done:
+		default:
+			n++
+			task.cancel()
+			<-task.done
+		}
+	}
+	return n
+}
+
+// cancelOwned cancels the running background sub-agents started by owner
+// and waits for them to stop, returning how many were running. It is
+// called when a sub-agent's run ends, since its results could no longer be
+// delivered.
+func (b *BackgroundTasks) cancelOwned(owner agent.Agent) int {
+	n := 0
+	for _, task := range b.list() {
+		if task.owner != owner {
+			continue
+		}
+		select {
+		case <-task.done:
+		default:
+			n++
+			task.cancel()
+			<-task.done
+		}
+	}
+	return n
+}
+
+// Collect returns the results of the finished sub-agents started by the
+// agent running under ctx that were not reported yet, as user messages
+func (b *BackgroundTasks) Collect(ctx context.Context) []llm.Message {
+	owner := agent.GetAgentFromContext(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []llm.Message
+	for _, id := range b.order {
+		task := b.tasks[id]
+		if task.status == BackgroundRunning || task.delivered || task.owner != owner {
+			continue
+		}
+		messages = append(messages, llm.Message{
+			Role:      llm.RoleUser,
+			Content:   task.reportLocked(),
+			Timestamp: time.Now(),
+		})
+	}
+	return messages
+}
+
+// startBackground creates the sub-agents of tasks and starts them in the
+// background, at most maxConcurrency at a time, returning their ids. The
+// sub-agents outlive the tool call: they stop when finished or cancelled.
+func (t *TaskTool) startBackground(ctx context.Context, tasks []taskParams) *tool.Result {
+	type started struct {
+		subAgent agent.Agent
+		id       string
+	}
+	agents := make([]started, len(tasks))
+	for i := range tasks {
+		if msg := tasks[i].validate(); msg != "" {
+			if len(tasks) > 1 {
+				msg = fmt.Sprintf("tasks[%d]: %s", i, msg)
+			}
+			return &tool.Result{Success: false, Error: msg}
+		}
+		subAgent, id, err := t.newSubAgent(tasks[i])
+		if err != nil {
+			return &tool.Result{Success: false, Error: err.Error()}
+		}
+		agents[i] = started{subAgent, id}
+	}
+
+	owner := agent.GetAgentFromContext(ctx)
+	log := parentLogger(ctx)
+	budget := agent.SubAgentBudget(ctx, len(tasks))
+	sem := make(chan struct{}, t.maxConcurrency)
+
+	var out strings.Builder
+	ids := make([]string, len(tasks))
+	for i, p := range tasks {
+		id := agents[i].id
+		ids[i] = id
+
+		bgCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		task := t.background.add(id, p, owner, cancel)
+		go func(subAgent agent.Agent) {
+			var r *subAgentResult
+			select {
+			case sem <- struct{}{}:
+				// The sub-agent's log is kept for task_output instead of
+				// interleaving with the caller's output
+				r = t.runAgent(bgCtx, subAgent, id, p, budget, log, log.WithOutput(task.log))
+				<-sem
+			case <-bgCtx.Done():
+				r = &subAgentResult{id: id, params: p, err: bgCtx.Err()}
+			}
+			t.background.finish(task, r, bgCtx.Err() != nil)
+		}(agents[i].subAgent)
+
+		fmt.Fprintf(&out, "- %s: %s\n", id, p.Description)
+	}
+
+	return &tool.Result{
+		Success: true,
+		Output: fmt.Sprintf("Started %d sub-agent(s) in the background:\n%s\n"+
+			"Results are delivered automatically when they finish. Meanwhile use task_status, task_output, task_wait or task_cancel with these ids.",
+			len(tasks), out.String()),
+		Data: map[string]any{"ids": ids, "background": true},
+	}
+}
+
+// state returns the status of the task
+func (t *backgroundTask) state() BackgroundStatus {
+	select {
+	case <-t.done:
+	default:
+		return BackgroundRunning
+	}
+	return t.status // Written before done was closed
+}
+
+// summaryLocked describes the task in one line. The caller holds
+// BackgroundTasks.mu.
+func (t *backgroundTask) summaryLocked() string {
+	elapsed := time.Since(t.started)
+	if t.status != BackgroundRunning {
+		elapsed = t.finished.Sub(t.started)
+	}
+	return fmt.Sprintf("%s [%s] %s (%s)", t.id, t.status, t.params.Description, elapsed.Round(time.Second))
+}
+
+// reportLocked returns the result of a finished task, marking it as
+// reported. The caller holds BackgroundTasks.mu.
+func (t *backgroundTask) reportLocked() string {
+	t.delivered = true
+
+	header := fmt.Sprintf("[Background sub-agent %s %s: %s]", t.id, t.status, t.params.Description)
+	if t.result.err != nil {
+		return fmt.Sprintf("%s\n\n%v", header, t.result.err)
+	}
+	return fmt.Sprintf("%s\n\n%s", header, t.result.text())
+}
+
+// logBuffer keeps the most recent log output of a background sub-agent
+type logBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	dropped int // Bytes dropped from the start
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - maxBackgroundLog; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.dropped += over
+	}
+	return len(p), nil
+}
+
+// tail returns up to the last n bytes of the log, and whether earlier
+// output was left out
+func (b *logBuffer) tail(n int) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n <= 0 || n >= len(b.buf) {
+		return string(b.buf), b.dropped > 0
+	}
+	return string(b.buf[len(b.buf)-n:]), true
+}
@@ -0,0 +1,182 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"finta/internal/agent"
+	"finta/internal/llm"
+	"finta/internal/tool"
+)
+
+func TestTaskTool_BackgroundResultDeliveredToOwner(t *testing.T) {
+	logged := make(chan struct{})
+	release := make(chan struct{})
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		input.Logger.Info("working on %s", input.Task)
+		close(logged)
+		<-release
+		return &agent.Output{Result: "found 3 handlers"}, nil
+	}})
+	bg := task.Background()
+
+	owner := &funcAgent{}
+	ctx, cancel := context.WithCancel(agent.WithAgent(context.Background(), owner))
+	result, err := task.Execute(ctx, json.RawMessage(`{"agent_type": "explore", "task": "find handlers", "description": "Find handlers", "run_in_background": true}`))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+	id := result.Data["ids"].([]string)[0]
+
+	// The sub-agent outlives the tool call
+	cancel()
+	<-logged
+
+	status, _ := NewTaskStatusTool(bg).Execute(context.Background(), json.RawMessage(`{}`))
+	if !strings.Contains(status.Output, id+" [running] Find handlers") {
+		t.Errorf("Expected running sub-agent in status, got:\n%s", status.Output)
+	}
+	output, _ := NewTaskOutputTool(bg).Execute(context.Background(), json.RawMessage(`{"id": "`+id+`"}`))
+	if !strings.Contains(output.Output, "working on find handlers") {
+		t.Errorf("Expected partial log in output, got:\n%s", output.Output)
+	}
+
+	close(release)
+	<-bg.tasks[id].done
+
+	if msgs := bg.Collect(agent.WithAgent(context.Background(), &funcAgent{})); len(msgs) != 0 {
+		t.Errorf("Expected no results for another agent, got %d", len(msgs))
+	}
+	msgs := bg.Collect(ctx)
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Content, "completed: Find handlers") || !strings.Contains(msgs[0].Content, "found 3 handlers") {
+		t.Fatalf("Expected the result delivered to its owner, got %+v", msgs)
+	}
+	if msgs := bg.Collect(ctx); len(msgs) != 0 {
+		t.Errorf("Expected the result delivered once, got %d more", len(msgs))
+	}
+}
+
+func TestTaskTool_BackgroundWaitAndCancel(t *testing.T) {
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		if input.Task == "slow" {
+			<-ctx.Done()
+			return interrupted()
+		}
+		return &agent.Output{Result: "quick result"}, nil
+	}})
+	bg := task.Background()
+
+	params := `{"run_in_background": true, "tasks": [
+		{"agent_type": "slow", "task": "slow", "description": "Slow task"},
+		{"agent_type": "quick", "task": "quick", "description": "Quick task"}
+	]}`
+	result, err := task.Execute(context.Background(), json.RawMessage(params))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+	ids := result.Data["ids"].([]string)
+
+	waited, _ := NewTaskWaitTool(bg).Execute(context.Background(), json.RawMessage(`{"ids": ["`+ids[1]+`"]}`))
+	if waited.Data["finished"] != 1 || !strings.Contains(waited.Output, "quick result") {
+		t.Errorf("Expected the quick result, got %+v\n%s", waited.Data, waited.Output)
+	}
+
+	cancelled, _ := NewTaskCancelTool(task).Execute(context.Background(), json.RawMessage(`{"id": "`+ids[0]+`"}`))
+	if !cancelled.Success {
+		t.Fatalf("Cancel failed: %s", cancelled.Error)
+	}
+	status, _ := NewTaskStatusTool(bg).Execute(context.Background(), json.RawMessage(`{"id": "`+ids[0]+`"}`))
+	if !strings.Contains(status.Output, "[cancelled]") {
+		t.Errorf("Expected cancelled status, got:\n%s", status.Output)
+	}
+
+	// Both outcomes were reported by the tools already
+	if msgs := bg.Collect(context.Background()); len(msgs) != 0 {
+		t.Errorf("Expected nothing left to deliver, got %+v", msgs)
+	}
+}
+
+func TestTaskTool_SubAgentRunEndCancelsItsBackgroundTasks(t *testing.T) {
+	var task *TaskTool
+	var nestedID string
+	task = NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		if input.Task == "slow" {
+			<-ctx.Done()
+			return interrupted()
+		}
+		// The outer sub-agent starts background work and finishes first
+		result, err := task.Execute(ctx, json.RawMessage(`{"agent_type": "explore", "task": "slow", "description": "Slow task", "run_in_background": true}`))
+		if err != nil || !result.Success {
+			return nil, errors.New("starting background work failed")
+		}
+		nestedID = result.Data["ids"].([]string)[0]
+		return &agent.Output{Result: "done"}, nil
+	}})
+
+	result, err := task.Execute(context.Background(), json.RawMessage(`{"agent_type": "general", "task": "outer", "description": "Outer task"}`))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+
+	nested, err := task.Background().get(nestedID)
+	if err != nil {
+		t.Fatalf("Expected the nested background sub-agent registered: %v", err)
+	}
+	if state := nested.state(); state != BackgroundCancelled {
+		t.Errorf("Expected the nested sub-agent cancelled with its owner's run, got %s", state)
+	}
+}
+
+// blockingClient blocks every call until its context is cancelled
+type blockingClient struct {
+	started chan struct{}
+}
+
+func (c *blockingClient) Chat(ctx context.Context, req *llm.ChatRequest) (*llm.ChatResponse, error) {
+	c.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *blockingClient) ChatStream(ctx context.Context, req *llm.ChatRequest) (llm.StreamReader, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *blockingClient) Provider() string { return "blocking" }
+func (c *blockingClient) Model() string    { return "blocking-1" }
+
+// baseAgentFactory creates real agents over one client
+type baseAgentFactory struct {
+	client llm.Client
+}
+
+func (f *baseAgentFactory) CreateAgent(agentType agent.AgentType) (agent.Agent, error) {
+	return agent.NewBaseAgent(string(agentType), "", f.client, tool.NewRegistry(), &agent.Config{MaxTurns: 5}), nil
+}
+
+func (f *baseAgentFactory) AgentTypes() []agent.AgentTypeInfo { return nil }
+
+func TestTaskTool_CancelledBaseAgentIsReportedCancelled(t *testing.T) {
+	client := &blockingClient{started: make(chan struct{}, 1)}
+	task := NewTaskTool(&baseAgentFactory{client: client})
+
+	result, err := task.Execute(context.Background(), json.RawMessage(`{"agent_type": "explore", "task": "find handlers", "description": "Find handlers", "run_in_background": true}`))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+	id := result.Data["ids"].([]string)[0]
+
+	// Cancel while the LLM call is in flight
+	<-client.started
+	cancelled, _ := NewTaskCancelTool(task).Execute(context.Background(), json.RawMessage(`{"id": "`+id+`"}`))
+	if !cancelled.Success {
+		t.Fatalf("Cancel failed: %s", cancelled.Error)
+	}
+	status, _ := NewTaskStatusTool(task.Background()).Execute(context.Background(), json.RawMessage(`{"id": "`+id+`"}`))
+	if !strings.Contains(status.Output, id+" [cancelled]") {
+		t.Errorf("Expected the interrupted agent reported cancelled, got:\n%s", status.Output)
+	}
+}
@@ -0,0 +1,391 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"finta/internal/tool"
+)
+
+const (
+	defaultOutputBytes = 4000
+	defaultWaitTimeout = 60 * time.Second
+	maxWaitTimeout     = 10 * time.Minute
+)
+
+// TaskStatusTool lists background sub-agents and their status
+type TaskStatusTool struct {
+	background *BackgroundTasks
+}
+
+// NewTaskStatusTool creates a new task_status tool
+func NewTaskStatusTool(background *BackgroundTasks) *TaskStatusTool {
+	return &TaskStatusTool{background: background}
+}
+
+func (t *TaskStatusTool) Name() string {
+	return "task_status"
+}
+
+func (t *TaskStatusTool) Description() string {
+	return "Show the status of sub-agents started with run_in_background"
+}
+
+func (t *TaskStatusTool) BestPractices() string {
+	return ""
+}
+
+func (t *TaskStatusTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Id of a background sub-agent (optional, defaults to all)",
+			},
+		},
+	}
+}
+
+func (t *TaskStatusTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("invalid parameters: %v", err),
+		}, nil
+	}
+
+	tasks := t.background.list()
+	if p.ID != "" {
+		task, err := t.background.get(p.ID)
+		if err != nil {
+			return &tool.Result{Success: false, Error: err.Error()}, nil
+		}
+		tasks = []*backgroundTask{task}
+	}
+	if len(tasks) == 0 {
+		return &tool.Result{
+			Success: true,
+			Output:  "No background sub-agents",
+			Data:    map[string]any{"count": 0},
+		}, nil
+	}
+
+	t.background.mu.Lock()
+	defer t.background.mu.Unlock()
+
+	var out strings.Builder
+	running := 0
+	for _, task := range tasks {
+		if task.status == BackgroundRunning {
+			running++
+		}
+		out.WriteString(task.summaryLocked() + "\n")
+	}
+
+	return &tool.Result{
+		Success: true,
+		Output:  strings.TrimRight(out.String(), "\n"),
+		Data:    map[string]any{"count": len(tasks), "running": running},
+	}, nil
+}
+
+// TaskOutputTool shows the output of a background sub-agent so far
+type TaskOutputTool struct {
+	background *BackgroundTasks
+}
+
+// NewTaskOutputTool creates a new task_output tool
+func NewTaskOutputTool(background *BackgroundTasks) *TaskOutputTool {
+	return &TaskOutputTool{background: background}
+}
+
+func (t *TaskOutputTool) Name() string {
+	return "task_output"
+}
+
+func (t *TaskOutputTool) Description() string {
+	return "Read the log of a background sub-agent so far, and its result once finished"
+}
+
+func (t *TaskOutputTool) BestPractices() string {
+	return ""
+}
+
+func (t *TaskOutputTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Id of the background sub-agent",
+			},
+			"max_bytes": map[string]any{
+				"type":        "number",
+				"description": fmt.Sprintf("Maximum bytes of the most recent log to return (optional, default %d)", defaultOutputBytes),
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *TaskOutputTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	var p struct {
+		ID       string `json:"id"`
+		MaxBytes int    `json:"max_bytes"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("invalid parameters: %v", err),
+		}, nil
+	}
+	if p.MaxBytes <= 0 {
+		p.MaxBytes = defaultOutputBytes
+	}
+
+	task, err := t.background.get(p.ID)
+	if err != nil {
+		return &tool.Result{Success: false, Error: err.Error()}, nil
+	}
+
+	log, truncated := task.log.tail(p.MaxBytes)
+
+	t.background.mu.Lock()
+	defer t.background.mu.Unlock()
+
+	var out strings.Builder
+	out.WriteString(task.summaryLocked() + "\n")
+	if truncated {
+		out.WriteString("\n--- log (most recent output) ---\n")
+	} else {
+		out.WriteString("\n--- log ---\n")
+	}
+	if log == "" {
+		log = "(no output yet)\n"
+	}
+	out.WriteString(log)
+	if task.status != BackgroundRunning {
+		out.WriteString("\n--- result ---\n")
+		out.WriteString(task.reportLocked())
+	}
+
+	return &tool.Result{
+		Success: true,
+		Output:  strings.TrimRight(out.String(), "\n"),
+		Data:    map[string]any{"id": task.id, "status": string(task.status), "truncated": truncated},
+	}, nil
+}
+
+// TaskWaitTool waits for background sub-agents to finish
+type TaskWaitTool struct {
+	background *BackgroundTasks
+}
+
+// NewTaskWaitTool creates a new task_wait tool
+func NewTaskWaitTool(background *BackgroundTasks) *TaskWaitTool {
+	return &TaskWaitTool{background: background}
+}
+
+func (t *TaskWaitTool) Name() string {
+	return "task_wait"
+}
+
+func (t *TaskWaitTool) Description() string {
+	return "Wait for background sub-agents to finish and return their results"
+}
+
+func (t *TaskWaitTool) BestPractices() string {
+	return ""
+}
+
+func (t *TaskWaitTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"ids": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Ids of the background sub-agents to wait for (optional, defaults to all running)",
+			},
+			"timeout_seconds": map[string]any{
+				"type":        "number",
+				"description": fmt.Sprintf("Maximum time to wait (optional, default %d, max %d)", int(defaultWaitTimeout.Seconds()), int(maxWaitTimeout.Seconds())),
+			},
+		},
+	}
+}
+
+func (t *TaskWaitTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	var p struct {
+		IDs            []string `json:"ids"`
+		TimeoutSeconds float64  `json:"timeout_seconds"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("invalid parameters: %v", err),
+		}, nil
+	}
+
+	timeout := defaultWaitTimeout
+	if p.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(p.TimeoutSeconds*float64(time.Second)), maxWaitTimeout)
+	}
+
+	var tasks []*backgroundTask
+	if len(p.IDs) > 0 {
+		for _, id := range p.IDs {
+			task, err := t.background.get(id)
+			if err != nil {
+				return &tool.Result{Success: false, Error: err.Error()}, nil
+			}
+			tasks = append(tasks, task)
+		}
+	} else {
+		for _, task := range t.background.list() {
+			if task.state() == BackgroundRunning {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	if len(tasks) == 0 {
+		return &tool.Result{
+			Success: true,
+			Output:  "No background sub-agents are running",
+			Data:    map[string]any{"finished": 0, "running": 0},
+		}, nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+wait:
+	for _, task := range tasks {
+		select {
+		case <-task.done:
+		case <-timer.C:
+			break wait
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	t.background.mu.Lock()
+	defer t.background.mu.Unlock()
+
+	var out, pending strings.Builder
+	finished := 0
+	for _, task := range tasks {
+		if task.status == BackgroundRunning {
+			pending.WriteString(task.summaryLocked() + "\n")
+			continue
+		}
+		finished++
+		out.WriteString(task.reportLocked() + "\n\n")
+	}
+	if pending.Len() > 0 {
+		fmt.Fprintf(&out, "Still running after %s:\n%s", timeout, pending.String())
+	}
+
+	return &tool.Result{
+		Success: true,
+		Output:  strings.TrimRight(out.String(), "\n"),
+		Data:    map[string]any{"finished": finished, "running": len(tasks) - finished},
+	}, nil
+}
+
+// TaskCancelTool stops a background sub-agent, or one sub-agent of a batch
+// that is still running
+type TaskCancelTool struct {
+	task       *TaskTool
+	background *BackgroundTasks
+}
+
+// NewTaskCancelTool creates a new task_cancel tool
+func NewTaskCancelTool(task *TaskTool) *TaskCancelTool {
+	return &TaskCancelTool{task: task, background: task.Background()}
+}
+
+func (t *TaskCancelTool) Name() string {
+	return "task_cancel"
+}
+
+func (t *TaskCancelTool) Description() string {
+	return "Cancel a background sub-agent, or one running sub-agent of a batch"
+}
+
+func (t *TaskCancelTool) BestPractices() string {
+	return ""
+}
+
+func (t *TaskCancelTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Id of the sub-agent to cancel",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *TaskCancelTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("invalid parameters: %v", err),
+		}, nil
+	}
+
+	if _, err := t.background.get(p.ID); err != nil {
+		// Members of a batch run by a background sub-agent are cancelled on
+		// their own; the batch reports them as failed (interrupted)
+		if t.task.Cancel(p.ID) {
+			return &tool.Result{
+				Success: true,
+				Output:  fmt.Sprintf("Cancelled sub-agent %s", p.ID),
+				Data:    map[string]any{"id": p.ID},
+			}, nil
+		}
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("no running sub-agent with id %q", p.ID),
+		}, nil
+	}
+
+	cancelled, err := t.background.Cancel(p.ID)
+	if err != nil {
+		return &tool.Result{Success: false, Error: err.Error()}, nil
+	}
+	if !cancelled {
+		task, _ := t.background.get(p.ID)
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("background sub-agent %s already %s", p.ID, task.state()),
+		}, nil
+	}
+
+	// The cancellation was reported here, so it is not delivered again
+	t.background.mu.Lock()
+	task := t.background.tasks[p.ID]
+	task.delivered = true
+	t.background.mu.Unlock()
+
+	return &tool.Result{
+		Success: true,
+		Output:  fmt.Sprintf("Cancelled background sub-agent %s", p.ID),
+		Data:    map[string]any{"id": p.ID},
+	}, nil
+}
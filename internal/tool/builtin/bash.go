@@ -88,17 +88,34 @@ func (t *BashTool) Execute(ctx context.Context, params json.RawMessage) (*tool.R
 		timeout = p.Timeout
 	}
 
+	// The caller's deadline, e.g. the run's time budget, may come first
+	deadline, ok := ctx.Deadline()
+	budgeted := ok && time.Until(deadline) < time.Duration(timeout)*time.Millisecond
+
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "bash", "-c", p.Command)
+	setProcessGroup(cmd)
+	// Don't wait for output of processes that escaped the group
+	cmd.WaitDelay = time.Second
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
+		msg := err.Error()
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			msg = fmt.Sprintf("command timed out after %dms", timeout)
+			if budgeted {
+				msg = "command stopped: the time budget ran out"
+			}
+		case context.Canceled:
+			msg = "command interrupted"
+		}
 		return &tool.Result{
 			Success: false,
 			Output:  string(output),
-			Error:   err.Error(),
+			Error:   msg,
 		}, nil
 	}
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBashTool_SuccessWithOutput(t *testing.T) {
@@ -142,3 +143,47 @@ func TestBashTool_Timeout(t *testing.T) {
 		t.Error("Expected timeout error message")
 	}
 }
+
+func TestBashTool_CancelKillsProcessGroup(t *testing.T) {
+	tool := NewBashTool()
+
+	// The pipeline's sleep keeps the output open unless the group is killed
+	params, _ := json.Marshal(map[string]any{
+		"command": "sleep 30 | cat",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := tool.Execute(ctx, params)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("Expected the command to stop promptly, took %s", elapsed)
+	}
+	if result.Success || result.Error != "command interrupted" {
+		t.Errorf("Expected an interrupted command, got %+v", result)
+	}
+}
+
+func TestBashTool_DeadlineReportsTimeBudget(t *testing.T) {
+	tool := NewBashTool()
+
+	params, _ := json.Marshal(map[string]any{
+		"command": "sleep 10",
+		"timeout": 60000,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := tool.Execute(ctx, params)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Success || !strings.Contains(result.Error, "time budget") {
+		t.Errorf("Expected the time budget named as the cause, got %+v", result)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package builtin
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup runs the command in its own process group and makes
+// cancellation kill the whole group, so that commands started by the shell
+// (pipelines, background jobs) don't outlive it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
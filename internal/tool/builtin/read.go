@@ -5,16 +5,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"finta/internal/llm"
 	"finta/internal/tool"
 )
 
 const (
-	maxFilesPerRead = 8 // Maximum number of files to read in one call
+	maxFilesPerRead = 8               // Maximum number of files to read in one call
+	maxImageSize    = 5 * 1024 * 1024 // Maximum image size sent to the model
 )
 
+// imageTypes maps image file extensions to MIME types
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
 // FileReadRequest represents a request to read a single file
 type FileReadRequest struct {
 	FilePath string `json:"file_path"`
@@ -58,6 +71,7 @@ func (t *ReadTool) Description() string {
 	return `Read contents of one or more files (max 8 files per call).
 
 Supports reading entire files or specific line ranges.
+Images (png, jpg, gif, webp) are returned to the model as images.
 
 Examples:
 - Read entire file: {"files": [{"file_path": "config.yaml"}]}
@@ -147,9 +161,26 @@ func (t *ReadTool) Execute(ctx context.Context, params json.RawMessage) (*tool.R
 
 	// Read all files
 	var results []string
+	var images []llm.ContentPart
 	totalLines := 0
 
 	for i, req := range p.Files {
+		if mimeType, ok := imageTypes[strings.ToLower(filepath.Ext(req.FilePath))]; ok {
+			image, err := t.readImage(req.FilePath, mimeType)
+			if err != nil {
+				return &tool.Result{
+					Success: false,
+					Error:   fmt.Sprintf("file #%d (%s): %v", i+1, req.FilePath, err),
+				}, nil
+			}
+			images = append(images, image)
+			results = append(results, fmt.Sprintf("[Image %d: %s (%s, %d bytes)]", len(images), req.FilePath, mimeType, len(image.Data)))
+			if i < len(p.Files)-1 {
+				results = append(results, "")
+			}
+			continue
+		}
+
 		content, lines, err := t.readFile(req)
 		if err != nil {
 			return &tool.Result{
@@ -187,14 +218,45 @@ func (t *ReadTool) Execute(ctx context.Context, params json.RawMessage) (*tool.R
 
 	output := strings.Join(results, "\n")
 
-	return &tool.Result{
+	result := &tool.Result{
 		Success: true,
 		Output:  output,
 		Data: map[string]any{
 			"file_count":  len(p.Files),
 			"total_lines": totalLines,
 		},
-	}, nil
+	}
+
+	// Images go to the model as content parts after the text output
+	if len(images) > 0 {
+		result.Parts = append([]llm.ContentPart{llm.TextPart(output)}, images...)
+		result.Data["image_count"] = len(images)
+	}
+
+	return result, nil
+}
+
+// readImage reads an image file as a content part
+func (t *ReadTool) readImage(path, mimeType string) (llm.ContentPart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return llm.ContentPart{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	if info.Size() > maxImageSize {
+		return llm.ContentPart{}, fmt.Errorf("image too large (%d bytes, max %d)", info.Size(), maxImageSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return llm.ContentPart{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Trust the content over the extension when they disagree
+	if detected := http.DetectContentType(data); strings.HasPrefix(detected, "image/") {
+		mimeType = detected
+	}
+
+	return llm.ImagePart(mimeType, data), nil
 }
 
 // readFile reads a single file with optional line range
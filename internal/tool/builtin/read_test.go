@@ -387,3 +387,39 @@ func TestReadTool_Parameters(t *testing.T) {
 		t.Error("Expected 'files' to be required")
 	}
 }
+
+func TestReadTool_ImageFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Minimal PNG signature is enough for content sniffing
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	imagePath := filepath.Join(tmpDir, "screenshot.png")
+	textPath := filepath.Join(tmpDir, "notes.txt")
+	os.WriteFile(imagePath, png, 0644)
+	os.WriteFile(textPath, []byte("see image"), 0644)
+
+	tool := NewReadTool()
+	params := `{"files": [{"file_path": "` + textPath + `"}, {"file_path": "` + imagePath + `"}]}`
+
+	result, err := tool.Execute(context.Background(), []byte(params))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+
+	if !strings.Contains(result.Output, "see image") || !strings.Contains(result.Output, "[Image 1: "+imagePath) {
+		t.Errorf("Expected text output with image placeholder, got %q", result.Output)
+	}
+
+	if len(result.Parts) != 2 {
+		t.Fatalf("Expected text part and image part, got %d parts", len(result.Parts))
+	}
+	if result.Parts[0].Text != result.Output {
+		t.Errorf("Expected first part to carry the text output")
+	}
+	if result.Parts[1].MIMEType != "image/png" || string(result.Parts[1].Data) != string(png) {
+		t.Errorf("Unexpected image part: %s, %d bytes", result.Parts[1].MIMEType, len(result.Parts[1].Data))
+	}
+}
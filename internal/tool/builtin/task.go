@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"finta/internal/agent"
+	"finta/internal/llm"
 	"finta/internal/logger"
 	"finta/internal/tool"
 )
@@ -13,20 +17,66 @@ import (
 // MaxNestingDepth is the maximum allowed depth for sub-agent calls
 const MaxNestingDepth = 3
 
+// DefaultMaxConcurrency is the default number of sub-agents of a batch
+// that run at the same time
+const DefaultMaxConcurrency = 4
+
 // TaskTool launches specialized sub-agents for specific tasks.
 //
 // Note: While 'general' agent type is supported, spawning general agents
 // as sub-agents is discouraged as it may lead to overly complex nesting.
 // Prefer using specialized agents (explore, plan, execute) for focused tasks.
 type TaskTool struct {
-	factory agent.Factory
+	factory        agent.Factory
+	maxConcurrency int
+
+	nextID     atomic.Int64
+	mu         sync.Mutex
+	running    map[string]context.CancelFunc // Cancel functions of running sub-agents by id
+	background *BackgroundTasks
 }
 
 // NewTaskTool creates a new Task tool
 func NewTaskTool(factory agent.Factory) *TaskTool {
 	return &TaskTool{
-		factory: factory,
+		factory:        factory,
+		maxConcurrency: DefaultMaxConcurrency,
+		running:        make(map[string]context.CancelFunc),
+		background:     NewBackgroundTasks(),
+	}
+}
+
+// Background returns the registry of sub-agents started with
+// run_in_background, for the tools that follow up on them
+func (t *TaskTool) Background() *BackgroundTasks {
+	return t.background
+}
+
+// SetMaxConcurrency sets how many sub-agents of a batch run at the same time
+func (t *TaskTool) SetMaxConcurrency(n int) {
+	if n > 0 {
+		t.maxConcurrency = n
+	}
+}
+
+// Cancel stops a running sub-agent by id without affecting the others: a
+// background sub-agent or a member of a batch. The calling agent waits for
+// its batch to finish, so the REPL's /cancel uses this with the ids logged
+// as the sub-agents launch. It reports whether the sub-agent was running.
+func (t *TaskTool) Cancel(id string) bool {
+	if _, err := t.background.get(id); err == nil {
+		cancelled, _ := t.background.Cancel(id)
+		return cancelled
+	}
+
+	t.mu.Lock()
+	cancel, ok := t.running[id]
+	t.mu.Unlock()
+
+	if ok {
+		cancel()
 	}
+	return ok
 }
 
 func (t *TaskTool) Name() string {
@@ -41,6 +91,7 @@ func (t *TaskTool) BestPractices() string {
    - plan: For creating implementation plans, breaking down work
    - execute: For implementing changes, writing code
    - general: Use sparingly as sub-agent (prefer specialized types)
+   - Custom types defined by the project: see the agent_type descriptions
 
 2. **Provide clear, specific task descriptions** - Be precise about what the sub-agent should do
    - Good: "Find all authentication-related files in internal/"
@@ -62,45 +113,167 @@ func (t *TaskTool) BestPractices() string {
 
 6. **Don't spawn sub-agents for simple tasks** - Direct tool use is more efficient
    - Bad: Spawning sub-agent just to read one file
-   - Good: Use read tool directly`
+   - Good: Use read tool directly
+
+7. **Batch independent sub-tasks** - Pass several tasks in "tasks" to run them concurrently
+   - Good: Exploring three unrelated packages at once
+   - Bad: Batching tasks where one needs another's result
+
+8. **Run long sub-tasks in the background** - Set run_in_background to keep working meanwhile
+   - The call returns sub-agent ids at once; results are delivered automatically when finished
+   - Use task_status, task_output, task_wait and task_cancel to follow up
+   - task_cancel also stops one sub-agent of a batch run by a background sub-agent (ids appear in its task_output) while the others go on
+   - Don't start background work you then immediately wait for`
 }
 
 func (t *TaskTool) Description() string {
-	return "Launch a specialized sub-agent to handle a specific task"
+	return "Launch a specialized sub-agent to handle a specific task, or several sub-agents concurrently"
 }
 
 func (t *TaskTool) Parameters() map[string]any {
-	return map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"agent_type": map[string]any{
-				"type":        "string",
-				"description": "Type of agent to spawn (general, explore, plan, execute)",
-				"enum":        []string{"general", "explore", "plan", "execute"},
-			},
-			"task": map[string]any{
-				"type":        "string",
-				"description": "Task description for the sub-agent",
-			},
-			"description": map[string]any{
-				"type":        "string",
-				"description": "Short description of what this sub-agent will do (3-5 words)",
-			},
-			"max_turns": map[string]any{
-				"type":        "number",
-				"description": "Maximum turns for sub-agent (optional, defaults to agent type default)",
-			},
+	// Custom agent types show up in the enum as soon as they are registered
+	var names []string
+	description := "Type of agent to spawn:"
+	for _, info := range t.factory.AgentTypes() {
+		names = append(names, string(info.Type))
+		description += fmt.Sprintf("\n- %s", info.Type)
+		if info.Description != "" {
+			description += ": " + info.Description
+		}
+	}
+
+	taskProperties := map[string]any{
+		"agent_type": map[string]any{
+			"type":        "string",
+			"description": description,
+			"enum":        names,
+		},
+		"task": map[string]any{
+			"type":        "string",
+			"description": "Task description for the sub-agent",
+		},
+		"description": map[string]any{
+			"type":        "string",
+			"description": "Short description of what this sub-agent will do (3-5 words)",
 		},
-		"required": []string{"agent_type", "task", "description"},
+		"max_turns": map[string]any{
+			"type":        "number",
+			"description": "Maximum turns for sub-agent (optional, defaults to agent type default)",
+		},
+		"output_schema": map[string]any{
+			"type":        "object",
+			"description": "JSON schema the sub-agent's final answer must conform to (optional). The validated JSON is returned as the result.",
+		},
+	}
+
+	properties := make(map[string]any, len(taskProperties)+1)
+	for name, schema := range taskProperties {
+		properties[name] = schema
+	}
+	properties["tasks"] = map[string]any{
+		"type":        "array",
+		"description": "Several independent sub-agent tasks to run concurrently, instead of agent_type, task and description. Results are returned together.",
+		"items": map[string]any{
+			"type":       "object",
+			"properties": taskProperties,
+			"required":   []string{"agent_type", "task", "description"},
+		},
+	}
+
+	properties["run_in_background"] = map[string]any{
+		"type":        "boolean",
+		"description": "Start the sub-agent(s) in the background and return their ids immediately instead of waiting (optional). Results are delivered automatically once finished; follow up with task_status, task_output, task_wait or task_cancel.",
+	}
+
+	// Either the single-task fields or tasks must be given; Execute checks which
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
 	}
 }
 
+// taskParams describes one sub-agent task
+type taskParams struct {
+	AgentType    string         `json:"agent_type"`
+	Task         string         `json:"task"`
+	Description  string         `json:"description"`
+	MaxTurns     int            `json:"max_turns"`
+	OutputSchema map[string]any `json:"output_schema"`
+}
+
+// validate checks the required fields of a task
+func (p *taskParams) validate() string {
+	switch {
+	case len(p.Task) == 0:
+		return "task parameter cannot be empty"
+	case len(p.Description) == 0:
+		return "description parameter cannot be empty"
+	case len(p.AgentType) == 0:
+		return "agent_type parameter cannot be empty"
+	}
+	return ""
+}
+
+// subAgentResult is the outcome of one sub-agent run
+type subAgentResult struct {
+	id     string
+	params taskParams
+	output *agent.Output
+	err    error
+}
+
+// data returns the result data reported for the sub-agent
+func (r *subAgentResult) data() map[string]any {
+	data := map[string]any{
+		"id":         r.id,
+		"agent_type": r.params.AgentType,
+	}
+	if r.err != nil {
+		data["error"] = r.err.Error()
+		return data
+	}
+
+	// Sub-agent usage is already accounted under the parent via context;
+	// report the totals for visibility
+	usage, cost := r.output.Usage.Total()
+	data["tool_calls"] = len(r.output.ToolCalls)
+	data["turns"] = r.output.Turns
+	data["tokens"] = usage.TotalTokens
+	data["cost"] = cost
+	data["stop_reason"] = string(r.output.StopReason)
+	if r.output.StopDetail != "" {
+		data["stop_detail"] = r.output.StopDetail
+	}
+	if len(r.output.Structured) > 0 {
+		data["structured"] = r.output.Structured
+	}
+	return data
+}
+
+// text returns the sub-agent's answer, noting when it stopped before
+// reaching a final answer
+func (r *subAgentResult) text() string {
+	if len(r.output.Structured) > 0 {
+		return string(r.output.Structured)
+	}
+	text := strings.TrimSpace(r.output.Result)
+	switch r.output.StopReason {
+	case "", agent.StopCompleted, agent.StopLength: // Truncation is noted in the result
+	default:
+		reason := string(r.output.StopReason)
+		if r.output.StopDetail != "" {
+			reason += ": " + r.output.StopDetail
+		}
+		text += fmt.Sprintf("\n\n[Sub-agent stopped early (%s); the result may be incomplete]", reason)
+	}
+	return text
+}
+
 func (t *TaskTool) Execute(ctx context.Context, params json.RawMessage) (*tool.Result, error) {
 	var p struct {
-		AgentType   string `json:"agent_type"`
-		Task        string `json:"task"`
-		Description string `json:"description"`
-		MaxTurns    int    `json:"max_turns"`
+		taskParams
+		Tasks           []taskParams `json:"tasks"`
+		RunInBackground bool         `json:"run_in_background"`
 	}
 
 	if err := json.Unmarshal(params, &p); err != nil {
@@ -110,85 +283,251 @@ func (t *TaskTool) Execute(ctx context.Context, params json.RawMessage) (*tool.R
 		}, nil
 	}
 
-	// Validate required parameters
-	if len(p.Task) == 0 {
+	// Check nesting depth
+	depth := agent.GetNestingDepth(ctx)
+	if depth >= MaxNestingDepth {
 		return &tool.Result{
 			Success: false,
-			Error:   "task parameter cannot be empty",
+			Error:   fmt.Sprintf("maximum nesting depth (%d) exceeded", MaxNestingDepth),
 		}, nil
 	}
-	if len(p.Description) == 0 {
+
+	if len(p.Tasks) > 0 {
+		if p.Task != "" {
+			return &tool.Result{
+				Success: false,
+				Error:   "pass either tasks or a single task, not both",
+			}, nil
+		}
+		if p.RunInBackground {
+			return t.startBackground(ctx, p.Tasks), nil
+		}
+		return t.executeBatch(ctx, p.Tasks), nil
+	}
+
+	// Validate required parameters
+	if msg := p.validate(); msg != "" {
 		return &tool.Result{
 			Success: false,
-			Error:   "description parameter cannot be empty",
+			Error:   msg,
 		}, nil
 	}
-	if len(p.AgentType) == 0 {
+
+	if p.RunInBackground {
+		return t.startBackground(ctx, []taskParams{p.taskParams}), nil
+	}
+
+	r := t.runSubAgent(ctx, p.taskParams, agent.SubAgentBudget(ctx, 1))
+	if r.err != nil {
 		return &tool.Result{
 			Success: false,
-			Error:   "agent_type parameter cannot be empty",
+			Error:   r.err.Error(),
 		}, nil
 	}
 
-	// Check nesting depth
-	depth := agent.GetNestingDepth(ctx)
-	if depth >= MaxNestingDepth {
+	// Structured results are returned as bare JSON so the caller can parse them
+	if len(r.output.Structured) > 0 {
 		return &tool.Result{
-			Success: false,
-			Error:   fmt.Sprintf("maximum nesting depth (%d) exceeded", MaxNestingDepth),
+			Success: true,
+			Output:  string(r.output.Structured),
+			Data:    r.data(),
 		}, nil
 	}
 
-	// Create sub-agent
+	// Format result
+	resultText := fmt.Sprintf("[%s agent: %s]\n\n%s",
+		p.AgentType, p.Description, r.text())
+
+	return &tool.Result{
+		Success: true,
+		Output:  resultText,
+		Data:    r.data(),
+	}, nil
+}
+
+// executeBatch runs several sub-agents concurrently, at most maxConcurrency
+// at a time, and aggregates their results in task order. A failing
+// sub-agent does not stop the others.
+func (t *TaskTool) executeBatch(ctx context.Context, tasks []taskParams) *tool.Result {
+	for i := range tasks {
+		if msg := tasks[i].validate(); msg != "" {
+			return &tool.Result{
+				Success: false,
+				Error:   fmt.Sprintf("tasks[%d]: %s", i, msg),
+			}
+		}
+	}
+
+	// Ids are assigned in task order and logged up front, so that a single
+	// sub-agent can be cancelled by id while the caller waits for the batch
+	results := make([]*subAgentResult, len(tasks))
+	subAgents := make([]agent.Agent, len(tasks))
+	var ids []string
+	for i, p := range tasks {
+		subAgent, id, err := t.newSubAgent(p)
+		if err != nil {
+			results[i] = &subAgentResult{params: p, err: err}
+			continue
+		}
+		subAgents[i] = subAgent
+		results[i] = &subAgentResult{id: id, params: p}
+		ids = append(ids, id)
+	}
+	log := parentLogger(ctx)
+	log.Info("Running %d sub-agents: %s", len(ids), strings.Join(ids, ", "))
+
+	budget := agent.SubAgentBudget(ctx, len(tasks))
+	sem := make(chan struct{}, t.maxConcurrency)
+	var wg sync.WaitGroup
+
+	for i, p := range tasks {
+		if subAgents[i] == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, p taskParams) {
+			defer wg.Done()
+
+			id := results[i].id
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = &subAgentResult{id: id, params: p, err: ctx.Err()}
+				return
+			}
+			results[i] = t.runAgent(ctx, subAgents[i], id, p, budget, log, log.WithPrefix("["+id+"]"))
+		}(i, p)
+	}
+	wg.Wait()
+
+	var out strings.Builder
+	succeeded := 0
+	data := make([]map[string]any, len(results))
+	for i, r := range results {
+		data[i] = r.data()
+
+		label := r.params.AgentType + " agent"
+		if r.id != "" {
+			label = r.id
+		}
+		if r.err != nil {
+			fmt.Fprintf(&out, "=== [%s: %s] FAILED ===\n\n%v\n\n", label, r.params.Description, r.err)
+			continue
+		}
+		succeeded++
+
+		fmt.Fprintf(&out, "=== [%s: %s] ===\n\n%s\n\n", label, r.params.Description, r.text())
+	}
+
+	summary := fmt.Sprintf("[batch: %d sub-agents, %d succeeded, %d failed]\n\n", len(results), succeeded, len(results)-succeeded)
+	result := &tool.Result{
+		Success: succeeded > 0,
+		Output:  summary + strings.TrimRight(out.String(), "\n"),
+		Data: map[string]any{
+			"succeeded": succeeded,
+			"failed":    len(results) - succeeded,
+			"results":   data,
+		},
+	}
+	if succeeded == 0 {
+		result.Error = "all sub-agents failed"
+	}
+	return result
+}
+
+// newSubAgent creates the sub-agent for a task and assigns its id
+func (t *TaskTool) newSubAgent(p taskParams) (agent.Agent, string, error) {
 	subAgent, err := t.factory.CreateAgent(agent.AgentType(p.AgentType))
 	if err != nil {
-		return &tool.Result{
-			Success: false,
-			Error:   fmt.Sprintf("failed to create agent: %v", err),
-		}, nil
+		return nil, "", fmt.Errorf("failed to create agent: %v", err)
+	}
+	return subAgent, fmt.Sprintf("%s-%d", p.AgentType, t.nextID.Add(1)), nil
+}
+
+// parentLogger returns the logger of the calling agent
+func parentLogger(ctx context.Context) *logger.Logger {
+	if log := agent.GetLoggerFromContext(ctx); log != nil {
+		return log
 	}
+	// Fallback: create a basic logger
+	return logger.NewLogger(nil, logger.LevelInfo)
+}
 
-	// Get parent logger from context
-	parentLogger := agent.GetLoggerFromContext(ctx)
-	if parentLogger == nil {
-		// Fallback: create a basic logger
-		parentLogger = logger.NewLogger(nil, logger.LevelInfo)
+// runSubAgent creates and runs one sub-agent, logging with its id as prefix
+func (t *TaskTool) runSubAgent(ctx context.Context, p taskParams, budget agent.Budget) *subAgentResult {
+	subAgent, id, err := t.newSubAgent(p)
+	if err != nil {
+		return &subAgentResult{params: p, err: err}
 	}
+	log := parentLogger(ctx)
+	return t.runAgent(ctx, subAgent, id, p, budget, log, log.WithPrefix("["+id+"]"))
+}
+
+// runAgent runs a sub-agent under its own cancellable context, limited to
+// its share of the caller's budget. Progress is reported to parentLog while
+// the sub-agent logs to log.
+func (t *TaskTool) runAgent(ctx context.Context, subAgent agent.Agent, id string, p taskParams, budget agent.Budget, parentLog, log *logger.Logger) *subAgentResult {
+	r := &subAgentResult{id: id, params: p}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t.mu.Lock()
+	t.running[r.id] = cancel
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.running, r.id)
+		t.mu.Unlock()
+	}()
 
 	// Log sub-agent start
-	parentLogger.Info("Launching %s sub-agent: %s", p.AgentType, p.Description)
+	parentLog.Info("Launching %s sub-agent %s: %s", p.AgentType, r.id, p.Description)
 
 	// Create context with incremented depth
-	subCtx := agent.WithNestingDepth(ctx, depth+1)
+	subCtx = agent.WithNestingDepth(subCtx, agent.GetNestingDepth(ctx)+1)
+
+	// Ask for a schema-conforming answer when a schema is given
+	var format *llm.ResponseFormat
+	if len(p.OutputSchema) > 0 {
+		format = &llm.ResponseFormat{Name: p.AgentType + "_result", Schema: p.OutputSchema}
+	}
 
 	// Run sub-agent
 	output, err := subAgent.Run(subCtx, &agent.Input{
-		Task:        p.Task,
-		MaxTurns:    p.MaxTurns,   // Use provided or default (0 = agent default)
-		Temperature: 0,            // Use agent default
-		Logger:      parentLogger, // Share parent logger
+		Task:           p.Task,
+		MaxTurns:       p.MaxTurns, // Use provided or default (0 = agent default)
+		Temperature:    0,          // Use agent default
+		Logger:         log,
+		Budget:         budget,
+		ResponseFormat: format,
 	})
+
+	// Background sub-agents it started end with it instead of running on
+	// with nobody to deliver their results to
+	if n := t.background.cancelOwned(subAgent); n > 0 {
+		parentLog.Info("Cancelled %d background sub-agent(s) left by %s", n, r.id)
+	}
+
 	if err != nil {
-		return &tool.Result{
-			Success: false,
-			Error:   fmt.Sprintf("sub-agent failed: %v", err),
-		}, nil
+		r.err = fmt.Errorf("sub-agent failed: %v", err)
+		parentLog.Error("Sub-agent %s failed: %v", r.id, err)
+		return r
 	}
 
-	// Log sub-agent completion
-	parentLogger.Info("Sub-agent completed: %s", p.Description)
+	// A cancelled run returns its partial work without an error, but the
+	// sub-agent was stopped, not finished
+	if output.StopReason == agent.StopInterrupted {
+		r.output = output
+		r.err = fmt.Errorf("sub-agent interrupted: %w", context.Canceled)
+		parentLog.Info("Sub-agent %s interrupted: %s", r.id, p.Description)
+		return r
+	}
 
-	// Format result
-	resultText := fmt.Sprintf("[%s agent: %s]\n\n%s",
-		p.AgentType, p.Description, output.Result)
+	// Log sub-agent completion
+	parentLog.Info("Sub-agent %s completed: %s", r.id, p.Description)
 
-	return &tool.Result{
-		Success: true,
-		Output:  resultText,
-		Data: map[string]any{
-			"agent_type": p.AgentType,
-			"tool_calls": len(output.ToolCalls),
-			"turns":      len(output.Messages),
-		},
-	}, nil
+	r.output = output
+	return r
 }
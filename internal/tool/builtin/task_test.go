@@ -0,0 +1,274 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"finta/internal/agent"
+)
+
+// stubAgent returns a fixed output and records its input
+type stubAgent struct {
+	input  *agent.Input
+	output *agent.Output
+}
+
+func (a *stubAgent) Name() string { return "stub" }
+func (a *stubAgent) Run(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+	a.input = input
+	return a.output, nil
+}
+func (a *stubAgent) RunStreaming(ctx context.Context, input *agent.Input, onEvent agent.EventHandler) (*agent.Output, error) {
+	return a.Run(ctx, input)
+}
+
+type stubFactory struct {
+	agent *stubAgent
+}
+
+func (f *stubFactory) CreateAgent(agentType agent.AgentType) (agent.Agent, error) {
+	return f.agent, nil
+}
+
+func (f *stubFactory) AgentTypes() []agent.AgentTypeInfo {
+	return []agent.AgentTypeInfo{
+		{Type: agent.AgentTypeExplore, Description: "Explores code"},
+		{Type: "reviewer", Description: "Reviews changes"},
+	}
+}
+
+func TestTaskTool_OutputSchema(t *testing.T) {
+	sub := &stubAgent{output: &agent.Output{
+		Result:     `{"files": ["main.go"]}`,
+		Structured: json.RawMessage(`{"files":["main.go"]}`),
+	}}
+	task := NewTaskTool(&stubFactory{agent: sub})
+
+	params := `{
+		"agent_type": "explore",
+		"task": "list go files",
+		"description": "List Go files",
+		"output_schema": {"type": "object", "properties": {"files": {"type": "array"}}}
+	}`
+	result, err := task.Execute(context.Background(), json.RawMessage(params))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+
+	if sub.input.ResponseFormat == nil || sub.input.ResponseFormat.Schema["type"] != "object" {
+		t.Fatalf("Expected sub-agent to be asked for a schema, got %+v", sub.input.ResponseFormat)
+	}
+	if result.Output != `{"files":["main.go"]}` {
+		t.Errorf("Expected bare structured JSON, got %q", result.Output)
+	}
+}
+
+func TestTaskTool_AgentTypeEnum(t *testing.T) {
+	task := NewTaskTool(&stubFactory{})
+
+	agentType := task.Parameters()["properties"].(map[string]any)["agent_type"].(map[string]any)
+	enum := agentType["enum"].([]string)
+	if len(enum) != 2 || enum[1] != "reviewer" {
+		t.Errorf("Expected enum from the factory's agent types, got %v", enum)
+	}
+	if desc := agentType["description"].(string); !strings.Contains(desc, "reviewer: Reviews changes") {
+		t.Errorf("Expected custom type description, got %q", desc)
+	}
+}
+
+// funcAgent runs a function, letting tests control each sub-agent
+type funcAgent struct {
+	run func(ctx context.Context, input *agent.Input) (*agent.Output, error)
+}
+
+func (a *funcAgent) Name() string { return "func" }
+func (a *funcAgent) Run(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+	// Identify the agent to tools, as BaseAgent does
+	return a.run(agent.WithAgent(ctx, a), input)
+}
+func (a *funcAgent) RunStreaming(ctx context.Context, input *agent.Input, onEvent agent.EventHandler) (*agent.Output, error) {
+	return a.run(ctx, input)
+}
+
+// interrupted returns what BaseAgent returns for a cancelled run: the
+// partial output and no error
+func interrupted() (*agent.Output, error) {
+	return &agent.Output{Result: agent.InterruptedMarker, StopReason: agent.StopInterrupted}, nil
+}
+
+type funcFactory struct {
+	run func(ctx context.Context, input *agent.Input) (*agent.Output, error)
+}
+
+func (f *funcFactory) CreateAgent(agentType agent.AgentType) (agent.Agent, error) {
+	return &funcAgent{run: f.run}, nil
+}
+
+func (f *funcFactory) AgentTypes() []agent.AgentTypeInfo { return nil }
+
+func TestTaskTool_BatchRunsConcurrentlyWithLimit(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+
+		if input.Task == "fail" {
+			return nil, errors.New("boom")
+		}
+		return &agent.Output{Result: "done: " + input.Task}, nil
+	}})
+	task.SetMaxConcurrency(2)
+
+	params := `{"tasks": [
+		{"agent_type": "explore", "task": "a", "description": "Explore a"},
+		{"agent_type": "explore", "task": "fail", "description": "Explore b"},
+		{"agent_type": "explore", "task": "c", "description": "Explore c"},
+		{"agent_type": "explore", "task": "d", "description": "Explore d"}
+	]}`
+	result, err := task.Execute(context.Background(), json.RawMessage(params))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+
+	if peak != 2 {
+		t.Errorf("Expected at most 2 concurrent sub-agents, got %d", peak)
+	}
+	if result.Data["succeeded"] != 3 || result.Data["failed"] != 1 {
+		t.Errorf("Expected 3 successes and 1 failure, got %+v", result.Data)
+	}
+
+	// Results keep task order and are clearly separated
+	a := strings.Index(result.Output, "done: a")
+	b := strings.Index(result.Output, "Explore b] FAILED")
+	d := strings.Index(result.Output, "done: d")
+	if a < 0 || b < a || d < b {
+		t.Errorf("Expected results in task order, got:\n%s", result.Output)
+	}
+}
+
+func TestTaskTool_CancelStopsOneSubAgent(t *testing.T) {
+	started := make(chan struct{}, 2)
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		started <- struct{}{}
+		if input.Task == "slow" {
+			<-ctx.Done()
+			return interrupted()
+		}
+		time.Sleep(50 * time.Millisecond)
+		return &agent.Output{Result: "quick result"}, nil
+	}})
+
+	// Ids are assigned as the sub-agents start, so the slow one is 1 or 2
+	cancelled := make(chan bool, 1)
+	go func() {
+		<-started
+		<-started
+		cancelTool := NewTaskCancelTool(task)
+		for _, id := range []string{"slow-1", "slow-2"} {
+			if r, _ := cancelTool.Execute(context.Background(), json.RawMessage(`{"id": "`+id+`"}`)); r.Success {
+				cancelled <- true
+				return
+			}
+		}
+		cancelled <- false
+	}()
+
+	params := `{"tasks": [
+		{"agent_type": "slow", "task": "slow", "description": "Slow task"},
+		{"agent_type": "quick", "task": "quick", "description": "Quick task"}
+	]}`
+	result, err := task.Execute(context.Background(), json.RawMessage(params))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if !<-cancelled {
+		t.Fatal("Expected task_cancel to stop the slow sub-agent")
+	}
+	if result.Data["failed"] != 1 || !strings.Contains(result.Output, "quick result") {
+		t.Errorf("Expected only the cancelled sub-agent to fail, got %+v\n%s", result.Data, result.Output)
+	}
+	if !strings.Contains(result.Output, ": Slow task] FAILED ===\n\nsub-agent interrupted") {
+		t.Errorf("Expected the cancelled sub-agent reported as interrupted, got:\n%s", result.Output)
+	}
+}
+
+func TestTaskTool_CancelStopsBatchMemberByID(t *testing.T) {
+	started := make(chan struct{})
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		if input.Task == "slow" {
+			close(started)
+			<-ctx.Done()
+			return interrupted()
+		}
+		return &agent.Output{Result: "quick result"}, nil
+	}})
+	task.SetMaxConcurrency(1)
+
+	// With one sub-agent at a time ids follow the task order, as logged at launch
+	go func() {
+		<-started
+		task.Cancel("slow-1")
+	}()
+
+	params := `{"tasks": [
+		{"agent_type": "slow", "task": "slow", "description": "Slow task"},
+		{"agent_type": "quick", "task": "quick", "description": "Quick task"}
+	]}`
+	result, err := task.Execute(context.Background(), json.RawMessage(params))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	results := result.Data["results"].([]map[string]any)
+	if results[0]["id"] != "slow-1" || !strings.Contains(results[0]["error"].(string), "interrupted") {
+		t.Errorf("Expected slow-1 reported as interrupted, got %+v", results[0])
+	}
+	if _, failed := results[1]["error"]; failed {
+		t.Errorf("Expected the other sub-agent to finish, got %+v", results[1])
+	}
+}
+
+func TestTaskTool_InterruptedSubAgentFails(t *testing.T) {
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		return interrupted()
+	}})
+
+	result, err := task.Execute(context.Background(), json.RawMessage(`{"agent_type": "explore", "task": "check packages", "description": "Check packages"}`))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Success || !strings.Contains(result.Error, "interrupted") {
+		t.Errorf("Expected an interrupted sub-agent reported as failed, got %+v", result)
+	}
+}
+
+func TestTaskTool_NotesPartialResult(t *testing.T) {
+	task := NewTaskTool(&funcFactory{run: func(ctx context.Context, input *agent.Input) (*agent.Output, error) {
+		return &agent.Output{Result: "Checked 2 of 5 packages.", StopReason: agent.StopMaxTurns, Turns: 3}, nil
+	}})
+
+	result, err := task.Execute(context.Background(), json.RawMessage(`{"agent_type": "explore", "task": "check packages", "description": "Check packages"}`))
+	if err != nil || !result.Success {
+		t.Fatalf("Execute failed: %v %+v", err, result)
+	}
+	if !strings.Contains(result.Output, "Checked 2 of 5 packages.") || !strings.Contains(result.Output, "stopped early (max_turns)") {
+		t.Errorf("Expected the partial result with a note, got:\n%s", result.Output)
+	}
+	if result.Data["stop_reason"] != "max_turns" || result.Data["turns"] != 3 {
+		t.Errorf("Expected stop_reason and turns in data, got %+v", result.Data)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"finta/internal/checkpoint"
 	"finta/internal/tool"
 )
 
@@ -58,6 +59,14 @@ func (t *WriteTool) Execute(ctx context.Context, params json.RawMessage) (*tool.
 		}, nil
 	}
 
+	// Keep the previous content so the write can be rewound
+	if err := checkpoint.Snapshot(ctx, p.FilePath); err != nil {
+		return &tool.Result{
+			Success: false,
+			Error:   fmt.Sprintf("failed to checkpoint file: %v", err),
+		}, nil
+	}
+
 	// Ensure parent directory exists
 	dir := filepath.Dir(p.FilePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
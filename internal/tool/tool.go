@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"time"
+
+	"finta/internal/llm"
 )
 
 // Tool defines the interface that all tools must implement
@@ -28,6 +30,7 @@ type Tool interface {
 type Result struct {
 	Success bool
 	Output  string
+	Parts   []llm.ContentPart // Optional multimodal output (e.g. images); Output stays the text rendering
 	Error   string
 	Data    map[string]any
 }